@@ -0,0 +1,416 @@
+// Package aligner split-aligns reads against the reference windows left and
+// right of an SV to find their breakpoints.
+package aligner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/balanur/brosv-go/genome"
+)
+
+// Junction gives the strand of the two parts of a split read. The left
+// part is the read prefix aligned against refL, the right part the suffix
+// aligned against refR; an inverted part is reverse complemented.
+type Junction struct {
+	InvertedL bool
+	InvertedR bool
+}
+
+// Result is a split alignment. AL, BL and CL are the reference, read and
+// match lines of the left part, AR, BR and CR those of the right part, in
+// reference order with inverted parts complemented. Pos and PosR are the
+// starts of the parts in refL and refR. LBP and RBP are the breakpoints in
+// refL and refR: the last base before the junction on the forward strand,
+// so the end of a forward left part and the base before the start of a
+// forward right part, the other way round for inverted parts.
+type Result struct {
+	AL, CL, BL           string
+	AR, BR, CR           string
+	IdentityL, IdentityR float64
+	LBP, RBP, Pos, PosR  int
+	Score                int
+}
+
+// DefaultMaxWindow is the largest reference window, in bp, aligned against by default
+const DefaultMaxWindow = 10000
+
+// ErrWindowTooLarge is returned by Align for reference windows over the limit of the Aligner
+var ErrWindowTooLarge = errors.New("reference window too large")
+
+// matrix is a DP matrix whose backing array is kept between alignments
+type matrix struct {
+	rows [][]int
+	data []int
+}
+
+// reset resizes m to rows x cols and zeroes it
+func (m *matrix) reset(rows int, cols int) [][]int {
+	n := rows * cols
+	if cap(m.data) < n {
+		m.data = make([]int, n)
+	} else {
+		m.data = m.data[:n]
+		for i := range m.data {
+			m.data[i] = 0
+		}
+	}
+	if cap(m.rows) < rows {
+		m.rows = make([][]int, rows)
+	} else {
+		m.rows = m.rows[:rows]
+	}
+	for i := range m.rows {
+		m.rows[i] = m.data[i*cols : (i+1)*cols : (i+1)*cols]
+	}
+	return m.rows
+}
+
+// row is one row of each DP matrix, a reference base against every read
+// base
+type row struct {
+	score, gapa, gapb []int
+}
+
+func (r *row) reset(cols int) {
+	if cap(r.score) < cols {
+		r.score, r.gapa, r.gapb = make([]int, cols), make([]int, cols), make([]int, cols)
+	}
+	r.score, r.gapa, r.gapb = r.score[:cols], r.gapa[:cols], r.gapb[:cols]
+}
+
+// half is one part of a split: the read prefix, or the reversed suffix,
+// aligned from its first base against any stretch of ref. best holds the
+// row of the best cell of every read column, bestScore its score.
+type half struct {
+	ref, seq        string
+	mis             []int
+	best, bestScore []int
+}
+
+// Aligner split-aligns reads, reusing its buffers from one read to the
+// next. A first pass over each reference window keeps two DP rows and the
+// best cell of every read column; the traceback then recomputes only the
+// rows it walks, which span about as many bases as the part of the read,
+// so memory grows with the read and not with the windows. The windows
+// are limited to MaxWindow bp each. An Aligner is not safe for concurrent
+// use; give every goroutine its own.
+type Aligner struct {
+	MaxWindow int
+	Scoring   Scoring
+
+	prev, next             row
+	score, gapa, gapb      matrix
+	bestL, bestR           []int
+	bestScoreL, bestScoreR []int
+	mismatch, mismatchR    []int
+}
+
+// NewAligner returns an Aligner scoring with scoring for windows of up to
+// maxWindow bp, or DefaultMaxWindow if maxWindow is not positive
+func NewAligner(maxWindow int, scoring Scoring) *Aligner {
+	if maxWindow <= 0 {
+		maxWindow = DefaultMaxWindow
+	}
+	return &Aligner{MaxWindow: maxWindow, Scoring: scoring}
+}
+
+// firstRow fills r with row 0 for the first cols read columns: leading
+// read bases are gaps, and the part may start anywhere in the window
+func (a *Aligner) firstRow(r row, cols int) {
+	r.score[0], r.gapa[0], r.gapb[0] = 0, 0, 0
+	for j := 1; j < cols; j++ {
+		val := a.Scoring.GapOpen + (j-1)*a.Scoring.GapExtend
+		r.score[j], r.gapa[j], r.gapb[j] = val, val, val
+	}
+}
+
+// nextRow fills r with row i of p for the first cols read columns, given
+// row i-1 in prev
+func (a *Aligner) nextRow(p *half, i int, prev row, r row, cols int) {
+	sc := a.Scoring
+	val := sc.GapOpen + (i-1)*sc.GapExtend
+	r.score[0], r.gapa[0], r.gapb[0] = 0, val, val
+	base := p.ref[i-1]
+	for j := 1; j < cols; j++ {
+		r.gapa[j] = max2(prev.gapa[j], prev.score[j]+sc.GapOpen) + sc.GapExtend
+		r.gapb[j] = max2(r.gapb[j-1], r.score[j-1]+sc.GapOpen) + sc.GapExtend
+		r.score[j] = max3(prev.score[j-1], prev.gapa[j-1], prev.gapb[j-1]) + sc.substitution(base, p.seq[j-1], p.mis[j-1])
+	}
+}
+
+// bestCells runs the DP of p over the whole window two rows at a time and
+// keeps the best cell of every read column, the first on ties
+func (a *Aligner) bestCells(p *half) {
+	cols := len(p.seq) + 1
+	a.prev.reset(cols)
+	a.next.reset(cols)
+	a.firstRow(a.prev, cols)
+	p.best[0], p.bestScore[0] = 0, 0
+	for i := 1; i <= len(p.ref); i++ {
+		a.nextRow(p, i, a.prev, a.next, cols)
+		for j := 1; j < cols; j++ {
+			if i == 1 || a.next.score[j] > p.bestScore[j] {
+				p.best[j], p.bestScore[j] = i, a.next.score[j]
+			}
+		}
+		a.prev, a.next = a.next, a.prev
+	}
+}
+
+// walk is the state of a traceback
+type walk struct {
+	a, b, c         bytes.Buffer
+	pi, pj, cur     int
+	mismatch, indel int
+}
+
+// trace walks p back from the best cell of read column cols-1 and writes
+// the reference, read and match lines of the part in walking order, cur
+// being the state the walk starts in. Rows are recomputed from the top of
+// the window but only those the walk may reach are kept: a window of
+// rows that is doubled whenever the walk runs off its top.
+func (a *Aligner) trace(p *half, cols int, cur int) *walk {
+	end := p.best[cols-1]
+	height := 2 * cols
+	for {
+		lo := max2(end-height+1, 0)
+		if w, ok := a.traceRows(p, lo, end, cols, cur); ok {
+			return w
+		}
+		height *= 2
+	}
+}
+
+// traceRows recomputes rows lo to end of p and walks back through them,
+// reporting false if the walk needs a row above lo
+func (a *Aligner) traceRows(p *half, lo int, end int, cols int, cur int) (*walk, bool) {
+	sc := a.Scoring
+	rows := end - lo + 1
+	scoreM := a.score.reset(rows, cols)
+	gapaM := a.gapa.reset(rows, cols)
+	gapbM := a.gapb.reset(rows, cols)
+	at := func(i int) row {
+		return row{scoreM[i-lo], gapaM[i-lo], gapbM[i-lo]}
+	}
+
+	a.prev.reset(cols)
+	a.next.reset(cols)
+	prev, next := a.prev, a.next
+	if lo == 0 {
+		a.firstRow(at(0), cols)
+		prev = at(0)
+	} else {
+		a.firstRow(prev, cols)
+	}
+	for i := 1; i <= end; i++ {
+		switch {
+		case i >= lo:
+			a.nextRow(p, i, prev, at(i), cols)
+			prev = at(i)
+		default:
+			a.nextRow(p, i, prev, next, cols)
+			prev, next = next, prev
+		}
+	}
+
+	w := &walk{pi: end, pj: cols - 1, cur: cur}
+	for w.pi > 0 && w.pj > 0 {
+		pi, pj := w.pi-lo, w.pj
+		if pi == 0 {
+			return nil, false
+		}
+		if w.cur == 0 {
+			tmp := sc.substitution(p.ref[w.pi-1], p.seq[pj-1], p.mis[pj-1])
+			if tmp == sc.Match {
+				w.c.WriteString("|")
+			} else {
+				w.c.WriteString(" ")
+			}
+			w.a.WriteString(p.ref[w.pi-1 : w.pi])
+			w.b.WriteString(p.seq[pj-1 : pj])
+
+			if gapaM[pi-1][pj-1]+tmp == scoreM[pi][pj] {
+				w.indel++
+				w.cur = 1
+			} else if gapbM[pi-1][pj-1]+tmp == scoreM[pi][pj] {
+				w.indel++
+				w.cur = 2
+			}
+			w.pi--
+			w.pj--
+
+			if tmp != sc.Match {
+				w.mismatch++
+			}
+		} else if w.cur == 1 {
+			w.a.WriteString(p.ref[w.pi-1 : w.pi])
+			w.b.WriteString("-")
+			w.c.WriteString(" ")
+			if scoreM[pi-1][pj]+sc.GapExtend+sc.GapOpen == gapaM[pi][pj] {
+				w.cur = 0
+			}
+			w.pi--
+		} else {
+			w.a.WriteString("-")
+			w.b.WriteString(p.seq[pj-1 : pj])
+			w.c.WriteString(" ")
+			if scoreM[pi][pj-1]+sc.GapExtend+sc.GapOpen == gapbM[pi][pj] {
+				w.cur = 0
+			}
+			w.pj--
+		}
+	}
+	//for soft clips
+	for ; w.pj > 0; w.pj-- {
+		w.a.WriteString("-")
+		w.c.WriteString("S")
+		w.b.WriteString(p.seq[w.pj-1 : w.pj])
+	}
+	return w, true
+}
+
+// Align splits read between refL and refR, each part on the strand given by
+// junction. qual holds the base qualities of read for quality-aware scoring
+// and may be nil.
+func (a *Aligner) Align(refL string, refR string, read string, qual []byte, junction Junction) (Result, error) {
+	sc := a.Scoring
+
+	if len(refL) > a.MaxWindow || len(refR) > a.MaxWindow {
+		return Result{}, fmt.Errorf("%w: %d and %d bp, limit %d", ErrWindowTooLarge, len(refL), len(refR), a.MaxWindow)
+	}
+	if len(refL) == 0 || len(refR) == 0 {
+		return Result{}, errors.New("empty reference window")
+	}
+
+	N := len(read) + 1
+	if cap(a.bestL) < N {
+		a.bestL, a.bestR = make([]int, N), make([]int, N)
+		a.bestScoreL, a.bestScoreR = make([]int, N), make([]int, N)
+	}
+	// mismatch penalty of every read base, indexed on read and on the
+	// reversed read
+	a.mismatch = sc.mismatchPenalties(qual, len(read), a.mismatch)
+	if cap(a.mismatchR) < len(read) {
+		a.mismatchR = make([]int, len(read))
+	}
+	a.mismatchR = a.mismatchR[:len(read)]
+	for j, m := range a.mismatch {
+		a.mismatchR[len(read)-1-j] = m
+	}
+
+	// The left part aligns prefixes of the read from its start, the right
+	// part suffixes from its end. An inverted part comes from the reverse
+	// strand: the complemented read is aligned against the reversed window.
+	left := half{ref: refL, seq: read, mis: a.mismatch, best: a.bestL[:N], bestScore: a.bestScoreL[:N]}
+	right := half{ref: refR, seq: genome.Reverse(read), mis: a.mismatchR, best: a.bestR[:N], bestScore: a.bestScoreR[:N]}
+	if junction.InvertedL {
+		left.seq = genome.Complement(left.seq)
+		left.ref = genome.Reverse(left.ref)
+	}
+	if junction.InvertedR {
+		right.seq = genome.Complement(right.seq)
+	} else {
+		right.ref = genome.Reverse(right.ref)
+	}
+	a.bestCells(&left)
+	a.bestCells(&right)
+
+	var result Result
+
+	// find best split
+	max := left.bestScore[len(read)]
+	split := len(read)
+	for i := len(read) - 1; i >= 0; i-- {
+		if left.bestScore[i]+right.bestScore[len(read)-i] > max {
+			max = left.bestScore[i] + right.bestScore[len(read)-i]
+			split = i
+		}
+	}
+	result.Score = max
+
+	// left part alignment result
+	w := a.trace(&left, split+1, 0)
+
+	// the backtrace walks the window backwards, so the lines of a forward
+	// part are reversed to get them in reference order
+	result.AL, result.BL, result.CL = w.a.String(), w.b.String(), w.c.String()
+	if !junction.InvertedL {
+		result.AL = genome.Reverse(result.AL)
+		result.BL = genome.Reverse(result.BL)
+		result.CL = genome.Reverse(result.CL)
+	}
+	// start and end loc of mapping in ref
+	startL, endL := span(w.pi, left.best[split]-1, len(refL), junction.InvertedL)
+	result.Pos = startL
+	if junction.InvertedL {
+		result.LBP = startL - 1
+	} else {
+		result.LBP = endL
+	}
+
+	// find identity of left part
+	l := 1 + math.Abs(float64(endL-startL+1-split))
+	result.IdentityL = -1.0
+
+	if split != 0 {
+		logl := math.Log(l)
+		result.IdentityL = 1 - (float64(w.mismatch+w.indel)+logl)/float64(split)
+	}
+
+	// right part alignment result, the walk starting in the state the left
+	// one ended in as it always has
+	w = a.trace(&right, len(read)-split+1, w.cur)
+
+	result.AR, result.BR, result.CR = w.a.String(), w.b.String(), w.c.String()
+	if junction.InvertedR {
+		result.AR = genome.Reverse(result.AR)
+		result.BR = genome.Reverse(result.BR)
+		result.CR = genome.Reverse(result.CR)
+	}
+	startR, endR := span(w.pi, right.best[len(read)-split]-1, len(refR), !junction.InvertedR)
+	result.PosR = startR
+	if junction.InvertedR {
+		result.RBP = endR
+	} else {
+		result.RBP = startR - 1
+	}
+
+	// find identity of right part
+	len := len(read) - split
+	l = 1 + math.Abs(float64(endR-startR+1-len))
+	result.IdentityR = -1.0
+	if len != 0 {
+		logl := math.Log(l)
+		result.IdentityR = 1 - (float64(w.mismatch+w.indel)+logl)/float64(len)
+	}
+
+	return result, nil
+}
+
+// span maps the 0-based positions first to last of a window that was
+// aligned reversed back to forward positions
+func span(first int, last int, n int, reversed bool) (int, int) {
+	if reversed {
+		return n - 1 - last, n - 1 - first
+	}
+	return first, last
+}
+
+func max2(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+func max3(a int, b int, c int) int {
+	if a > b && a > c {
+		return a
+	}
+	if b > a && b > c {
+		return b
+	}
+	return c
+}
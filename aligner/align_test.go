@@ -0,0 +1,138 @@
+package aligner
+
+import (
+	"bufio"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testdata/splits.tsv holds reads split by the aligner as it was before
+// its matrices were bounded, which kept every row of both windows: the
+// junction, scoring, windows, read and qualities of each, then the Score,
+// Pos, LBP, PosR, RBP, identities and alignment lines it returned. The
+// forward cases were also checked against the first aligner, which only
+// knew deletions.
+func readSplitFixtures(t *testing.T) [][]string {
+	f, err := os.Open("testdata/splits.tsv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var cases [][]string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 20 {
+			t.Fatalf("fixture with %d fields", len(fields))
+		}
+		cases = append(cases, fields)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return cases
+}
+
+func fixtureScoring(t *testing.T, name string) Scoring {
+	switch name {
+	case "illumina":
+		return Illumina()
+	case "illumina+qual":
+		sc := Illumina()
+		sc.QualityAware = true
+		return sc
+	case "longread":
+		return LongRead()
+	}
+	t.Fatalf("unknown scoring %q", name)
+	return Scoring{}
+}
+
+func TestAlignFixtures(t *testing.T) {
+	aligner := NewAligner(0, Illumina())
+	for _, f := range readSplitFixtures(t) {
+		name := f[0]
+		junction := Junction{InvertedL: f[1][0] == '-', InvertedR: f[1][1] == '-'}
+		aligner.Scoring = fixtureScoring(t, f[2])
+		var qual []byte
+		if f[6] != "*" {
+			qual = []byte(f[6])
+			for i := range qual {
+				qual[i] -= 33
+			}
+		}
+		got, err := aligner.Align(f[3], f[4], f[5], qual, junction)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		ints := []int{got.Score, got.Pos, got.LBP, got.PosR, got.RBP}
+		for i, v := range ints {
+			if want, _ := strconv.Atoi(f[7+i]); v != want {
+				t.Errorf("%s: field %d = %d, want %d", name, 7+i, v, want)
+			}
+		}
+		for i, v := range []float64{got.IdentityL, got.IdentityR} {
+			if want, _ := strconv.ParseFloat(f[12+i], 64); v != want {
+				t.Errorf("%s: identity %d = %v, want %v", name, i, v, want)
+			}
+		}
+		for i, v := range []string{got.AL, got.BL, got.CL, got.AR, got.BR, got.CR} {
+			if v != f[14+i] {
+				t.Errorf("%s: line %d\n got %q\nwant %q", name, i, v, f[14+i])
+			}
+		}
+	}
+}
+
+func TestAlignWindowTooLarge(t *testing.T) {
+	aligner := NewAligner(10, Illumina())
+	if _, err := aligner.Align(strings.Repeat("A", 11), "ACGT", "ACGT", nil, Junction{}); err == nil {
+		t.Error("no error for a window over MaxWindow")
+	}
+}
+
+// TestAlignLongWindow aligns a read whose parts lie at the far ends of
+// windows of the default limit, which the old aligner held in full, and
+// checks the traceback kept a few rows of them
+func TestAlignLongWindow(t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+	genome := make([]byte, 2*DefaultMaxWindow)
+	for i := range genome {
+		genome[i] = "ACGT"[r.Intn(4)]
+	}
+	refL, refR := string(genome[:DefaultMaxWindow]), string(genome[DefaultMaxWindow:])
+	read := refL[len(refL)-60:] + refR[:90]
+	aligner := NewAligner(0, Illumina())
+	got, err := aligner.Align(refL, refR, read, nil, Junction{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows := len(aligner.score.rows); rows > 2*(len(read)+1) {
+		t.Errorf("traceback kept %d rows for a %d bp read", rows, len(read))
+	}
+	if got.LBP != len(refL)-1 || got.RBP != -1 || got.Pos != len(refL)-60 || got.PosR != 0 {
+		t.Errorf("split at LBP %d, RBP %d from %d and %d", got.LBP, got.RBP, got.Pos, got.PosR)
+	}
+	if got.IdentityL != 1 || got.IdentityR != 1 {
+		t.Errorf("identities %v and %v, want 1", got.IdentityL, got.IdentityR)
+	}
+}
+
+func BenchmarkAlign(b *testing.B) {
+	r := rand.New(rand.NewSource(5))
+	genome := make([]byte, 2*DefaultMaxWindow)
+	for i := range genome {
+		genome[i] = "ACGT"[r.Intn(4)]
+	}
+	refL, refR := string(genome[:DefaultMaxWindow]), string(genome[DefaultMaxWindow:])
+	read := refL[5000:5070] + refR[3000:3080]
+	aligner := NewAligner(0, Illumina())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		aligner.Align(refL, refR, read, nil, Junction{})
+	}
+}
@@ -0,0 +1,123 @@
+package aligner
+
+import (
+	"github.com/biogo/hts/sam"
+)
+
+// ComputeCIGAR builds the CIGAR of one part of a split alignment from its
+// alignment lines and returns it with the number of read bases it consumes
+func ComputeCIGAR(aL string, bL string, cL string) (sam.Cigar, int) {
+	M := 0
+	D := 0
+	I := 0
+	S := 0
+	var cigar sam.Cigar
+	ciglen := 0
+
+	for i := 0; i < len(aL); i++ {
+		// Soft clip
+		if cL[i] == 'S' {
+			S++
+			if I != 0 {
+				ciglen += I
+				cigar = append(cigar, sam.NewCigarOp(sam.CigarInsertion, I))
+				I = 0
+			}
+			if D != 0 {
+				cigar = append(cigar, sam.NewCigarOp(sam.CigarDeletion, D))
+				D = 0
+			}
+			if M != 0 {
+				ciglen += M
+				cigar = append(cigar, sam.NewCigarOp(sam.CigarMatch, M))
+				M = 0
+			}
+		} else if cL[i] == '|' { // Alignment Match
+			M++
+			if I != 0 {
+				ciglen += I
+				cigar = append(cigar, sam.NewCigarOp(sam.CigarInsertion, I))
+				I = 0
+			}
+			if S != 0 {
+				ciglen += S
+				cigar = append(cigar, sam.NewCigarOp(sam.CigarSoftClipped, S))
+				S = 0
+			}
+			if D != 0 {
+				cigar = append(cigar, sam.NewCigarOp(sam.CigarDeletion, D))
+				D = 0
+			}
+		} else if cL[i] == ' ' && aL[i] == '-' { // Insention to reference
+			I++
+			if M != 0 {
+				ciglen += M
+				cigar = append(cigar, sam.NewCigarOp(sam.CigarMatch, M))
+				M = 0
+			}
+			if S != 0 {
+				ciglen += S
+				cigar = append(cigar, sam.NewCigarOp(sam.CigarSoftClipped, S))
+				S = 0
+			}
+			if D != 0 {
+				cigar = append(cigar, sam.NewCigarOp(sam.CigarDeletion, D))
+				D = 0
+			}
+		} else if cL[i] == ' ' && bL[i] == '-' { // Deletion from reference
+			D++
+			if I != 0 {
+				ciglen += I
+				cigar = append(cigar, sam.NewCigarOp(sam.CigarInsertion, I))
+				I = 0
+			}
+			if M != 0 {
+				ciglen += M
+				cigar = append(cigar, sam.NewCigarOp(sam.CigarMatch, M))
+				M = 0
+			}
+			if S != 0 {
+				ciglen += S
+				cigar = append(cigar, sam.NewCigarOp(sam.CigarSoftClipped, S))
+				S = 0
+			}
+		} else { // Mismatch
+			M++
+			if I != 0 {
+				ciglen += I
+				cigar = append(cigar, sam.NewCigarOp(sam.CigarInsertion, I))
+				I = 0
+			}
+			if S != 0 {
+				ciglen += S
+				cigar = append(cigar, sam.NewCigarOp(sam.CigarSoftClipped, S))
+				S = 0
+			}
+			if D != 0 {
+				cigar = append(cigar, sam.NewCigarOp(sam.CigarDeletion, D))
+				D = 0
+			}
+		}
+	}
+	// last sequence
+	if I != 0 {
+		ciglen += I
+		cigar = append(cigar, sam.NewCigarOp(sam.CigarInsertion, I))
+		I = 0
+	}
+	if M != 0 {
+		ciglen += M
+		cigar = append(cigar, sam.NewCigarOp(sam.CigarMatch, M))
+		M = 0
+	}
+	if S != 0 {
+		ciglen += S
+		cigar = append(cigar, sam.NewCigarOp(sam.CigarSoftClipped, S))
+		S = 0
+	}
+	if D != 0 {
+		cigar = append(cigar, sam.NewCigarOp(sam.CigarDeletion, D))
+		D = 0
+	}
+	return cigar, ciglen
+}
@@ -0,0 +1,236 @@
+package aligner
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/balanur/brosv-go/bamio"
+	"github.com/balanur/brosv-go/genome"
+	"github.com/balanur/brosv-go/interval"
+	"github.com/balanur/brosv-go/sv"
+	"github.com/biogo/hts/sam"
+)
+
+// Config controls the split alignment of clustered reads
+type Config struct {
+	RefFile string
+	Threads int
+	// insert size mean, the inverted segment cut from inversion windows
+	SegmentSize int
+	// largest reference window aligned against, see Aligner
+	MaxWindow int
+	Scoring   Scoring
+	// 'D' or 'N' writes a read split across a deletion as one record
+	// spanning it with that operator, 0 as primary and supplementary records
+	DeletionOp byte
+	Policy     *sv.Policy
+	// progress lines, nil for none
+	Log *log.Logger
+}
+
+// AlignClusters split-aligns the reads of clusterBamPath against the
+// reference around their CI and writes the accepted ones to outfilePath.bam,
+// sorted by coordinate and indexed
+func AlignClusters(cfg Config, clusterBamPath string, outfilePath string, svs *sv.Store, cis *interval.Store) error {
+	threads := cfg.Threads
+	bamReader, err := bamio.Open(clusterBamPath, cfg.RefFile, threads)
+	if err != nil {
+		return err
+	}
+	defer bamReader.Close()
+
+	ref, err := genome.Read(cfg.RefFile)
+	if err != nil {
+		return err
+	}
+	refs := make(map[string]*sam.Reference)
+	for _, r := range bamReader.Header().Refs() {
+		refs[r.Name()] = r
+	}
+	var alignments []*sam.Record
+
+	var wg sync.WaitGroup
+	wg.Add(threads)
+	channels := make([]chan *sam.Record, threads)
+	var resultLock sync.Mutex
+	var failed sv.FirstError
+	for threadIndex := 0; threadIndex < threads; threadIndex++ {
+		channels[threadIndex] = make(chan *sam.Record, 2000)
+		go func(tIndex int) {
+			defer wg.Done()
+			aligner := NewAligner(cfg.MaxWindow, cfg.Scoring)
+			for rec := range channels[tIndex] {
+				aligned, err := alignSingleRead(cfg, aligner, svs, cis, ref, refs, rec)
+				if err != nil {
+					if err := cfg.Policy.Malformed(err); err != nil {
+						failed.Set(err)
+					}
+					continue
+				}
+				if len(aligned) > 0 {
+					resultLock.Lock()
+					alignments = append(alignments, aligned...)
+					resultLock.Unlock()
+				}
+			}
+		}(threadIndex)
+	}
+
+	readIndex := 0
+	for failed.Get() == nil {
+		rec, err := bamReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			failed.Set(&sv.FileError{Op: "read", File: clusterBamPath, Err: err})
+			break
+		}
+		// the primary record carries the whole read, which gets new
+		// primary and supplementary records of its own
+		if rec.Flags&(sam.Secondary|sam.Supplementary) != 0 {
+			continue
+		}
+
+		channels[readIndex%threads] <- rec
+		readIndex++
+		if readIndex%10000 == 0 {
+			sv.Progress(cfg.Log, "Distributed %d, at %s %d", readIndex, rec.Ref.Name(), rec.Pos)
+		}
+	}
+
+	for i := 0; i < threads; i++ {
+		close(channels[i])
+	}
+
+	sv.Progress(cfg.Log, "Waiting on threads")
+	wg.Wait()
+	if err := failed.Get(); err != nil {
+		return err
+	}
+	sv.Progress(cfg.Log, "Aligned %d records of %d reads", len(alignments), readIndex)
+
+	// write alignments to bam
+	sv.Progress(cfg.Log, "Writing alignment results to file")
+	return bamio.WriteSorted(outfilePath+".bam", bamReader.Header(), alignments)
+}
+
+// alignSingleRead aligns a clustered read against the reference windows
+// of every split modelled for its SV and returns the records of the best
+// accepted one, none if no split is accepted. The error is a malformed
+// read, for the caller to pass to the policy.
+func alignSingleRead(cfg Config, aligner *Aligner, svs *sv.Store, cis *interval.Store, ref genome.Genome, refs map[string]*sam.Reference, rec *sam.Record) ([]*sam.Record, *sv.RecordError) {
+	ciIndex, err := bamio.TagValue(rec, bamio.SVTag)
+	if err != nil {
+		return nil, sv.ReadError("clustered reads", rec, -1, err)
+	}
+	if !cis.Valid(ciIndex) {
+		return nil, sv.ReadError("clustered reads", rec, -1, fmt.Errorf("no CI %d", ciIndex))
+	}
+	currentCI := cis.Get(ciIndex)
+	currentSV := svs.Get(currentCI.SVID)
+
+	read := string(rec.Seq.Expand())
+
+	var best Result
+	var bestSplit Split
+	found := false
+	// score of the runner-up split, for the mapping quality
+	second, hasSecond := 0, false
+	for _, split := range Splits(cis, currentCI, currentSV, cfg.SegmentSize) {
+		l, r := split.WindowL, split.WindowR
+		chrL, chrR := ref.Chr(l.Chr).Content, ref.Chr(r.Chr).Content
+		if l.Head < 0 || l.Tail >= len(chrL) {
+			return nil, sv.ReadError("clustered reads", rec, ciIndex, fmt.Errorf("CI outside chromosome %s", l.Chr))
+		}
+		if r.Head < 0 || r.Tail >= len(chrR) {
+			return nil, sv.ReadError("clustered reads", rec, ciIndex, fmt.Errorf("CI outside chromosome %s", r.Chr))
+		}
+		refL := chrL[l.Head : l.Tail+1]
+		refR := chrR[r.Head : r.Tail+1]
+
+		result, err := aligner.Align(refL, refR, read, rec.Qual, split.Junction)
+		if err != nil {
+			return nil, sv.ReadError("clustered reads", rec, ciIndex, err)
+		}
+		if !Accepted(result, cfg.Scoring.MinIdentity) || !split.Ordered(result) {
+			continue
+		}
+		if !found || result.Score > best.Score {
+			if found {
+				second, hasSecond = best.Score, true
+			}
+			best, bestSplit, found = result, split, true
+		} else if !hasSecond || result.Score > second {
+			second, hasSecond = result.Score, true
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+
+	refL, ok := refs[bestSplit.WindowL.Chr]
+	if !ok {
+		return nil, sv.ReadError("clustered reads", rec, ciIndex, fmt.Errorf("chromosome %s not in the bam header", bestSplit.WindowL.Chr))
+	}
+	refR, ok := refs[bestSplit.WindowR.Chr]
+	if !ok {
+		return nil, sv.ReadError("clustered reads", rec, ciIndex, fmt.Errorf("chromosome %s not in the bam header", bestSplit.WindowR.Chr))
+	}
+	// the aligner places the breakpoints 0-based in the windows, the tags
+	// hold them 1-based on the chromosome
+	auxL, err := sam.NewAux(bamio.BreakpointTag(bestSplit.SideL), bestSplit.WindowL.Head+best.LBP+1)
+	if err != nil {
+		return nil, sv.ReadError("clustered reads", rec, ciIndex, err)
+	}
+	auxR, err := sam.NewAux(bamio.BreakpointTag(bestSplit.SideR), bestSplit.WindowR.Head+best.RBP+1)
+	if err != nil {
+		return nil, sv.ReadError("clustered reads", rec, ciIndex, err)
+	}
+	records, err := splitRecords(rec, refL, refR, bestSplit, best, splitMapQ(best.Score, second, hasSecond), cfg.DeletionOp, []sam.Aux{auxL, auxR})
+	if err != nil {
+		return nil, sv.ReadError("clustered reads", rec, ciIndex, err)
+	}
+	return records, nil
+}
+
+func IsValidSplit(cigar []sam.CigarOp) bool {
+	max := 0
+	index := 0
+	// find main del
+	for i := 0; i < len(cigar); i++ {
+		if cigar[i].Type() == sam.CigarDeletion && max < cigar[i].Len() {
+			max = cigar[i].Len()
+			index = i
+		}
+	}
+	mlen := 0
+	// check left
+	for i := 0; i < index; i++ {
+		if cigar[i].Type() == sam.CigarMatch {
+			mlen += cigar[i].Len()
+		}
+	}
+	if mlen < 5 {
+		return false
+	}
+	mlen2 := 0
+	// check right
+	for i := index + 1; i < len(cigar); i++ {
+		if cigar[i].Type() == sam.CigarMatch {
+			mlen2 += cigar[i].Len()
+		}
+	}
+	if mlen2 < 5 {
+		return false
+	}
+	return true
+}
+
+// Accepted reports whether both parts of a split alignment, or its only
+// part, reach minIdentity
+func Accepted(result Result, minIdentity float64) bool {
+	return (result.IdentityL >= minIdentity && result.IdentityR >= minIdentity) || (result.IdentityL == -1 && result.IdentityR >= minIdentity) || (result.IdentityL >= minIdentity && result.IdentityR == -1)
+}
@@ -0,0 +1,111 @@
+package aligner
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/balanur/brosv-go/assembly"
+	"github.com/balanur/brosv-go/bamio"
+	"github.com/balanur/brosv-go/genome"
+	"github.com/balanur/brosv-go/interval"
+	"github.com/balanur/brosv-go/sv"
+	"github.com/biogo/hts/sam"
+)
+
+// quality given to every contig base
+const contigQual = 30
+
+// AlignContigs split-aligns the contigs of each CI against the reference
+// around it, as AlignClusters does reads, with the CIs shared out among
+// cfg.Threads workers. Accepted contigs are written to outfilePath.bam,
+// sorted by coordinate and indexed, under the references of header; a
+// contig is named after its CI and rank.
+func AlignContigs(cfg Config, contigs map[int][]assembly.Contig, header *sam.Header, outfilePath string, svs *sv.Store, cis *interval.Store) error {
+	ref, err := genome.Read(cfg.RefFile)
+	if err != nil {
+		return err
+	}
+	refs := make(map[string]*sam.Reference)
+	for _, r := range header.Refs() {
+		refs[r.Name()] = r
+	}
+
+	ciIndices := make([]int, 0, len(contigs))
+	for ciIndex := range contigs {
+		ciIndices = append(ciIndices, ciIndex)
+	}
+	sort.Ints(ciIndices)
+
+	var alignments []*sam.Record
+	var resultLock sync.Mutex
+	var failed sv.FirstError
+	var wg sync.WaitGroup
+	jobs := make(chan int)
+	threads := cfg.Threads
+	if threads < 1 {
+		threads = 1
+	}
+	wg.Add(threads)
+	for i := 0; i < threads; i++ {
+		go func() {
+			defer wg.Done()
+			aligner := NewAligner(cfg.MaxWindow, cfg.Scoring)
+			for ciIndex := range jobs {
+				for rank, contig := range contigs[ciIndex] {
+					rec, err := contigRecord(ciIndex, rank, contig)
+					if err != nil {
+						failed.Set(err)
+						break
+					}
+					aligned, recErr := alignSingleRead(cfg, aligner, svs, cis, ref, refs, rec)
+					if recErr != nil {
+						if err := cfg.Policy.Malformed(recErr); err != nil {
+							failed.Set(err)
+						}
+						continue
+					}
+					if len(aligned) > 0 {
+						resultLock.Lock()
+						alignments = append(alignments, aligned...)
+						resultLock.Unlock()
+					}
+				}
+			}
+		}()
+	}
+	for _, ciIndex := range ciIndices {
+		if failed.Get() != nil {
+			break
+		}
+		jobs <- ciIndex
+	}
+	close(jobs)
+	wg.Wait()
+	if err := failed.Get(); err != nil {
+		return err
+	}
+
+	sv.Progress(cfg.Log, "Aligned %d contig records of %d CIs", len(alignments), len(ciIndices))
+	return bamio.WriteSorted(outfilePath+".bam", header, alignments)
+}
+
+// contigRecord is an unmapped record of a contig tagged with its CI, as
+// alignSingleRead takes clustered reads
+func contigRecord(ciIndex int, rank int, contig assembly.Contig) (*sam.Record, error) {
+	aux, err := sam.NewAux(bamio.SVTag, ciIndex)
+	if err != nil {
+		return nil, err
+	}
+	qual := make([]byte, len(contig.Seq))
+	for i := range qual {
+		qual[i] = contigQual
+	}
+	name := fmt.Sprintf("contig_%d_%d", ciIndex, rank)
+	rec, err := sam.NewRecord(name, nil, nil, -1, -1, 0, 0, nil, []byte(contig.Seq), qual, []sam.Aux{aux})
+	if err != nil {
+		return nil, err
+	}
+	rec.Flags = sam.Unmapped
+	return rec, nil
+}
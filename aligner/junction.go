@@ -0,0 +1,132 @@
+package aligner
+
+import (
+	"strings"
+
+	"github.com/balanur/brosv-go/interval"
+	"github.com/balanur/brosv-go/sv"
+)
+
+// Split is one way a read of a CI may cross its SV: the CI sides whose
+// reference windows take the left and right part of the read, the windows
+// themselves and the strand of each part
+type Split struct {
+	Junction
+	SideL, SideR     interval.Side
+	WindowL, WindowR interval.Interval
+	// the breakpoints may come in either order
+	AnyOrder bool
+}
+
+// Splits models the junction reads of currentCI by SV type. Deletions join
+// the left window to the right one on the forward strand. Across an
+// inversion the part inside the inverted segment is reverse complemented:
+// the right part at the left breakpoint, the left part at the right one,
+// with the windows swapped for reads stored on the other strand.
+// Tandem duplications join the end of the copy to its start, so the read
+// runs from the right window into the left one. Interspersed duplications
+// join the copy locus to the left window and the right window to the copy
+// locus; reads of the copy CI may cross either junction. A BND joins its
+// breakends as their strands say, a '+-' pair like a deletion and a '++'
+// or '--' pair like an inversion; the windows may be on different
+// chromosomes. Types without a model, insertions among them, have no
+// splits.
+func Splits(cis *interval.Store, currentCI interval.Interval, call sv.SV, segmentSize int) []Split {
+	window := func(side interval.Side) (interval.Interval, bool) {
+		if side == currentCI.Side {
+			return currentCI, true
+		}
+		id, ok := cis.Side(currentCI.SVID, side)
+		if !ok {
+			return interval.Interval{}, false
+		}
+		return cis.Get(id), true
+	}
+	split := func(sideL interval.Side, sideR interval.Side, junction Junction) []Split {
+		l, okL := window(sideL)
+		r, okR := window(sideR)
+		if !okL || !okR {
+			return nil
+		}
+		return []Split{{Junction: junction, SideL: sideL, SideR: sideR, WindowL: l, WindowR: r}}
+	}
+
+	svtype := strings.ToUpper(call.Type)
+	switch {
+	case svtype == "BND":
+		var splits []Split
+		switch call.Strands {
+		case "-+":
+			splits = split(interval.Right, interval.Left, Junction{})
+		case "++":
+			splits = append(split(interval.Left, interval.Right, Junction{InvertedR: true}),
+				split(interval.Right, interval.Left, Junction{InvertedR: true})...)
+		case "--":
+			splits = append(split(interval.Right, interval.Left, Junction{InvertedL: true}),
+				split(interval.Left, interval.Right, Junction{InvertedL: true})...)
+		default:
+			splits = split(interval.Left, interval.Right, Junction{})
+		}
+		for i := range splits {
+			splits[i].AnyOrder = true
+		}
+		return splits
+	case svtype == "DEL":
+		return split(interval.Left, interval.Right, Junction{})
+	case svtype == "INV":
+		// a read stored on the other strand runs from the right window into
+		// the left one, the inverted part still last
+		var splits []Split
+		if currentCI.Side == interval.Left {
+			splits = append(split(interval.Left, interval.Right, Junction{InvertedR: true}),
+				split(interval.Right, interval.Left, Junction{InvertedR: true})...)
+		} else {
+			splits = append(split(interval.Left, interval.Right, Junction{InvertedL: true}),
+				split(interval.Right, interval.Left, Junction{InvertedL: true})...)
+		}
+		// widen the window inside the inversion, away from the breakpoint
+		for i := range splits {
+			window := &splits[i].WindowR
+			if splits[i].SideL != currentCI.Side {
+				window = &splits[i].WindowL
+			}
+			if currentCI.Side == interval.Left {
+				window.Head -= segmentSize
+			} else {
+				window.Tail += segmentSize
+			}
+		}
+		return splits
+	case strings.HasPrefix(svtype, "DUP"):
+		if _, ok := cis.Side(currentCI.SVID, interval.Copy); !ok {
+			return split(interval.Right, interval.Left, Junction{})
+		}
+		switch currentCI.Side {
+		case interval.Left:
+			return split(interval.Copy, interval.Left, Junction{})
+		case interval.Right:
+			return split(interval.Right, interval.Copy, Junction{})
+		}
+		return append(split(interval.Copy, interval.Left, Junction{}), split(interval.Right, interval.Copy, Junction{})...)
+	}
+	return nil
+}
+
+// Ordered reports whether the breakpoints of a split are in the order of
+// the SV: a left breakpoint before the right one. Breakpoints at the copy
+// locus of an interspersed duplication may fall anywhere, as may the
+// breakends of a BND, and a read that was not split has only one.
+func (s Split) Ordered(result Result) bool {
+	if s.AnyOrder || result.IdentityL == -1 || result.IdentityR == -1 {
+		return true
+	}
+	bpL := s.WindowL.Head + result.LBP
+	bpR := s.WindowR.Head + result.RBP
+	switch {
+	case s.SideL == interval.Left && s.SideR == interval.Right:
+		return bpL < bpR
+	case s.SideL == interval.Right && s.SideR == interval.Left:
+		return bpR < bpL
+	}
+	return true
+}
@@ -0,0 +1,215 @@
+package aligner
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/balanur/brosv-go/genome"
+	"github.com/balanur/brosv-go/interval"
+	"github.com/balanur/brosv-go/sv"
+)
+
+func randomSeq(r *rand.Rand, n int) string {
+	seq := make([]byte, n)
+	for i := range seq {
+		seq[i] = "ACGT"[r.Intn(4)]
+	}
+	return string(seq)
+}
+
+func reverseComplement(seq string) string {
+	return genome.Reverse(genome.Complement(seq))
+}
+
+// homopolymer writes base over the 4 bp either side of pos
+func homopolymer(seq string, pos int, base byte) string {
+	return seq[:pos-4] + strings.Repeat(string(base), 8) + seq[pos+4:]
+}
+
+// ci is a CI of 100 bp either side of a breakpoint
+func ci(id string, side interval.Side, chr string, pos int) interval.Interval {
+	return interval.Interval{Chr: chr, Head: pos - 100, Tail: pos + 100, SVID: id, Side: side}
+}
+
+// bestSplit aligns read against every split of its CI as alignSingleRead
+// does and returns the best accepted one with its breakpoints on the
+// chromosomes
+func bestSplit(t *testing.T, chrs map[string]string, cis *interval.Store, ciIndex int, call sv.SV, read string) (Split, int, int, bool) {
+	aligner := NewAligner(0, Illumina())
+	var best Result
+	var bestSplit Split
+	found := false
+	for _, split := range Splits(cis, cis.Get(ciIndex), call, 100) {
+		l, r := split.WindowL, split.WindowR
+		result, err := aligner.Align(chrs[l.Chr][l.Head:l.Tail+1], chrs[r.Chr][r.Head:r.Tail+1], read, nil, split.Junction)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !Accepted(result, aligner.Scoring.MinIdentity) || !split.Ordered(result) {
+			continue
+		}
+		if !found || result.Score > best.Score {
+			best, bestSplit, found = result, split, true
+		}
+	}
+	return bestSplit, bestSplit.WindowL.Head + best.LBP, bestSplit.WindowR.Head + best.RBP, found
+}
+
+func TestSplits(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	chr1, chr2 := randomSeq(r, 5000), randomSeq(r, 5000)
+	// no two breakpoints share the bases around them, on either strand, so
+	// no junction has microhomology that would leave its breakpoints
+	// ambiguous
+	chr1 = homopolymer(homopolymer(homopolymer(chr1, 1000, 'A'), 2000, 'C'), 3500, 'T')
+	chr2 = homopolymer(chr2, 3000, 'G')
+	chrs := map[string]string{"chr1": chr1, "chr2": chr2}
+	inverted := Junction{InvertedL: true}
+	invertedR := Junction{InvertedR: true}
+
+	tests := []struct {
+		name string
+		call sv.SV
+		cis  []interval.Interval
+		// the CI the read was clustered to, an index into cis
+		from int
+		read string
+		// sides of the windows the parts align to, their strands and the
+		// last base before the junction in each, 0-based
+		sideL, sideR interval.Side
+		junction     Junction
+		bpL, bpR     int
+	}{
+		{
+			name:  "deletion",
+			call:  sv.SV{ID: "del", Type: "DEL"},
+			cis:   []interval.Interval{ci("del", interval.Left, "chr1", 1000), ci("del", interval.Right, "chr1", 2000)},
+			read:  chr1[941:1001] + chr1[2001:2091],
+			sideL: interval.Left, sideR: interval.Right,
+			bpL: 1000, bpR: 2000,
+		},
+		{
+			name:  "inversion, left breakpoint",
+			call:  sv.SV{ID: "inv", Type: "INV"},
+			cis:   []interval.Interval{ci("inv", interval.Left, "chr1", 1000), ci("inv", interval.Right, "chr1", 2000)},
+			read:  chr1[940:1000] + reverseComplement(chr1[1911:2001]),
+			sideL: interval.Left, sideR: interval.Right, junction: invertedR,
+			bpL: 999, bpR: 2000,
+		},
+		{
+			name:  "inversion, left breakpoint, other strand",
+			call:  sv.SV{ID: "inv", Type: "INV"},
+			cis:   []interval.Interval{ci("inv", interval.Left, "chr1", 1000), ci("inv", interval.Right, "chr1", 2000)},
+			read:  reverseComplement(chr1[940:1000] + reverseComplement(chr1[1911:2001])),
+			sideL: interval.Right, sideR: interval.Left, junction: invertedR,
+			bpL: 2000, bpR: 999,
+		},
+		{
+			name:  "inversion, right breakpoint",
+			call:  sv.SV{ID: "inv", Type: "INV"},
+			cis:   []interval.Interval{ci("inv", interval.Left, "chr1", 1000), ci("inv", interval.Right, "chr1", 2000)},
+			from:  1,
+			read:  reverseComplement(chr1[1000:1060]) + chr1[2001:2091],
+			sideL: interval.Left, sideR: interval.Right, junction: inverted,
+			bpL: 999, bpR: 2000,
+		},
+		{
+			name:  "tandem duplication",
+			call:  sv.SV{ID: "dup", Type: "DUP:TANDEM"},
+			cis:   []interval.Interval{ci("dup", interval.Left, "chr1", 1000), ci("dup", interval.Right, "chr1", 2000)},
+			read:  chr1[1941:2001] + chr1[1000:1090],
+			sideL: interval.Right, sideR: interval.Left,
+			bpL: 2000, bpR: 999,
+		},
+		{
+			name: "interspersed duplication, left breakpoint",
+			call: sv.SV{ID: "dup", Type: "DUP", CopyPos: 3500},
+			cis: []interval.Interval{ci("dup", interval.Left, "chr1", 1000), ci("dup", interval.Right, "chr1", 2000),
+				ci("dup", interval.Copy, "chr1", 3500)},
+			read:  chr1[3441:3501] + chr1[1000:1090],
+			sideL: interval.Copy, sideR: interval.Left,
+			bpL: 3500, bpR: 999,
+		},
+		{
+			name: "interspersed duplication, right breakpoint",
+			call: sv.SV{ID: "dup", Type: "DUP", CopyPos: 3500},
+			cis: []interval.Interval{ci("dup", interval.Left, "chr1", 1000), ci("dup", interval.Right, "chr1", 2000),
+				ci("dup", interval.Copy, "chr1", 3500)},
+			from:  1,
+			read:  chr1[1941:2001] + chr1[3501:3591],
+			sideL: interval.Right, sideR: interval.Copy,
+			bpL: 2000, bpR: 3500,
+		},
+		{
+			name: "interspersed duplication, copy locus",
+			call: sv.SV{ID: "dup", Type: "DUP", CopyPos: 3500},
+			cis: []interval.Interval{ci("dup", interval.Left, "chr1", 1000), ci("dup", interval.Right, "chr1", 2000),
+				ci("dup", interval.Copy, "chr1", 3500)},
+			from:  2,
+			read:  chr1[1951:2001] + chr1[3501:3601],
+			sideL: interval.Right, sideR: interval.Copy,
+			bpL: 2000, bpR: 3500,
+		},
+		{
+			name:  "BND +-",
+			call:  sv.SV{ID: "bnd", Type: "BND", Chromosome2: "chr2", Strands: "+-"},
+			cis:   []interval.Interval{ci("bnd", interval.Left, "chr1", 1000), ci("bnd", interval.Right, "chr2", 3000)},
+			read:  chr1[941:1001] + chr2[3000:3090],
+			sideL: interval.Left, sideR: interval.Right,
+			bpL: 1000, bpR: 2999,
+		},
+		{
+			name:  "BND -+",
+			call:  sv.SV{ID: "bnd", Type: "BND", Chromosome2: "chr2", Strands: "-+"},
+			cis:   []interval.Interval{ci("bnd", interval.Left, "chr1", 1000), ci("bnd", interval.Right, "chr2", 3000)},
+			read:  chr2[2941:3001] + chr1[1000:1090],
+			sideL: interval.Right, sideR: interval.Left,
+			bpL: 3000, bpR: 999,
+		},
+		{
+			name:  "BND ++",
+			call:  sv.SV{ID: "bnd", Type: "BND", Chromosome2: "chr2", Strands: "++"},
+			cis:   []interval.Interval{ci("bnd", interval.Left, "chr1", 1000), ci("bnd", interval.Right, "chr2", 3000)},
+			read:  chr1[941:1001] + reverseComplement(chr2[2911:3001]),
+			sideL: interval.Left, sideR: interval.Right, junction: invertedR,
+			bpL: 1000, bpR: 3000,
+		},
+		{
+			name:  "BND --",
+			call:  sv.SV{ID: "bnd", Type: "BND", Chromosome2: "chr2", Strands: "--"},
+			cis:   []interval.Interval{ci("bnd", interval.Left, "chr1", 1000), ci("bnd", interval.Right, "chr2", 3000)},
+			from:  1,
+			read:  reverseComplement(chr2[3000:3060]) + chr1[1000:1090],
+			sideL: interval.Right, sideR: interval.Left, junction: inverted,
+			bpL: 2999, bpR: 999,
+		},
+	}
+	for _, tt := range tests {
+		cis := interval.NewStore()
+		for _, c := range tt.cis {
+			cis.Add(c.Chr, c)
+		}
+		cis.BuildIndex()
+		split, bpL, bpR, ok := bestSplit(t, chrs, cis, tt.from, tt.call, tt.read)
+		if !ok {
+			t.Errorf("%s: no split accepted", tt.name)
+			continue
+		}
+		if split.SideL != tt.sideL || split.SideR != tt.sideR || split.Junction != tt.junction {
+			t.Errorf("%s: split %v to %v %+v, want %v to %v %+v", tt.name, split.SideL, split.SideR, split.Junction, tt.sideL, tt.sideR, tt.junction)
+		}
+		if bpL != tt.bpL || bpR != tt.bpR {
+			t.Errorf("%s: breakpoints %d and %d, want %d and %d", tt.name, bpL, bpR, tt.bpL, tt.bpR)
+		}
+	}
+}
+
+func TestSplitsUnmodelled(t *testing.T) {
+	cis := interval.NewStore()
+	cis.Add("chr1", ci("ins", interval.Left, "chr1", 1000))
+	cis.Add("chr1", ci("ins", interval.Right, "chr1", 1001))
+	if splits := Splits(cis, cis.Get(0), sv.SV{ID: "ins", Type: "INS"}, 100); len(splits) != 0 {
+		t.Errorf("insertion has %d splits, want none", len(splits))
+	}
+}
@@ -0,0 +1,201 @@
+package aligner
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/balanur/brosv-go/genome"
+	"github.com/balanur/brosv-go/interval"
+	"github.com/biogo/hts/sam"
+)
+
+var saTag = sam.NewTag("SA")
+
+// tags of rec that describe its old alignment, dropped from its split
+// records
+var alignmentTags = []sam.Tag{saTag, sam.NewTag("NM"), sam.NewTag("MD"), sam.NewTag("MC")}
+
+// part is one side of a split read as it is written to the alignment bam
+type part struct {
+	ref      *sam.Reference
+	pos      int
+	cigar    sam.Cigar
+	inverted bool
+	mapq     byte
+	nm       int
+}
+
+// newPart builds the part aligned at pos of ref with the alignment lines a, b and
+// c, in reference order. Bases of the read outside the part are soft
+// clipped: after the part for a left part, before it for a right part, the
+// other way round when the part is inverted.
+func newPart(ref *sam.Reference, pos int, a string, b string, c string, mapq byte, clipped int, left bool, inverted bool) part {
+	cigar, _ := ComputeCIGAR(a, b, c)
+	if clipped > 0 {
+		clip := sam.NewCigarOp(sam.CigarSoftClipped, clipped)
+		if left != inverted {
+			cigar = append(cigar, clip)
+		} else {
+			cigar = append(sam.Cigar{clip}, cigar...)
+		}
+	}
+	nm := 0
+	for i := range c {
+		if c[i] == ' ' {
+			nm++
+		}
+	}
+	return part{ref: ref, pos: pos, cigar: mergeClips(cigar), inverted: inverted, mapq: mapq, nm: nm}
+}
+
+// splitMapQ is the mapping quality of a read whose best split scores best
+// and whose runner-up, if any, second: 0 when another split explains the
+// read as well, up to 60 as the runner-up falls to no score at all
+func splitMapQ(best int, second int, hasSecond bool) byte {
+	if !hasSecond {
+		return 60
+	}
+	if best <= 0 {
+		return 0
+	}
+	if second < 0 {
+		second = 0
+	}
+	return byte(math.Max(0, math.Min(60, math.Round(60*float64(best-second)/float64(best)))))
+}
+
+// mergeClips joins neighbouring soft clips of a CIGAR
+func mergeClips(cigar sam.Cigar) sam.Cigar {
+	var result sam.Cigar
+	for _, op := range cigar {
+		n := len(result)
+		if n > 0 && op.Type() == sam.CigarSoftClipped && result[n-1].Type() == sam.CigarSoftClipped {
+			result[n-1] = sam.NewCigarOp(sam.CigarSoftClipped, result[n-1].Len()+op.Len())
+			continue
+		}
+		result = append(result, op)
+	}
+	return result
+}
+
+// strand of a part in an SA tag
+func (p part) strand(rec *sam.Record) string {
+	if (rec.Flags&sam.Reverse != 0) != p.inverted {
+		return "-"
+	}
+	return "+"
+}
+
+func (p part) sa(rec *sam.Record) string {
+	return fmt.Sprintf("%s,%d,%s,%s,%d,%d;", p.ref.Name(), p.pos+1, p.strand(rec), p.cigar, p.mapq, p.nm)
+}
+
+// record returns a copy of rec aligned as p, without the tags of its old
+// alignment. An inverted part is written on the other strand of rec, with
+// its sequence reverse complemented.
+func (p part) record(rec *sam.Record, aux []sam.Aux, extra ...sam.Aux) *sam.Record {
+	out := *rec
+	out.Ref = p.ref
+	out.Pos = p.pos
+	out.MapQ = p.mapq
+	out.Cigar = p.cigar
+	out.Flags &^= sam.Unmapped | sam.Secondary | sam.Supplementary
+	out.AuxFields = nil
+	for _, field := range rec.AuxFields {
+		if !isAlignmentTag(field.Tag()) {
+			out.AuxFields = append(out.AuxFields, field)
+		}
+	}
+	out.AuxFields = append(append(out.AuxFields, aux...), extra...)
+	if p.inverted {
+		out.Flags ^= sam.Reverse
+		out.Seq = sam.NewSeq([]byte(genome.Reverse(genome.Complement(string(rec.Seq.Expand())))))
+		out.Qual = make([]byte, len(rec.Qual))
+		for i, q := range rec.Qual {
+			out.Qual[len(rec.Qual)-1-i] = q
+		}
+	}
+	return &out
+}
+
+// splitRecords writes an accepted split of rec as a primary record for the
+// part holding more read bases and a supplementary record for the other,
+// linked by SA tags. With deletionOp set, a read split across a deletion
+// becomes one record spanning it with that operator instead. A read that
+// was not split gets a single record. refL and refR are the references of
+// the left and right windows, mapq the quality of the records.
+func splitRecords(rec *sam.Record, refL *sam.Reference, refR *sam.Reference, split Split, result Result, mapq byte, deletionOp byte, aux []sam.Aux) ([]*sam.Record, error) {
+	read := rec.Seq.Length
+	splitAt := len(strings.ReplaceAll(result.BL, "-", ""))
+	parts := make([]part, 0, 2)
+	if result.IdentityL != -1 {
+		parts = append(parts, newPart(refL, result.Pos+split.WindowL.Head, result.AL, result.BL, result.CL, mapq, read-splitAt, true, split.InvertedL))
+	}
+	if result.IdentityR != -1 {
+		parts = append(parts, newPart(refR, result.PosR+split.WindowR.Head, result.AR, result.BR, result.CR, mapq, splitAt, false, split.InvertedR))
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("empty split alignment")
+	}
+	if len(parts) == 1 {
+		return []*sam.Record{parts[0].record(rec, aux)}, nil
+	}
+
+	l, r := parts[0], parts[1]
+	if deletionOp != 0 && !split.AnyOrder && split.SideL == interval.Left && split.SideR == interval.Right && !split.InvertedL && !split.InvertedR {
+		refLen, _ := l.cigar.Lengths()
+		if gap := r.pos - (l.pos + refLen); gap > 0 {
+			op := sam.CigarDeletion
+			if deletionOp == 'N' {
+				op = sam.CigarSkipped
+			}
+			// the clips standing in for the other part give way to the gap
+			cigar := append(sam.Cigar(nil), trimClip(l.cigar, false)...)
+			cigar = append(cigar, sam.NewCigarOp(op, gap))
+			cigar = append(cigar, trimClip(r.cigar, true)...)
+			joined := part{ref: l.ref, pos: l.pos, cigar: cigar, mapq: mapq, nm: l.nm + r.nm}
+			return []*sam.Record{joined.record(rec, aux)}, nil
+		}
+	}
+
+	primary, supplementary := l, r
+	if read-splitAt > splitAt {
+		primary, supplementary = r, l
+	}
+	saFirst, err := sam.NewAux(saTag, supplementary.sa(rec))
+	if err != nil {
+		return nil, err
+	}
+	saSecond, err := sam.NewAux(saTag, primary.sa(rec))
+	if err != nil {
+		return nil, err
+	}
+	first := primary.record(rec, aux, saFirst)
+	second := supplementary.record(rec, aux, saSecond)
+	second.Flags |= sam.Supplementary
+	return []*sam.Record{first, second}, nil
+}
+
+// trimClip drops the soft clip at the start or end of a CIGAR
+func trimClip(cigar sam.Cigar, start bool) sam.Cigar {
+	if len(cigar) == 0 {
+		return cigar
+	}
+	if start && cigar[0].Type() == sam.CigarSoftClipped {
+		return cigar[1:]
+	}
+	if !start && cigar[len(cigar)-1].Type() == sam.CigarSoftClipped {
+		return cigar[:len(cigar)-1]
+	}
+	return cigar
+}
+
+func isAlignmentTag(tag sam.Tag) bool {
+	for _, t := range alignmentTags {
+		if tag == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package aligner
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/balanur/brosv-go/bamio"
+	"github.com/balanur/brosv-go/genome"
+	"github.com/balanur/brosv-go/interval"
+	"github.com/balanur/brosv-go/sv"
+	"github.com/biogo/hts/sam"
+)
+
+func TestSplitRecords(t *testing.T) {
+	r := rand.New(rand.NewSource(9))
+	chr1 := randomSeq(r, 3000)
+	ref, err := sam.NewReference("chr1", "", "", len(chr1), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// records only link to references of a header
+	if _, err := sam.NewHeader(nil, []*sam.Reference{ref}); err != nil {
+		t.Fatal(err)
+	}
+	split := Split{SideL: interval.Left, SideR: interval.Right,
+		WindowL: ci("del", interval.Left, "chr1", 1000), WindowR: ci("del", interval.Right, "chr1", 2000)}
+	read := chr1[941:1001] + chr1[2001:2091]
+	result, err := NewAligner(0, Illumina()).Align(chr1[900:1101], chr1[1900:2101], read, nil, split.Junction)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var aux []sam.Aux
+	for tag, value := range map[string]interface{}{"RG": "rg1", "SA": "chr2,100,+,150M,60,0;", "NM": 3, "MD": "150", "MC": "150M"} {
+		field, err := sam.NewAux(sam.NewTag(tag), value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		aux = append(aux, field)
+	}
+	rec, err := sam.NewRecord("read", ref, nil, 1500, -1, 0, 60, []sam.CigarOp{sam.NewCigarOp(sam.CigarMatch, len(read))}, []byte(read), nil, aux)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := splitRecords(rec, ref, ref, split, result, 60, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("%d records, want 2", len(records))
+	}
+	if records[0].Flags&sam.Supplementary != 0 || records[1].Flags&sam.Supplementary == 0 {
+		t.Errorf("flags %v and %v, want a primary then a supplementary record", records[0].Flags, records[1].Flags)
+	}
+	for i, out := range records {
+		counts := make(map[string]int)
+		for _, field := range out.AuxFields {
+			counts[field.Tag().String()]++
+		}
+		if counts["RG"] != 1 || counts["SA"] != 1 || counts["NM"] != 0 || counts["MD"] != 0 || counts["MC"] != 0 {
+			t.Errorf("record %d has tags %v, want RG and a new SA", i, counts)
+		}
+		sa, _ := out.AuxFields.Get(saTag).Value().(string)
+		if strings.HasPrefix(sa, "chr2") {
+			t.Errorf("record %d kept the old SA %q", i, sa)
+		}
+	}
+}
+
+func TestAlignSingleReadTagsBreakpoints(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	chr1 := homopolymer(homopolymer(randomSeq(r, 3000), 1000, 'A'), 2000, 'C')
+	refFile := filepath.Join(t.TempDir(), "ref.fa")
+	if err := os.WriteFile(refFile, []byte(">chr1\n"+chr1+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(refFile+".fai", []byte(fmt.Sprintf("chr1\t%d\t6\t%d\t%d\n", len(chr1), len(chr1), len(chr1)+1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ref, err := genome.Read(refFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chrRef, err := sam.NewReference("chr1", "", "", len(chr1), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sam.NewHeader(nil, []*sam.Reference{chrRef}); err != nil {
+		t.Fatal(err)
+	}
+
+	cis := interval.NewStore()
+	cis.Add("chr1", ci("del", interval.Left, "chr1", 1000))
+	cis.Add("chr1", ci("del", interval.Right, "chr1", 2000))
+	cis.BuildIndex()
+	svs := sv.NewStore()
+	svs.Add(sv.SV{ID: "del", Chromosome: "chr1", Start: 1001, End: 2001, Type: "DEL"})
+
+	// the read ends its left part at 0-based 1000 and resumes at 2001
+	read := chr1[941:1001] + chr1[2001:2091]
+	svAux, err := sam.NewAux(bamio.SVTag, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := sam.NewRecord("read", chrRef, nil, 941, -1, 0, 60, []sam.CigarOp{sam.NewCigarOp(sam.CigarMatch, len(read))}, []byte(read), nil, []sam.Aux{svAux})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{SegmentSize: 100, Scoring: Illumina()}
+	records, recErr := alignSingleRead(cfg, NewAligner(0, cfg.Scoring), svs, cis, ref, map[string]*sam.Reference{"chr1": chrRef}, rec)
+	if recErr != nil {
+		t.Fatal(recErr)
+	}
+	if len(records) == 0 {
+		t.Fatal("read not aligned")
+	}
+	// the tags hold the last base before the junction 1-based, as the
+	// breakpoint tags of extract do
+	for tag, want := range map[sam.Tag]int{bamio.LBPTag: 1001, bamio.RBPTag: 2001} {
+		got, err := bamio.TagValue(records[0], tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s = %d, want %d", tag, got, want)
+		}
+	}
+}
+
+func TestSplitMapQ(t *testing.T) {
+	tests := []struct {
+		best, second int
+		hasSecond    bool
+		want         byte
+	}{
+		{best: 100, want: 60},
+		{best: 100, second: 100, hasSecond: true, want: 0},
+		{best: 100, second: 50, hasSecond: true, want: 30},
+		{best: 100, second: -20, hasSecond: true, want: 60},
+		{best: 0, second: -5, hasSecond: true, want: 0},
+	}
+	for _, tt := range tests {
+		if got := splitMapQ(tt.best, tt.second, tt.hasSecond); got != tt.want {
+			t.Errorf("splitMapQ(%d, %d, %v) = %d, want %d", tt.best, tt.second, tt.hasSecond, got, tt.want)
+		}
+	}
+}
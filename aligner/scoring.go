@@ -0,0 +1,137 @@
+package aligner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Scoring is a scoring profile of the split aligner. A gap of length k
+// scores GapOpen + k*GapExtend. Ambiguous is the score of an IUPAC code
+// compatible with the base it is aligned to, N included.
+type Scoring struct {
+	Match     int
+	Mismatch  int
+	GapOpen   int
+	GapExtend int
+	Ambiguous int
+	// scale mismatch penalties down at read bases below QualityCap
+	QualityAware bool
+	// both parts of a split, or its only part, must reach MinIdentity
+	MinIdentity float64
+}
+
+// base qualities at or above QualityCap take the full mismatch penalty
+const QualityCap = 30
+
+// Illumina is the default profile, for short reads with few indels
+func Illumina() Scoring {
+	return Scoring{Match: 5, Mismatch: -4, GapOpen: -16, GapExtend: -1, Ambiguous: -1, MinIdentity: 0.95}
+}
+
+// LongRead is a profile for noisy long reads, with cheap gaps
+func LongRead() Scoring {
+	return Scoring{Match: 2, Mismatch: -4, GapOpen: -4, GapExtend: -2, Ambiguous: -1, MinIdentity: 0.85}
+}
+
+var scoringByName = map[string]func() Scoring{
+	"illumina": Illumina,
+	"longread": LongRead,
+}
+
+func ScoringNames() []string {
+	return []string{"illumina", "longread"}
+}
+
+// ParseScoring returns the preset called name, or a custom profile given as
+// match,mismatch,gapopen,gapextend. A custom profile keeps the ambiguity
+// score and identity threshold of the illumina preset.
+func ParseScoring(name string) (Scoring, error) {
+	if preset, ok := scoringByName[strings.ToLower(name)]; ok {
+		return preset(), nil
+	}
+	fields := strings.Split(name, ",")
+	if len(fields) != 4 {
+		return Scoring{}, fmt.Errorf("unknown scoring %q (valid: %s, or match,mismatch,gapopen,gapextend)", name, strings.Join(ScoringNames(), ", "))
+	}
+	var scores [4]int
+	for i, field := range fields {
+		score, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return Scoring{}, fmt.Errorf("custom scoring %q: %w", name, err)
+		}
+		scores[i] = score
+	}
+	s := Illumina()
+	s.Match, s.Mismatch, s.GapOpen, s.GapExtend = scores[0], scores[1], scores[2], scores[3]
+	return s, s.Validate()
+}
+
+// Validate checks that matches score positive and the rest do not
+func (s Scoring) Validate() error {
+	if s.Match <= 0 {
+		return fmt.Errorf("match score %d is not positive", s.Match)
+	}
+	if s.Mismatch >= 0 || s.GapOpen > 0 || s.GapExtend >= 0 || s.Ambiguous > 0 {
+		return fmt.Errorf("mismatch %d, gap opening %d, gap extension %d and ambiguity %d scores must not be positive, mismatch and gap extension below zero", s.Mismatch, s.GapOpen, s.GapExtend, s.Ambiguous)
+	}
+	if s.MinIdentity <= 0 || s.MinIdentity > 1 {
+		return fmt.Errorf("minimum identity %g is outside (0, 1]", s.MinIdentity)
+	}
+	return nil
+}
+
+func (s Scoring) String() string {
+	return fmt.Sprintf("match=%d,mismatch=%d,gapopen=%d,gapextend=%d,ambiguous=%d,qual=%t,identity=%g",
+		s.Match, s.Mismatch, s.GapOpen, s.GapExtend, s.Ambiguous, s.QualityAware, s.MinIdentity)
+}
+
+// IUPAC codes as sets of A=1, C=2, G=4, T=8; other bytes are 0
+var baseMask [256]uint8
+
+func init() {
+	for code, mask := range map[byte]uint8{
+		'A': 1, 'C': 2, 'G': 4, 'T': 8, 'U': 8,
+		'R': 1 | 4, 'Y': 2 | 8, 'S': 2 | 4, 'W': 1 | 8, 'K': 4 | 8, 'M': 1 | 2,
+		'B': 2 | 4 | 8, 'D': 1 | 4 | 8, 'H': 1 | 2 | 8, 'V': 1 | 2 | 4,
+		'N': 15,
+	} {
+		baseMask[code] = mask
+		baseMask[code+'a'-'A'] = mask
+	}
+}
+
+// substitution scores ref base r against read base q, given the mismatch
+// penalty of the read base. Case is ignored, so soft-masked reference
+// matches too.
+func (s Scoring) substitution(r byte, q byte, mismatch int) int {
+	mr, mq := baseMask[r], baseMask[q]
+	if mr&mq == 0 {
+		return mismatch
+	}
+	if mr == mq && mr&(mr-1) == 0 {
+		return s.Match
+	}
+	return s.Ambiguous
+}
+
+// mismatchPenalties fills buf with the mismatch penalty of every read base.
+// Without qualities, or with the 0xff of a record that has none, every base
+// takes the full penalty.
+func (s Scoring) mismatchPenalties(qual []byte, n int, buf []int) []int {
+	if cap(buf) < n {
+		buf = make([]int, n)
+	}
+	buf = buf[:n]
+	useQual := s.QualityAware && len(qual) == n && (n == 0 || qual[0] != 0xff)
+	for j := range buf {
+		buf[j] = s.Mismatch
+		if useQual && int(qual[j]) < QualityCap {
+			buf[j] = s.Mismatch * int(qual[j]) / QualityCap
+			if buf[j] > -1 {
+				buf[j] = -1
+			}
+		}
+	}
+	return buf
+}
@@ -0,0 +1,116 @@
+package aligner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/balanur/brosv-go/bamio"
+	"github.com/balanur/brosv-go/interval"
+	"github.com/balanur/brosv-go/sv"
+	"github.com/biogo/hts/sam"
+)
+
+// optionalTag returns the value of tag on rec, or -1 if rec has no tag
+func optionalTag(rec *sam.Record, tag sam.Tag) (int, error) {
+	if rec.AuxFields.Get(tag) == nil {
+		return -1, nil
+	}
+	return bamio.TagValue(rec, tag)
+}
+
+// WriteSupported summarizes the split alignments of bamFilePath into
+// outfile: the SVs with accepted reads, their CIs and the breakpoints of
+// every read
+func WriteSupported(cfg Config, bamFilePath string, outfile string, ciStore *interval.Store, svStore *sv.Store) error {
+	bamReader, err := bamio.Open(bamFilePath, "", cfg.Threads)
+	if err != nil {
+		return err
+	}
+	defer bamReader.Close()
+
+	g, err := os.Create(outfile)
+	if err != nil {
+		return &sv.FileError{Op: "create", File: outfile, Err: err}
+	}
+	defer g.Close()
+
+	writer := bufio.NewWriter(g)
+
+	supportedSVs := make(map[string]int)
+	lbp := make(map[string][]int)
+	rbp := make(map[string][]int)
+	count := 0
+	for {
+		rec, err := bamReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return &sv.FileError{Op: "read", File: bamFilePath, Err: err}
+		}
+		// the primary record of a split read stands for both parts
+		if rec.Flags&sam.Supplementary != 0 {
+			continue
+		}
+
+		ciIndex, err := bamio.TagValue(rec, bamio.SVTag)
+		if err == nil && !ciStore.Valid(ciIndex) {
+			err = fmt.Errorf("no CI %d", ciIndex)
+		}
+		// a read across the copy locus of an interspersed duplication
+		// has only one of them, the other is -1
+		left, right := -1, -1
+		if err == nil {
+			left, err = optionalTag(rec, bamio.LBPTag)
+		}
+		if err == nil {
+			right, err = optionalTag(rec, bamio.RBPTag)
+		}
+		if err != nil {
+			if err := cfg.Policy.Malformed(sv.ReadError(bamFilePath, rec, -1, err)); err != nil {
+				return err
+			}
+			continue
+		}
+		currentCI := ciStore.Get(ciIndex)
+
+		if _, exist := supportedSVs[currentCI.SVID]; exist {
+			supportedSVs[currentCI.SVID]++
+		} else {
+			supportedSVs[currentCI.SVID] = 1
+			count++
+		}
+		lbp[currentCI.SVID] = append(lbp[currentCI.SVID], left)
+		rbp[currentCI.SVID] = append(rbp[currentCI.SVID], right)
+	}
+
+	writer.WriteString("Number of supported SVs: " + strconv.Itoa(count) + "\n")
+	sv.Progress(cfg.Log, "Number of supported SVs: %d", count)
+	for k, v := range supportedSVs {
+		lid, okL := ciStore.Side(k, interval.Left)
+		rid, okR := ciStore.Side(k, interval.Right)
+		if !okL || !okR {
+			bad := &sv.RecordError{File: bamFilePath, Record: k, CI: -1, Err: fmt.Errorf("SV %s has no CI on one of its sides", k)}
+			if err := cfg.Policy.Malformed(bad); err != nil {
+				return err
+			}
+			continue
+		}
+		writer.WriteString("SVID: " + k + " Chromosome: " + svStore.Get(k).Chromosome + " numofReads: " + strconv.Itoa(v) + "\n")
+		left := ciStore.Get(lid)
+		right := ciStore.Get(rid)
+		writer.WriteString("Left: " + strconv.Itoa(left.Head) + ", " + strconv.Itoa(left.Tail))
+		writer.WriteString(" Right: " + strconv.Itoa(right.Head) + ", " + strconv.Itoa(right.Tail) + "\n\n")
+		for i := range lbp[k] {
+			writer.WriteString(strconv.Itoa(lbp[k][i]) + "\t" + strconv.Itoa(rbp[k][i]) + "\n")
+		}
+		writer.WriteString("\n\n")
+	}
+	if err := writer.Flush(); err != nil {
+		return &sv.FileError{Op: "write", File: outfile, Err: err}
+	}
+	return nil
+}
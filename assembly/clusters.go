@@ -0,0 +1,99 @@
+package assembly
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/balanur/brosv-go/bamio"
+	"github.com/balanur/brosv-go/genome"
+	"github.com/balanur/brosv-go/interval"
+	"github.com/balanur/brosv-go/sv"
+	"github.com/biogo/hts/sam"
+)
+
+// AssembleClusters assembles the reads of every CI of clusterBamPath in
+// memory, the CIs shared out among cfg.Threads workers, and returns the
+// contigs of each CI with any
+func AssembleClusters(cfg Config, clusterBamPath string, cis *interval.Store) (map[int][]Contig, error) {
+	bamReader, err := bamio.Open(clusterBamPath, cfg.RefFile, cfg.Threads)
+	if err != nil {
+		return nil, err
+	}
+	defer bamReader.Close()
+
+	reads := make(map[int][]string)
+	for {
+		rec, err := bamReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, &sv.FileError{Op: "read", File: clusterBamPath, Err: err}
+		}
+		ciIndex, err := bamio.TagValue(rec, bamio.SVTag)
+		if err == nil && !cis.Valid(ciIndex) {
+			err = fmt.Errorf("no CI %d", ciIndex)
+		}
+		if err != nil {
+			if err := cfg.Policy.Malformed(sv.ReadError(clusterBamPath, rec, -1, err)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		// the primary record carries the whole read
+		if rec.Flags&(sam.Secondary|sam.Supplementary) != 0 {
+			continue
+		}
+		reads[ciIndex] = append(reads[ciIndex], forwardSequence(rec))
+	}
+
+	jobs := make(chan int)
+	result := make(map[int][]Contig)
+	var resultLock sync.Mutex
+	var wg sync.WaitGroup
+	threads := cfg.Threads
+	if threads < 1 {
+		threads = 1
+	}
+	wg.Add(threads)
+	for i := 0; i < threads; i++ {
+		go func() {
+			defer wg.Done()
+			for ciIndex := range jobs {
+				contigs := Assemble(cfg, reads[ciIndex])
+				if len(contigs) == 0 {
+					continue
+				}
+				resultLock.Lock()
+				result[ciIndex] = contigs
+				resultLock.Unlock()
+			}
+		}()
+	}
+	for ciIndex := range reads {
+		jobs <- ciIndex
+	}
+	close(jobs)
+	wg.Wait()
+
+	sv.Progress(cfg.Log, "Assembled %d of %d CIs with reads", len(result), len(reads))
+	return result, nil
+}
+
+// forwardSequence is the sequence of rec on the forward strand of the
+// reference. Mapped reads are stored that way; an unmapped read of a pair
+// lies on the strand opposite its mate, its stored sequence reversed if
+// flagged so.
+func forwardSequence(rec *sam.Record) string {
+	seq := string(rec.Seq.Expand())
+	if rec.Flags&sam.Unmapped == 0 || rec.Flags&sam.Paired == 0 || rec.Flags&sam.MateUnmapped != 0 {
+		return seq
+	}
+	stored := rec.Flags&sam.Reverse != 0
+	wanted := rec.Flags&sam.MateReverse == 0
+	if stored != wanted {
+		seq = genome.Reverse(genome.Complement(seq))
+	}
+	return seq
+}
@@ -0,0 +1,30 @@
+package assembly
+
+import (
+	"testing"
+
+	"github.com/biogo/hts/sam"
+)
+
+func TestForwardSequence(t *testing.T) {
+	tests := []struct {
+		flags sam.Flags
+		want  string
+	}{
+		{0, "AACG"},
+		{sam.Reverse, "AACG"},
+		// an unmapped read with a forward mate lies on the reverse strand
+		{sam.Paired | sam.Unmapped, "CGTT"},
+		{sam.Paired | sam.Unmapped | sam.Reverse, "AACG"},
+		{sam.Paired | sam.Unmapped | sam.MateReverse, "AACG"},
+		{sam.Paired | sam.Unmapped | sam.Reverse | sam.MateReverse, "CGTT"},
+		// with both unmapped there is no strand to take
+		{sam.Paired | sam.Unmapped | sam.MateUnmapped, "AACG"},
+	}
+	for _, tt := range tests {
+		rec := &sam.Record{Flags: tt.flags, Seq: sam.NewSeq([]byte("AACG"))}
+		if got := forwardSequence(rec); got != tt.want {
+			t.Errorf("flags %v: %s, want %s", tt.flags, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package assembly
+
+import (
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/balanur/brosv-go/genome"
+	"github.com/balanur/brosv-go/sv"
+)
+
+// Config controls the local assembly of the reads of each CI
+type Config struct {
+	RefFile string
+	Threads int
+	// k-mer length of the de Bruijn graph
+	K int
+	// k-mers seen fewer times are taken as sequencing errors
+	MinCoverage int
+	// shortest contig kept
+	MinLength int
+	Policy    *sv.Policy
+	// progress lines, nil for none
+	Log *log.Logger
+}
+
+// DefaultConfig keeps contigs of 100 bases or more
+func DefaultConfig() Config {
+	return Config{Threads: 1, K: 31, MinCoverage: 2, MinLength: 100, Policy: &sv.Policy{Strict: true}}
+}
+
+// Contig is an assembled sequence on the forward strand of the reference
+// with the mean count of its k-mers
+type Contig struct {
+	Seq      string
+	Coverage float64
+}
+
+// Assemble builds the de Bruijn graph of the k-mers of reads and walks it
+// greedily from the most covered k-mer not yet used, extending each end
+// with the most covered unused neighbour until none is left. Reads must be
+// on the forward strand of the reference; the graph is strand specific.
+func Assemble(cfg Config, reads []string) []Contig {
+	k := cfg.K
+	if k < 2 {
+		return nil
+	}
+	counts := make(map[string]int)
+	for _, read := range reads {
+		read = strings.ToUpper(read)
+		for i := 0; i+k <= len(read); i++ {
+			kmer := read[i : i+k]
+			if strings.Trim(kmer, "ACGT") != "" {
+				continue
+			}
+			counts[kmer]++
+		}
+	}
+	for kmer, n := range counts {
+		if n < cfg.MinCoverage {
+			delete(counts, kmer)
+		}
+	}
+
+	seeds := make([]string, 0, len(counts))
+	for kmer := range counts {
+		seeds = append(seeds, kmer)
+	}
+	sort.Slice(seeds, func(i, j int) bool {
+		if counts[seeds[i]] != counts[seeds[j]] {
+			return counts[seeds[i]] > counts[seeds[j]]
+		}
+		return seeds[i] < seeds[j]
+	})
+
+	used := make(map[string]bool)
+	var result []Contig
+	for _, seed := range seeds {
+		if used[seed] {
+			continue
+		}
+		used[seed] = true
+		total := counts[seed]
+		right, n := extend(counts, used, seed, true)
+		total += n
+		left, n := extend(counts, used, seed, false)
+		total += n
+		seq := genome.Reverse(left) + seed + right
+		if len(seq) < cfg.MinLength {
+			continue
+		}
+		kmers := len(seq) - k + 1
+		result = append(result, Contig{Seq: seq, Coverage: float64(total) / float64(kmers)})
+	}
+	return result
+}
+
+// extend walks from kmer to the right, or to the left, taking the most
+// covered unused neighbour at each step, and returns the bases added in
+// walking order with the summed count of their k-mers
+func extend(counts map[string]int, used map[string]bool, kmer string, right bool) (string, int) {
+	var added []byte
+	total := 0
+	for {
+		best, bestCount := "", 0
+		for _, base := range "ACGT" {
+			var next string
+			if right {
+				next = kmer[1:] + string(base)
+			} else {
+				next = string(base) + kmer[:len(kmer)-1]
+			}
+			if n := counts[next]; n > bestCount && !used[next] {
+				best, bestCount = next, n
+			}
+		}
+		if best == "" {
+			return string(added), total
+		}
+		used[best] = true
+		total += bestCount
+		if right {
+			added = append(added, best[len(best)-1])
+		} else {
+			added = append(added, best[0])
+		}
+		kmer = best
+	}
+}
@@ -0,0 +1,97 @@
+package assembly
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// randomSequence is n random bases; the sequences of these tests repeat
+// no k-mer, so the graph has a single path through them
+func randomSequence(seed int64, n int) string {
+	r := rand.New(rand.NewSource(seed))
+	seq := make([]byte, n)
+	for i := range seq {
+		seq[i] = "ACGT"[r.Intn(4)]
+	}
+	return string(seq)
+}
+
+// tile cuts reads of length n from seq every step bases, the last ending
+// at the end of seq
+func tile(seq string, n int, step int) []string {
+	var reads []string
+	for i := 0; i+n <= len(seq); i += step {
+		reads = append(reads, seq[i:i+n])
+	}
+	return reads
+}
+
+func testConfig() Config {
+	return Config{K: 21, MinCoverage: 2, MinLength: 100}
+}
+
+func TestAssembleTiledReads(t *testing.T) {
+	seq := randomSequence(1, 300)
+	// two passes over seq cover every k-mer at least twice
+	reads := append(tile(seq, 100, 10), tile(seq, 100, 10)...)
+
+	withError := []byte(reads[5])
+	withError[50] = map[byte]byte{'A': 'C', 'C': 'G', 'G': 'T', 'T': 'A'}[withError[50]]
+
+	tests := []struct {
+		name  string
+		reads []string
+	}{
+		{"exact", reads},
+		{"single base error", append(reads[:len(reads):len(reads)], string(withError))},
+	}
+	for _, tt := range tests {
+		contigs := Assemble(testConfig(), tt.reads)
+		if len(contigs) != 1 {
+			t.Errorf("%s: %d contigs, want 1", tt.name, len(contigs))
+			continue
+		}
+		if contigs[0].Seq != seq {
+			t.Errorf("%s: contig\n%s\nwant\n%s", tt.name, contigs[0].Seq, seq)
+		}
+		if contigs[0].Coverage < 2 {
+			t.Errorf("%s: coverage %.2f, want at least 2", tt.name, contigs[0].Coverage)
+		}
+	}
+}
+
+func TestAssembleDropsLowCoverage(t *testing.T) {
+	seq := randomSequence(2, 300)
+	// one pass leaves the first and last 10 k-mers in a single read
+	reads := tile(seq, 100, 10)
+
+	contigs := Assemble(testConfig(), reads)
+	if len(contigs) != 1 || contigs[0].Seq != seq[10:290] {
+		t.Errorf("contigs %+v, want the k-mers seen twice: %s", contigs, seq[10:290])
+	}
+
+	cfg := testConfig()
+	cfg.MinCoverage = 1
+	contigs = Assemble(cfg, reads)
+	if len(contigs) != 1 || contigs[0].Seq != seq {
+		t.Errorf("contigs %+v, want %s at coverage 1", contigs, seq)
+	}
+
+	if contigs := Assemble(testConfig(), []string{seq}); len(contigs) != 0 {
+		t.Errorf("%d contigs of a single read, want none", len(contigs))
+	}
+}
+
+func TestAssembleDropsShortContigs(t *testing.T) {
+	seq := randomSequence(3, 80)
+	reads := []string{seq, seq}
+
+	if contigs := Assemble(testConfig(), reads); len(contigs) != 0 {
+		t.Errorf("%d contigs of %d bases, want none under MinLength", len(contigs), len(seq))
+	}
+	cfg := testConfig()
+	cfg.MinLength = len(seq)
+	if contigs := Assemble(cfg, reads); len(contigs) != 1 || contigs[0].Seq != seq {
+		t.Errorf("contigs %+v, want %s at MinLength %d", contigs, seq, len(seq))
+	}
+}
@@ -0,0 +1,184 @@
+package bamio
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/biogo/hts/sam"
+)
+
+var nmTag = sam.NewTag("NM")
+
+// reasons a read is rejected for, in the order they are checked
+const (
+	rejectSecondary = iota
+	rejectDuplicate
+	rejectQCFail
+	rejectMapQ
+	rejectMismatch
+	numRejections
+)
+
+var rejectionNames = [numRejections]string{"secondary", "duplicate", "qcfail", "mapq", "mismatch"}
+
+// ReadFilter decides which reads count as evidence, in extraction,
+// insert size estimation and voting alike, and counts the reads it
+// rejects by reason. Every pass over the reads takes its own filter from
+// Pass, as a read rejected in one pass is seen again in the next.
+type ReadFilter struct {
+	MinMapQ int
+	// drop reads flagged as duplicates, failing QC or secondary
+	Duplicates bool
+	QCFail     bool
+	Secondary  bool
+	// shortest clip taken as a split
+	MinClip int
+	// largest NM per aligned read base, 0 for no limit
+	MaxMismatchRate float64
+
+	name     string
+	rejected [numRejections]int64
+	lock     sync.Mutex
+	passes   []*ReadFilter
+}
+
+// DefaultReadFilter drops multi-mapped, duplicate, QC failed and secondary reads
+func DefaultReadFilter() *ReadFilter {
+	return &ReadFilter{MinMapQ: 1, Duplicates: true, QCFail: true, Secondary: true, MinClip: 10}
+}
+
+// Pass returns a filter with the settings of f that counts the rejections
+// of one pass over the reads, reported by f under name
+func (f *ReadFilter) Pass(name string) *ReadFilter {
+	pass := &ReadFilter{MinMapQ: f.MinMapQ, Duplicates: f.Duplicates, QCFail: f.QCFail, Secondary: f.Secondary,
+		MinClip: f.MinClip, MaxMismatchRate: f.MaxMismatchRate, name: name}
+	f.lock.Lock()
+	f.passes = append(f.passes, pass)
+	f.lock.Unlock()
+	return pass
+}
+
+// Accept reports whether rec passes the filter, counting it under the
+// first reason it fails for otherwise
+func (f *ReadFilter) Accept(rec *sam.Record) bool {
+	reason := f.reject(rec)
+	if reason < 0 {
+		return true
+	}
+	atomic.AddInt64(&f.rejected[reason], 1)
+	return false
+}
+
+// Passes reports whether rec passes the filter without counting it, for
+// reads already seen by Accept
+func (f *ReadFilter) Passes(rec *sam.Record) bool {
+	return f.reject(rec) < 0
+}
+
+func (f *ReadFilter) reject(rec *sam.Record) int {
+	switch {
+	case f.Secondary && rec.Flags&sam.Secondary != 0:
+		return rejectSecondary
+	case f.Duplicates && rec.Flags&sam.Duplicate != 0:
+		return rejectDuplicate
+	case f.QCFail && rec.Flags&sam.QCFail != 0:
+		return rejectQCFail
+	case int(rec.MapQ) < f.MinMapQ:
+		return rejectMapQ
+	case f.MaxMismatchRate > 0 && mismatchRate(rec) > f.MaxMismatchRate:
+		return rejectMismatch
+	}
+	return -1
+}
+
+// mismatchRate is the NM of rec per aligned read base, 0 without an NM tag
+func mismatchRate(rec *sam.Record) float64 {
+	aux := rec.AuxFields.Get(nmTag)
+	if aux == nil {
+		return 0
+	}
+	var nm int
+	switch v := aux.Value().(type) {
+	case int8:
+		nm = int(v)
+	case uint8:
+		nm = int(v)
+	case int16:
+		nm = int(v)
+	case uint16:
+		nm = int(v)
+	case int32:
+		nm = int(v)
+	case uint32:
+		nm = int(v)
+	default:
+		return 0
+	}
+	aligned := 0
+	for _, op := range rec.Cigar {
+		switch op.Type() {
+		case sam.CigarMatch, sam.CigarEqual, sam.CigarMismatch, sam.CigarInsertion:
+			aligned += op.Len()
+		}
+	}
+	if aligned == 0 {
+		return 0
+	}
+	return float64(nm) / float64(aligned)
+}
+
+// Rejected returns the number of reads rejected so far, by reason
+func (f *ReadFilter) Rejected() map[string]int64 {
+	result := make(map[string]int64)
+	for reason, name := range rejectionNames {
+		if n := atomic.LoadInt64(&f.rejected[reason]); n > 0 {
+			result[name] = n
+		}
+	}
+	return result
+}
+
+// Report is the rejection counts of f and of each pass taken from it as
+// "reason=n" pairs, those of passes of the same name summed under it,
+// empty if none
+func (f *ReadFilter) Report() string {
+	var passes []string
+	byPass := map[string]map[string]int64{"": f.Rejected()}
+	f.lock.Lock()
+	for _, pass := range f.passes {
+		if byPass[pass.name] == nil {
+			passes = append(passes, pass.name)
+			byPass[pass.name] = make(map[string]int64)
+		}
+		for reason, n := range pass.Rejected() {
+			byPass[pass.name][reason] += n
+		}
+	}
+	f.lock.Unlock()
+
+	var reports []string
+	for _, name := range append([]string{""}, passes...) {
+		var parts []string
+		for _, reason := range rejectionNames {
+			if n, ok := byPass[name][reason]; ok {
+				parts = append(parts, fmt.Sprintf("%s=%d", reason, n))
+			}
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		if name != "" {
+			parts = append([]string{name + ":"}, parts...)
+		}
+		reports = append(reports, strings.Join(parts, " "))
+	}
+	return strings.Join(reports, "; ")
+}
+
+// String is the settings of the filter, as recorded in the workdir manifest
+func (f *ReadFilter) String() string {
+	return fmt.Sprintf("minMapQ=%d duplicates=%t qcFail=%t secondary=%t minClip=%d maxMismatchRate=%g",
+		f.MinMapQ, f.Duplicates, f.QCFail, f.Secondary, f.MinClip, f.MaxMismatchRate)
+}
@@ -0,0 +1,38 @@
+package bamio
+
+import (
+	"testing"
+
+	"github.com/biogo/hts/sam"
+)
+
+func TestReadFilterPasses(t *testing.T) {
+	unmapped, err := sam.NewRecord("read", nil, nil, -1, -1, 0, 0, nil, []byte("ACGT"), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	duplicate, err := sam.NewRecord("dup", nil, nil, -1, -1, 0, 60, nil, []byte("ACGT"), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	duplicate.Flags = sam.Duplicate
+
+	filter := DefaultReadFilter()
+	// the same reads seen again by a later pass count in that pass only
+	extract := filter.Pass("extract")
+	extract.Accept(unmapped)
+	extract.Accept(duplicate)
+	vote := filter.Pass("vote")
+	vote.Accept(unmapped)
+	// passes of a name add up
+	filter.Pass("reference").Accept(unmapped)
+	filter.Pass("reference").Accept(unmapped)
+
+	want := "extract: duplicate=1 mapq=1; vote: mapq=1; reference: mapq=2"
+	if got := filter.Report(); got != want {
+		t.Errorf("Report() = %q, want %q", got, want)
+	}
+	if got := filter.Rejected(); len(got) != 0 {
+		t.Errorf("filter counted %v itself, want nothing", got)
+	}
+}
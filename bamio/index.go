@@ -0,0 +1,95 @@
+package bamio
+
+import (
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/balanur/brosv-go/sv"
+	"github.com/biogo/hts/bam"
+	"github.com/biogo/hts/sam"
+)
+
+// coordinateLess orders records by reference and position, unmapped ones
+// last. Ties go by name, primary before supplementary, to keep the order
+// stable across runs.
+func coordinateLess(a *sam.Record, b *sam.Record) bool {
+	refA, refB := math.MaxInt32, math.MaxInt32
+	if a.Ref != nil {
+		refA = a.Ref.ID()
+	}
+	if b.Ref != nil {
+		refB = b.Ref.ID()
+	}
+	if refA != refB {
+		return refA < refB
+	}
+	if a.Pos != b.Pos {
+		return a.Pos < b.Pos
+	}
+	if a.Name != b.Name {
+		return a.Name < b.Name
+	}
+	return a.Flags&sam.Supplementary < b.Flags&sam.Supplementary
+}
+
+// WriteSorted writes records to filePath sorted by coordinate and indexes
+// the bam into filePath.bai
+func WriteSorted(filePath string, header *sam.Header, records []*sam.Record) error {
+	header = header.Clone()
+	header.SortOrder = sam.Coordinate
+	sort.Slice(records, func(i, j int) bool { return coordinateLess(records[i], records[j]) })
+
+	out, err := Create(filePath, header)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	for _, rec := range records {
+		if err := out.Write(rec); err != nil {
+			return err
+		}
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return WriteIndex(filePath)
+}
+
+// WriteIndex writes the .bai index of a coordinate sorted bam
+func WriteIndex(bamFilePath string) error {
+	bamReader, err := Open(bamFilePath, "", 1)
+	if err != nil {
+		return err
+	}
+	defer bamReader.Close()
+
+	var idx bam.Index
+	for {
+		rec, err := bamReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return &sv.FileError{Op: "read", File: bamFilePath, Err: err}
+		}
+		if err := idx.Add(rec, bamReader.LastChunk()); err != nil {
+			return &sv.FileError{Op: "index", File: bamFilePath, Err: err}
+		}
+	}
+
+	indexPath := bamFilePath + ".bai"
+	f, err := os.Create(indexPath)
+	if err != nil {
+		return &sv.FileError{Op: "create", File: indexPath, Err: err}
+	}
+	defer f.Close()
+	if err := bam.WriteIndex(f, &idx); err != nil {
+		return &sv.FileError{Op: "write", File: indexPath, Err: err}
+	}
+	if err := f.Close(); err != nil {
+		return &sv.FileError{Op: "write", File: indexPath, Err: err}
+	}
+	return nil
+}
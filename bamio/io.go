@@ -0,0 +1,265 @@
+// Package bamio reads and writes BAM/CRAM alignments, the brosv aux tags
+// and the intermediate bams sorted by CI.
+package bamio
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/balanur/brosv-go/sv"
+	"github.com/biogo/hts/bam"
+	"github.com/biogo/hts/bgzf"
+	"github.com/biogo/hts/sam"
+)
+
+// Format of an alignment file, detected from magic bytes
+type Format int
+
+const (
+	Unknown Format = iota
+	BAM
+	CRAM
+)
+
+func (format Format) String() string {
+	switch format {
+	case BAM:
+		return "BAM"
+	case CRAM:
+		return "CRAM"
+	}
+	return "unknown"
+}
+
+var (
+	cramMagic = []byte("CRAM")
+	bgzfMagic = []byte{0x1f, 0x8b}
+	bamMagic  = []byte("BAM\x01")
+)
+
+func DetectFormat(filePath string) (Format, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return Unknown, &sv.FileError{Op: "open", File: filePath, Err: err}
+	}
+	defer f.Close()
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return Unknown, &sv.FileError{Op: "read", File: filePath, Err: fmt.Errorf("no magic bytes: %v", err)}
+	}
+	if bytes.Equal(magic, cramMagic) {
+		return CRAM, nil
+	}
+	if !bytes.Equal(magic[:2], bgzfMagic) {
+		return Unknown, nil
+	}
+
+	// BAM is bgzf compressed, the magic follows decompression
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return Unknown, &sv.FileError{Op: "read", File: filePath, Err: err}
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return Unknown, nil
+	}
+	defer gz.Close()
+	if _, err := io.ReadFull(gz, magic); err != nil {
+		return Unknown, nil
+	}
+	if bytes.Equal(magic, bamMagic) {
+		return BAM, nil
+	}
+	return Unknown, nil
+}
+
+// Reader reads records from a BAM or CRAM file. CRAM records are
+// decoded against the reference by samtools and streamed as uncompressed BAM.
+type Reader struct {
+	*bam.Reader
+	format Format
+	file   *os.File
+	path   string
+	// the samtools decoding a CRAM, its stderr and exit status once waited for
+	cmd     *exec.Cmd
+	stdout  io.ReadCloser
+	stderr  *bytes.Buffer
+	waited  bool
+	waitErr error
+}
+
+// Open opens a BAM or CRAM file; refFilePath is only needed for CRAM
+func Open(filePath string, refFilePath string, rd int) (*Reader, error) {
+	format, err := DetectFormat(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case BAM:
+		f, err := os.Open(filePath)
+		if err != nil {
+			return nil, &sv.FileError{Op: "open", File: filePath, Err: err}
+		}
+		if ok, err := bgzf.HasEOF(f); err != nil || !ok {
+			f.Close()
+			if err == nil {
+				err = errors.New("missing bgzf EOF block, file may be truncated")
+			}
+			return nil, &sv.FileError{Op: "open", File: filePath, Err: err}
+		}
+		reader, err := bam.NewReader(f, rd)
+		if err != nil {
+			f.Close()
+			return nil, &sv.FileError{Op: "read", File: filePath, Err: err}
+		}
+		return &Reader{Reader: reader, format: format, file: f}, nil
+
+	case CRAM:
+		if refFilePath == "" {
+			return nil, &sv.FileError{Op: "open", File: filePath, Err: errors.New("input is CRAM, -ref is needed to decode it")}
+		}
+		cmd := exec.Command("samtools", "view", "-u", "-T", refFilePath, filePath)
+		stderr := &bytes.Buffer{}
+		cmd.Stderr = stderr
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, &sv.FileError{Op: "open", File: filePath, Err: err}
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, &sv.FileError{Op: "open", File: filePath, Err: fmt.Errorf("decoding CRAM with samtools: %v", err)}
+		}
+		r := &Reader{format: format, path: filePath, cmd: cmd, stdout: stdout, stderr: stderr}
+		reader, err := bam.NewReader(stdout, rd)
+		if err != nil {
+			// samtools failing to start decoding explains the bad stream
+			if werr := r.wait(); werr != nil {
+				err = werr
+			}
+			return nil, &sv.FileError{Op: "read", File: filePath, Err: err}
+		}
+		r.Reader = reader
+		return r, nil
+	}
+	return nil, &sv.FileError{Op: "open", File: filePath, Err: errors.New("neither BAM nor CRAM")}
+}
+
+// Read returns the next record. For CRAM the end of the stream is only
+// io.EOF if samtools exited cleanly; a stream cut short by samtools
+// failing returns its error instead.
+func (r *Reader) Read() (*sam.Record, error) {
+	rec, err := r.Reader.Read()
+	if err != nil && r.cmd != nil {
+		werr := r.wait()
+		if werr != nil && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+			return nil, &sv.FileError{Op: "read", File: r.path, Err: werr}
+		}
+	}
+	return rec, err
+}
+
+// wait waits for samtools to exit and returns its failure with what it
+// wrote to stderr
+func (r *Reader) wait() error {
+	if !r.waited {
+		r.waited = true
+		// a decoder still writing fails on the closed pipe instead of blocking
+		r.stdout.Close()
+		if err := r.cmd.Wait(); err != nil {
+			msg := strings.TrimSpace(r.stderr.String())
+			if msg == "" {
+				msg = "no output"
+			}
+			r.waitErr = fmt.Errorf("decoding CRAM with samtools: %v: %s", err, msg)
+		}
+	}
+	return r.waitErr
+}
+
+func (r *Reader) Close() error {
+	err := r.Reader.Close()
+	if r.file != nil {
+		if cerr := r.file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if r.cmd != nil {
+		if !r.waited {
+			// stopped reading early: the decoder may still be writing
+			r.cmd.Process.Kill()
+			r.cmd.Wait()
+			r.waited = true
+		} else if r.waitErr != nil && err == nil {
+			err = &sv.FileError{Op: "read", File: r.path, Err: r.waitErr}
+		}
+	}
+	return err
+}
+
+var sampleTag = sam.NewTag("SM")
+
+// Sample returns the sample of the read groups of r, or the name of its
+// file without extension if they name none
+func (r *Reader) Sample(filePath string) string {
+	for _, rg := range r.Header().RGs() {
+		if sample := rg.Get(sampleTag); sample != "" {
+			return sample
+		}
+	}
+	return strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+}
+
+// Writer is a bam file being written
+type Writer struct {
+	writer *bam.Writer
+	file   *os.File
+	path   string
+}
+
+// Path returns the path of the bam being written
+func (o *Writer) Path() string {
+	return o.path
+}
+
+func Create(filePath string, header *sam.Header) (*Writer, error) {
+	g, err := os.Create(filePath)
+	if err != nil {
+		return nil, &sv.FileError{Op: "create", File: filePath, Err: err}
+	}
+	writer, err := bam.NewWriter(g, header, 0)
+	if err != nil {
+		g.Close()
+		return nil, &sv.FileError{Op: "write", File: filePath, Err: err}
+	}
+	return &Writer{writer: writer, file: g, path: filePath}, nil
+}
+
+func (o *Writer) Write(rec *sam.Record) error {
+	if err := o.writer.Write(rec); err != nil {
+		return &sv.FileError{Op: "write", File: o.path, Err: err}
+	}
+	return nil
+}
+
+// Close flushes the bam; it is safe to call more than once
+func (o *Writer) Close() error {
+	if o.file == nil {
+		return nil
+	}
+	err := o.writer.Close()
+	if cerr := o.file.Close(); err == nil {
+		err = cerr
+	}
+	o.file = nil
+	if err != nil {
+		return &sv.FileError{Op: "write", File: o.path, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package bamio
+
+import (
+	"container/heap"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+
+	"github.com/balanur/brosv-go/sv"
+	"github.com/biogo/hts/sam"
+)
+
+// RecordSource is a stream of alignment records ending with io.EOF
+type RecordSource interface {
+	Read() (*sam.Record, error)
+}
+
+// svSortKey orders records by CI (SV tag), then coordinate. Unmapped
+// records sort after mapped ones of the same CI, as in samtools.
+type svSortKey struct {
+	ci    int
+	refID int
+	pos   int
+}
+
+func sortKeyOf(file string, rec *sam.Record) (svSortKey, error) {
+	ci, err := TagValue(rec, SVTag)
+	if err != nil {
+		return svSortKey{}, sv.ReadError(file, rec, -1, err)
+	}
+	key := svSortKey{ci: ci, refID: math.MaxInt32, pos: rec.Pos}
+	if rec.Ref != nil {
+		key.refID = rec.Ref.ID()
+	}
+	return key, nil
+}
+
+func (a svSortKey) less(b svSortKey) bool {
+	if a.ci != b.ci {
+		return a.ci < b.ci
+	}
+	if a.refID != b.refID {
+		return a.refID < b.refID
+	}
+	return a.pos < b.pos
+}
+
+type keyedRecord struct {
+	key svSortKey
+	rec *sam.Record
+}
+
+// approximate in-memory size of a record, used against the sort memory budget
+func recordSize(rec *sam.Record) int64 {
+	size := int64(200 + len(rec.Name) + len(rec.Seq.Seq) + len(rec.Qual) + 4*len(rec.Cigar))
+	for _, aux := range rec.AuxFields {
+		size += int64(len(aux)) + 24
+	}
+	return size
+}
+
+// SortConfig controls SortBySVTag and GroupByCI
+type SortConfig struct {
+	// directory for the sorted runs
+	TmpDir string
+	// bytes of records sorted in memory per run
+	MemBudget int64
+	RefFile   string
+	Threads   int
+	// progress lines, nil for none
+	Log *log.Logger
+}
+
+// SortBySVTag sorts a bam by SV tag then coordinate with an external merge
+// sort. Runs of at most cfg.MemBudget bytes are sorted in memory and spilled
+// to cfg.TmpDir, then merged into outPath.
+func SortBySVTag(cfg SortConfig, inPath string, outPath string) error {
+	reader, err := Open(inPath, cfg.RefFile, cfg.Threads)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	header := reader.Header()
+
+	var runs []string
+	defer func() {
+		for _, run := range runs {
+			os.Remove(run)
+		}
+	}()
+
+	var buffer []keyedRecord
+	var bufferSize int64
+	flush := func(filePath string) error {
+		sort.SliceStable(buffer, func(i, j int) bool { return buffer[i].key.less(buffer[j].key) })
+		err := writeRecords(filePath, header, buffer)
+		buffer = buffer[:0]
+		bufferSize = 0
+		return err
+	}
+
+	for {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return &sv.FileError{Op: "read", File: inPath, Err: err}
+		}
+		key, err := sortKeyOf(inPath, rec)
+		if err != nil {
+			return err
+		}
+		buffer = append(buffer, keyedRecord{key: key, rec: rec})
+		bufferSize += recordSize(rec)
+		if bufferSize >= cfg.MemBudget {
+			run := path.Join(cfg.TmpDir, "sort."+strconv.Itoa(len(runs))+".tmp.bam")
+			runs = append(runs, run)
+			if err := flush(run); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(runs) == 0 {
+		return flush(outPath)
+	}
+	if len(buffer) > 0 {
+		run := path.Join(cfg.TmpDir, "sort."+strconv.Itoa(len(runs))+".tmp.bam")
+		runs = append(runs, run)
+		if err := flush(run); err != nil {
+			return err
+		}
+	}
+	sv.Progress(cfg.Log, "Merging %d sorted runs", len(runs))
+	return mergeRuns(runs, outPath, header)
+}
+
+func writeRecords(filePath string, header *sam.Header, records []keyedRecord) error {
+	out, err := Create(filePath, header)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	for _, r := range records {
+		if err := out.Write(r.rec); err != nil {
+			return err
+		}
+	}
+	return out.Close()
+}
+
+// runHead is the next record of one sorted run during the merge
+type runHead struct {
+	keyedRecord
+	run    string
+	reader *Reader
+}
+
+type runHeap []runHead
+
+func (h runHeap) Len() int            { return len(h) }
+func (h runHeap) Less(i, j int) bool  { return h[i].key.less(h[j].key) }
+func (h runHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(runHead)) }
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+func mergeRuns(runs []string, outPath string, header *sam.Header) error {
+	out, err := Create(outPath, header)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	h := &runHeap{}
+	for _, run := range runs {
+		reader, err := Open(run, "", 1)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		rec, err := reader.Read()
+		if err == io.EOF {
+			continue
+		}
+		if err != nil {
+			return &sv.FileError{Op: "read", File: run, Err: err}
+		}
+		key, err := sortKeyOf(run, rec)
+		if err != nil {
+			return err
+		}
+		heap.Push(h, runHead{keyedRecord{key, rec}, run, reader})
+	}
+
+	for h.Len() > 0 {
+		head := (*h)[0]
+		if err := out.Write(head.rec); err != nil {
+			return err
+		}
+		rec, err := head.reader.Read()
+		if err == io.EOF {
+			heap.Pop(h)
+			continue
+		}
+		if err != nil {
+			return &sv.FileError{Op: "read", File: head.run, Err: err}
+		}
+		key, err := sortKeyOf(head.run, rec)
+		if err != nil {
+			return err
+		}
+		(*h)[0] = runHead{keyedRecord{key, rec}, head.run, head.reader}
+		heap.Fix(h, 0)
+	}
+	return out.Close()
+}
+
+// CIGroups holds records grouped by CI in memory and replays them in
+// SV tag then coordinate order, standing in for the sorted intermediate bam
+type CIGroups struct {
+	records []keyedRecord
+	next    int
+}
+
+func GroupByCI(cfg SortConfig, inPath string) (*CIGroups, error) {
+	reader, err := Open(inPath, cfg.RefFile, cfg.Threads)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	groups := &CIGroups{}
+	for {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, &sv.FileError{Op: "read", File: inPath, Err: err}
+		}
+		key, err := sortKeyOf(inPath, rec)
+		if err != nil {
+			return nil, err
+		}
+		groups.records = append(groups.records, keyedRecord{key: key, rec: rec})
+	}
+	sort.SliceStable(groups.records, func(i, j int) bool { return groups.records[i].key.less(groups.records[j].key) })
+	return groups, nil
+}
+
+func (groups *CIGroups) Read() (*sam.Record, error) {
+	if groups.next >= len(groups.records) {
+		return nil, io.EOF
+	}
+	groups.next++
+	return groups.records[groups.next-1].rec, nil
+}
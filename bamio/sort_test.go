@@ -0,0 +1,131 @@
+package bamio
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/biogo/hts/sam"
+)
+
+// writeTaggedBam writes n reads in random order over two references to
+// filePath, each tagged with a random CI; every tenth read is unmapped
+func writeTaggedBam(t *testing.T, filePath string, n int) {
+	chr1, err := sam.NewReference("chr1", "", "", 100000, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chr2, err := sam.NewReference("chr2", "", "", 100000, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := sam.NewHeader(nil, []*sam.Reference{chr1, chr2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := Create(filePath, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < n; i++ {
+		ref, pos := []*sam.Reference{chr1, chr2}[r.Intn(2)], r.Intn(99000)
+		cigar := []sam.CigarOp{sam.NewCigarOp(sam.CigarMatch, 4)}
+		if i%10 == 0 {
+			ref, pos, cigar = nil, -1, nil
+		}
+		rec, err := sam.NewRecord(fmt.Sprintf("read%d", i), ref, nil, pos, -1, 0, 60, cigar, []byte("ACGT"), nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		aux, err := sam.NewAux(SVTag, r.Intn(20))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec.AuxFields = append(rec.AuxFields, aux)
+		if err := out.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readSorted reads records until io.EOF, failing unless they are in SV tag
+// then coordinate order, and returns their names
+func readSorted(t *testing.T, source RecordSource) []string {
+	var names []string
+	var last svSortKey
+	for {
+		rec, err := source.Read()
+		if err == io.EOF {
+			return names
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := sortKeyOf("sorted", rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(names) > 0 && key.less(last) {
+			t.Fatalf("%s %+v after %+v", rec.Name, key, last)
+		}
+		names = append(names, rec.Name)
+		last = key
+	}
+}
+
+func TestSortBySVTagSpills(t *testing.T) {
+	dir := t.TempDir()
+	tmpDir := filepath.Join(dir, "tmp")
+	if err := os.Mkdir(tmpDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	inPath, outPath := filepath.Join(dir, "in.bam"), filepath.Join(dir, "sorted.bam")
+	const n = 1000
+	writeTaggedBam(t, inPath, n)
+
+	var progress bytes.Buffer
+	// runs of about 50 records
+	cfg := SortConfig{TmpDir: tmpDir, MemBudget: 50 * 250, Threads: 1, Log: log.New(&progress, "", 0)}
+	if err := SortBySVTag(cfg, inPath, outPath); err != nil {
+		t.Fatal(err)
+	}
+	var runs int
+	if _, err := fmt.Sscanf(progress.String(), "Merging %d sorted runs", &runs); err != nil || runs < 10 {
+		t.Fatalf("progress %q, want a merge of 10 runs or more", progress.String())
+	}
+
+	sorted, err := Open(outPath, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sorted.Close()
+	names := readSorted(t, sorted)
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if seen[name] {
+			t.Errorf("%s written twice", name)
+		}
+		seen[name] = true
+	}
+	if len(seen) != n {
+		t.Errorf("%d reads sorted, want %d", len(seen), n)
+	}
+
+	left, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range left {
+		t.Errorf("%s left in the temp dir", entry.Name())
+	}
+
+}
@@ -0,0 +1,138 @@
+package bamio
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/balanur/brosv-go/interval"
+	"github.com/balanur/brosv-go/sv"
+	"github.com/biogo/hts/bam"
+	"github.com/biogo/hts/bgzf"
+	"github.com/biogo/hts/csi"
+	"github.com/biogo/hts/sam"
+)
+
+// Aux tags added to clustered reads: the CI index of the read, the
+// breakpoint it votes for on the left, right or copy CI, the mark of
+// discordant pairs voting through the paired-end model instead, the
+// sample column of the input the read came from and the index of that
+// input among all of them
+var (
+	SVTag     = sam.NewTag("SV")
+	LBPTag    = sam.NewTag("LBP")
+	RBPTag    = sam.NewTag("RBP")
+	CopyTag   = sam.NewTag("CPY")
+	PairTag   = sam.NewTag("DP")
+	SampleTag = sam.NewTag("SI")
+	BamTag    = sam.NewTag("BI")
+)
+
+// BreakpointTag returns the tag of the breakpoint a read votes for on a CI
+// side. Every writer of the tags holds the breakpoint as the last base
+// before the junction, 1-based, as vote takes it.
+func BreakpointTag(side interval.Side) sam.Tag {
+	switch side {
+	case interval.Left:
+		return LBPTag
+	case interval.Right:
+		return RBPTag
+	}
+	return CopyTag
+}
+
+var (
+	ErrMissingTag = errors.New("missing aux tag")
+	ErrBadTag     = errors.New("aux tag is not an integer")
+)
+
+func AuxValue(aux sam.Aux) (int, error) {
+	if aux == nil {
+		return 0, ErrMissingTag
+	}
+	switch v := aux.Value().(type) {
+	case int8:
+		return int(v), nil
+	case int16:
+		return int(v), nil
+	case int32:
+		return int(v), nil
+	case int64:
+		return int(v), nil
+	case uint8:
+		return int(v), nil
+	case uint16:
+		return int(v), nil
+	case uint32:
+		return int(v), nil
+	case uint64:
+		return int(v), nil
+	case int:
+		return v, nil
+	}
+	return 0, fmt.Errorf("%w: %s", ErrBadTag, aux.Tag())
+}
+
+var readGroupTag = sam.NewTag("RG")
+
+// ReadGroup returns the read group of rec, empty if it has none
+func ReadGroup(rec *sam.Record) string {
+	if aux := rec.AuxFields.Get(readGroupTag); aux != nil {
+		if value, ok := aux.Value().(string); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// TagValue returns the integer value of tag on rec
+func TagValue(rec *sam.Record, tag sam.Tag) (int, error) {
+	v, err := AuxValue(rec.AuxFields.Get(tag))
+	if err != nil && errors.Is(err, ErrMissingTag) {
+		return 0, fmt.Errorf("%w %s", ErrMissingTag, tag)
+	}
+	return v, err
+}
+
+// FindIndex looks for a .bai or .csi index next to the bam file
+func FindIndex(bamFilePath string) (string, bool) {
+	candidates := []string{
+		bamFilePath + ".bai",
+		strings.TrimSuffix(bamFilePath, ".bam") + ".bai",
+		bamFilePath + ".csi",
+	}
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// ChunkFunc returns the bgzf chunks holding reads of a reference region
+type ChunkFunc func(ref *sam.Reference, beg int, end int) ([]bgzf.Chunk, error)
+
+func ReadIndex(indexPath string) (ChunkFunc, error) {
+	f, err := os.Open(indexPath)
+	if err != nil {
+		return nil, &sv.FileError{Op: "open", File: indexPath, Err: err}
+	}
+	defer f.Close()
+
+	if strings.HasSuffix(indexPath, ".csi") {
+		idx, err := csi.ReadFrom(bufio.NewReader(f))
+		if err != nil {
+			return nil, &sv.FileError{Op: "read", File: indexPath, Err: err}
+		}
+		return func(ref *sam.Reference, beg int, end int) ([]bgzf.Chunk, error) {
+			return idx.Chunks(ref.ID(), beg, end), nil
+		}, nil
+	}
+	idx, err := bam.ReadIndex(bufio.NewReader(f))
+	if err != nil {
+		return nil, &sv.FileError{Op: "read", File: indexPath, Err: err}
+	}
+	return idx.Chunks, nil
+}
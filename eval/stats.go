@@ -0,0 +1,144 @@
+package eval
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/balanur/brosv-go/interval"
+	"github.com/balanur/brosv-go/sv"
+)
+
+// WriteCIsToBed writes the CI sizes of every SV to cifile, and the copy CIs
+// of interspersed duplications
+func WriteCIsToBed(cifile string, svStore *sv.Store, ciStore *interval.Store, strType string) error {
+
+	//Output file
+	g, err := os.Create(cifile)
+	if err != nil {
+		return &sv.FileError{Op: "create", File: cifile, Err: err}
+	}
+	defer g.Close()
+	writer := bufio.NewWriter(g)
+
+	for _, id := range ciStore.SVIDs(interval.Left) {
+		i, _ := ciStore.Side(id, interval.Left)
+		j, _ := ciStore.Side(id, interval.Right)
+		k, _ := ciStore.Side(id, interval.Copy)
+		left := ciStore.Get(i)
+		right := ciStore.Get(j)
+		copy := ciStore.Get(k)
+		if left.Head >= left.Tail {
+			fmt.Printf("wtf %d %d\n", left.Head, left.Tail)
+		}
+		if right.Head >= right.Tail {
+			fmt.Printf("wtf2 %d %d\n", right.Head, right.Tail)
+		}
+		//writer.WriteString(svStore.Get(id).Chromosome + "\t" + strconv.Itoa(left.Head) + "\t" + strconv.Itoa(left.Tail) + "\n")
+		writer.WriteString(svStore.Get(id).Chromosome + "," + strconv.Itoa(left.Tail-left.Head) + "," + strconv.Itoa(right.Tail-right.Head) + "\n")
+		//writer.WriteString(svStore.Get(id).Chromosome + "\t" + strconv.Itoa(right.Head) + "\t" + strconv.Itoa(right.Tail) + "\n")
+		if strType == "intdup" {
+			if copy.Head >= copy.Tail {
+				fmt.Printf("wtf3 %d %d\n", copy.Head, copy.Tail)
+			}
+			writer.WriteString(svStore.Get(id).Chromosome + "\t" + strconv.Itoa(copy.Head) + "\t" + strconv.Itoa(copy.Tail) + "\n")
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return &sv.FileError{Op: "write", File: cifile, Err: err}
+	}
+	return nil
+}
+
+// SimStatistics prints the size distribution of simulated duplications
+func SimStatistics(simfile string) error {
+	f, err := os.Open(simfile)
+	if err != nil {
+		return &sv.FileError{Op: "open", File: simfile, Err: err}
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+
+	indel := 0
+	sv1 := 0
+	sv2 := 0
+	sv3 := 0
+	sv4 := 0
+
+	indel_i := 0
+	sv1_i := 0
+	sv2_i := 0
+	sv3_i := 0
+	sv4_i := 0
+
+	inter := 0
+	invert := 0
+
+	if strings.Contains(simfile, "bed") {
+
+		for scanner.Scan() {
+			words := strings.Fields(scanner.Text())
+			e, _ := strconv.Atoi(words[2])
+			s, _ := strconv.Atoi(words[1])
+			len := e - s
+			if len <= 50 {
+				indel++
+			} else if len <= 500 {
+				sv1++
+			} else if len <= 5000 {
+				sv2++
+			} else if len <= 10000 {
+				sv3++
+			} else {
+				sv4++
+			}
+		}
+	} else {
+
+		for scanner.Scan() {
+			words := strings.Fields(scanner.Text())
+			len, _ := strconv.Atoi(words[3])
+			duptype := words[11]
+			if duptype == "tandem" {
+				if len <= 50 {
+					indel++
+				} else if len <= 500 {
+					sv1++
+				} else if len <= 5000 {
+					sv2++
+				} else if len <= 10000 {
+					sv3++
+				} else {
+					sv4++
+				}
+			} else if duptype == "interspersed" || duptype == "inverted" {
+				if len <= 50 {
+					indel_i++
+				} else if len <= 500 {
+					sv1_i++
+				} else if len <= 5000 {
+					sv2_i++
+				} else if len <= 10000 {
+					sv3_i++
+				} else {
+					sv4_i++
+				}
+
+				if duptype == "interspersed" {
+					inter++
+				}
+				if duptype == "inverted" {
+					invert++
+				}
+			}
+		}
+	}
+	fmt.Printf("Tandem\n")
+	fmt.Printf("1-50:\t%d\n50-500:\t%d\n500-5000:\t%d\n5000-10000:\t%d\n>10000:\t%d\n", indel, sv1, sv2, sv3, sv4)
+	fmt.Printf("Interspersed\n")
+	fmt.Printf("1-50:\t%d\n50-500:\t%d\n500-5000:\t%d\n5000-10000:\t%d\n>10000:\t%d\n", indel_i, sv1_i, sv2_i, sv3_i, sv4_i)
+	fmt.Printf("interspersed: %d\ninverted: %d\n", invert, invert)
+	return nil
+}
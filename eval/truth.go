@@ -0,0 +1,488 @@
+// Package eval compares refined calls with a truth set.
+package eval
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/balanur/brosv-go/interval"
+	"github.com/balanur/brosv-go/sv"
+	"github.com/balanur/brosv-go/vcf"
+	"github.com/balanur/vcfgo"
+)
+
+func sortcond(x sv.SV, y sv.SV) bool {
+	if x.Chromosome < y.Chromosome {
+		return true
+	} else if x.Chromosome > y.Chromosome {
+		return false
+	} else if x.Start < y.Start {
+		return true
+	} else {
+		return false
+	}
+}
+
+func AbsInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// Config describes a comparison of a refined VCF with a truth set
+type Config struct {
+	ResultFile string
+	// truth set, .vcf or .bed
+	TruthFile string
+	// SV type filter name, see sv.Type.FilterName
+	Type   string
+	Sample string
+	// number of error bp allowed
+	Margin int
+	Policy *sv.Policy
+}
+
+// infoFields splits the INFO column of a VCF record into its keys and values
+func infoFields(column string) map[string]string {
+	fields := make(map[string]string)
+	for _, entry := range strings.Split(column, ";") {
+		key, value, _ := strings.Cut(entry, "=")
+		fields[key] = value
+	}
+	return fields
+}
+
+// isBreakend reports whether the fields of a VCF record are those of a BND
+func isBreakend(words []string) bool {
+	if len(words) > 4 && strings.ContainsAny(words[4], "[]") {
+		return true
+	}
+	return len(words) > 7 && infoFields(words[7])["SVTYPE"] == "BND"
+}
+
+// CompareWithTruth prints how many breakpoints of the result match the truth set
+func CompareWithTruth(cfg Config) error {
+	resultfile, truthfile, strType, margin, policy := cfg.ResultFile, cfg.TruthFile, cfg.Type, cfg.Margin, cfg.Policy
+
+	f, err := os.Open(resultfile)
+	if err != nil {
+		return &sv.FileError{Op: "open", File: resultfile, Err: err}
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+
+	var truth []sv.SV
+	var result []sv.SV
+
+	var filter string
+	if strType == "tandup" {
+		strType = "dup"
+		filter = "tandem"
+	} else if strType == "intdup" {
+		strType = "dup"
+		filter = "interspersed"
+	}
+
+	if strings.Contains(truthfile, "vcf") {
+		f2, err := os.Open(truthfile)
+		if err != nil {
+			return &sv.FileError{Op: "open", File: truthfile, Err: err}
+		}
+		defer f2.Close()
+		rdr, err := vcfgo.NewReader(f2, false)
+		if err != nil {
+			return &sv.FileError{Op: "read", File: truthfile, Err: err}
+		}
+		for {
+			variant := rdr.Read()
+
+			if variant == nil {
+				break
+			}
+			svType, _ := variant.Info().Get("SVTYPE")
+			_type, ok := svType.(string)
+			endd, _ := variant.Info().Get("END")
+			end, ok2 := endd.(int)
+			if !ok || !ok2 {
+				err := &sv.RecordError{File: truthfile, Record: variant.Id(), CI: -1, Err: fmt.Errorf("missing SVTYPE or END")}
+				if err := policy.Malformed(err); err != nil {
+					return err
+				}
+				continue
+			}
+			start := int(variant.Pos)
+			chr := variant.Chromosome
+			truth = append(truth, sv.SV{ID: ".", Chromosome: chr, Start: start, End: end, Type: _type})
+		}
+	} else {
+		// get truth file as .bed
+		f2, err := os.Open(truthfile)
+		if err != nil {
+			return &sv.FileError{Op: "open", File: truthfile, Err: err}
+		}
+		defer f2.Close()
+		scanner2 := bufio.NewScanner(f2)
+
+		line := 0
+		for scanner2.Scan() {
+			line++
+			words := strings.Fields(scanner2.Text())
+			if len(words) < 3 || (len(words) > 3 && len(words) < 12) {
+				err := &sv.RecordError{File: truthfile, Record: "line " + strconv.Itoa(line), CI: -1, Err: fmt.Errorf("expected 3 or at least 12 columns, got %d", len(words))}
+				if err := policy.Malformed(err); err != nil {
+					return err
+				}
+				continue
+			}
+			start, err1 := strconv.Atoi(words[1])
+			end, err2 := strconv.Atoi(words[2])
+			if err1 != nil || err2 != nil {
+				err := &sv.RecordError{File: truthfile, Record: "line " + strconv.Itoa(line), CI: -1, Err: fmt.Errorf("bad coordinates %q %q", words[1], words[2])}
+				if err := policy.Malformed(err); err != nil {
+					return err
+				}
+				continue
+			}
+			if len(words) <= 3 {
+				truth = append(truth, sv.SV{ID: ".", Chromosome: words[0], Start: start, End: end, Type: strType})
+				continue
+			}
+			_type := words[5]
+
+			// not duplication
+			if strType == _type && strType != "dup" {
+				truth = append(truth, sv.SV{ID: ".", Chromosome: words[0][3:], Start: start, End: end, Type: _type})
+				continue
+			}
+			// tandem duplication
+			if strType == _type && filter == "tandem" && words[11] == "tandem" {
+				truth = append(truth, sv.SV{ID: ".", Chromosome: words[0][3:], Start: start, End: end, Type: _type})
+				continue
+			}
+			// interspersed & inverted duplication
+			if strType == _type && filter == "interspersed" {
+				if words[11] == "interspersed" || words[11] == "inverted" {
+					jump, _ := strconv.Atoi(words[10])
+					truth = append(truth, sv.SV{ID: ".", Chromosome: words[0][3:], Start: start, End: end, Type: _type, CopyPos: start + jump})
+					continue
+				}
+			}
+		}
+	}
+
+	sort.Slice(truth, func(i, j int) bool { return sortcond(truth[i], truth[j]) })
+	fmt.Printf("Truth len %d \n", len(truth))
+
+	for scanner.Scan() {
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 || words[0][0] == '#' {
+			continue
+		}
+		// calls passed through without refinement
+		if len(words) > 6 && strings.Contains(words[6], vcf.NotRefinedFilter) {
+			continue
+		}
+		// breakends have no END to match against the truth sets, which hold
+		// none
+		if isBreakend(words) {
+			continue
+		}
+		var info map[string]string
+		if len(words) >= 8 {
+			info = infoFields(words[7])
+		}
+		if info["END"] == "" || info["SVTYPE"] == "" {
+			err := &sv.RecordError{File: resultfile, Record: scanner.Text(), CI: -1, Err: fmt.Errorf("missing END or SVTYPE")}
+			if err := policy.Malformed(err); err != nil {
+				return err
+			}
+			continue
+		}
+		start, _ := strconv.Atoi(words[1])
+		end, _ := strconv.Atoi(info["END"])
+		svtype := info["SVTYPE"]
+
+		if filter == "tandem" {
+			strType = "DUP:TANDEM"
+		} else if filter == "interspersed" {
+			strType = "DUP:ISP"
+		}
+		if strings.EqualFold(svtype, strType) {
+
+			// interspersed && inverted duplication
+			if filter == "interspersed" {
+				copypos, _ := strconv.Atoi(info["POS2"])
+				result = append(result, sv.SV{ID: words[2], Chromosome: words[0], Start: start, End: end, Type: strType, CopyPos: copypos})
+			} else { // all other result
+				result = append(result, sv.SV{ID: words[2], Chromosome: words[0], Start: start, End: end, Type: strType})
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return sortcond(result[i], result[j]) })
+
+	fmt.Printf("Result len %d \n", len(result))
+	if len(result) == 0 {
+		return nil
+	}
+
+	//redundancy check
+	var temp2 []sv.SV
+	temp2 = append(temp2, result[0])
+
+	for i := 1; i < len(result); i++ {
+		if result[i].Chromosome != result[i-1].Chromosome {
+			temp2 = append(temp2, result[i])
+		} else if result[i-1].End < result[i].Start && result[i-1].Start != result[i].Start && result[i-1].End != result[i].End {
+			temp2 = append(temp2, result[i])
+		}
+	}
+	result = temp2
+	fmt.Printf("Result len %d (no redundancy)\n", len(result))
+
+	//performanceForCIs(truth, result)
+	//return
+
+	var forfig []string
+	// compare
+	i := 0
+	j := 0
+	cTRUE := 0
+	TPl := 0
+	TPr := 0
+	FP := 0
+	FN := 0
+	TP2 := 0
+	for i = 0; i < len(result); i++ {
+		flag := false
+		for j = 0; j < len(truth); j++ {
+			if result[i].Chromosome == truth[j].Chromosome {
+				if AbsInt(result[i].Start-truth[j].Start) <= margin {
+					forfig = append(forfig, result[i].ID)
+					TPl++
+					flag = true
+				}
+				if AbsInt(result[i].End-truth[j].End) <= margin {
+					TPr++
+					flag = true
+				}
+			}
+		}
+		if !flag {
+			FP++
+		}
+	}
+	for j = 0; j < len(truth); j++ {
+		flag := false
+		for i = 0; i < len(result); i++ {
+			if result[i].Chromosome == truth[j].Chromosome {
+				if AbsInt(result[i].Start-truth[j].Start) <= margin || AbsInt(result[i].End-truth[j].End) <= margin {
+					TP2++
+					flag = true
+					break
+				}
+			}
+		}
+		if !flag {
+			FN++
+		}
+	}
+
+	fmt.Printf("TPl %d  TPr %d FP %d FN %d\n", TPl, TPr, FP, FN)
+
+	// left breakpoint
+	/*for i = 0; i < len(result) && j < len(truth); {
+		if result[i].Chromosome > truth[j].Chromosome {
+			FNs[truth[j].Start] = truth[j]
+			j++
+		} else if truth[j].Chromosome > result[i].Chromosome {
+			FPs[result[i].ID] = result[i]
+			i++
+		} else {
+			if result[i].Start-truth[j].Start > margin {
+				FNs[truth[j].Start] = truth[j]
+				j++
+			} else if truth[j].Start-result[i].Start > margin {
+				FPs[result[i].ID] = result[i]
+				i++
+			} else {
+				verified[result[i].ID] = 1
+				TPs[result[i].ID] = result[i]
+				TPs2[truth[j].Start] = truth[j]
+				lTRUE++
+				i++
+				j++
+			}
+		}
+	}
+
+	for ; i < len(result); i++ {
+		FPs[result[i].ID] = result[i]
+	}
+
+	for ; j < len(truth); j++ {
+		FNs[truth[j].Start] = truth[j]
+	}
+
+	fmt.Printf("TP: %d FP: %d FN: %d\n", len(TPs), len(FPs), len(FNs))
+
+	// right breakpoint
+	j = 0
+	for i = 0; i < len(result) && j < len(truth); {
+		if result[i].Chromosome > truth[j].Chromosome {
+			j++
+		} else if truth[j].Chromosome > result[i].Chromosome {
+			if _, ok := TPs[result[i].ID]; !ok {
+				FPs[result[i].ID] = result[i]
+			}
+			i++
+		} else {
+			if result[i].End-truth[j].End > margin {
+				j++
+			} else if truth[j].End-result[i].End > margin {
+				if _, ok := TPs[result[i].ID]; !ok {
+					FPs[result[i].ID] = result[i]
+				}
+				i++
+			} else {
+				if _, ok := FPs[result[i].ID]; ok {
+					//fmt.Printf("FP %d %d , %d %d\n", truth[j].Start, truth[j].End, result[i].Start, result[i].End)
+					delete(FPs, result[i].ID)
+				}
+				if _, ok := FNs[truth[j].Start]; ok {
+					//fmt.Printf("FN %d %d , %d %d\n", truth[j].Start, truth[j].End, result[i].Start, result[i].End)
+					delete(FNs, truth[j].Start)
+				}
+				TPs[result[i].ID] = result[i]
+				TPs2[truth[j].Start] = truth[j]
+				verified[result[i].ID] = 1
+				rTRUE++
+				i++
+				j++
+			}
+		}
+	}
+
+	for ; i < len(result); i++ {
+		FPs[result[i].ID] = result[i]
+	}
+
+	for ; j < len(truth); j++ {
+		FNs[truth[j].Start] = truth[j]
+	}
+
+	fmt.Printf("TP: %d FP: %d FN: %d\n", len(TPs2), len(FPs), len(FNs))
+	*/
+
+	if filter == "interspersed" {
+		// copy loci for interspersed
+		j = 0
+		for i = 0; i < len(result) && j < len(truth); {
+			if result[i].Chromosome > truth[j].Chromosome {
+				j++
+			} else if truth[j].Chromosome > result[i].Chromosome {
+				i++
+			} else {
+				if result[i].CopyPos-truth[j].CopyPos > margin {
+					j++
+				} else if truth[j].CopyPos-result[i].CopyPos > margin {
+					i++
+				} else {
+					//verified[result[i].ID] = 1
+					cTRUE++
+					i++
+				}
+			}
+		}
+	}
+
+	fmt.Printf("Copy bp found %d\n", cTRUE)
+	return nil
+}
+
+// tp, fp, fn
+func performanceForCIs(truth []sv.SV, result []sv.SV, ciStore *interval.Store) {
+
+	FPs := make(map[string]sv.SV)
+	FNs := make(map[int]sv.SV)
+	TPs := make(map[string]sv.SV)
+	i := 0
+	j := 0
+
+	for i = 0; i < len(result) && j < len(truth); {
+		lid, _ := ciStore.Side(result[i].ID, interval.Left)
+		if result[i].Chromosome > truth[j].Chromosome {
+			FNs[truth[j].Start] = truth[j]
+			j++
+		} else if truth[j].Chromosome > result[i].Chromosome {
+			FPs[result[i].ID] = result[i]
+			i++
+		} else {
+			if truth[j].Start < ciStore.Get(lid).Head {
+				FNs[truth[j].Start] = truth[j]
+				j++
+			} else if ciStore.Get(lid).Head <= truth[j].Start && truth[j].Start <= ciStore.Get(lid).Tail {
+				TPs[result[i].ID] = result[i]
+				i++
+				j++
+			} else if ciStore.Get(lid).Tail < truth[j].Start {
+				FPs[result[i].ID] = result[i]
+				i++
+			}
+		}
+	}
+	j = 0
+	for i = 0; i < len(result) && j < len(truth); {
+		rid, _ := ciStore.Side(result[i].ID, interval.Right)
+		if result[i].Chromosome > truth[j].Chromosome {
+			_, ok := TPs[result[i].ID]
+			_, ok2 := FPs[result[i].ID]
+			if !ok && !ok2 {
+				FNs[truth[j].Start] = truth[j]
+			}
+			j++
+		} else if truth[j].Chromosome > result[i].Chromosome {
+			if _, ok := TPs[result[i].ID]; !ok {
+				FPs[result[i].ID] = result[i]
+			}
+			i++
+		} else {
+			if truth[j].End < ciStore.Get(rid).Head {
+				_, ok := TPs[result[i].ID]
+				_, ok2 := FPs[result[i].ID]
+				if !ok && !ok2 {
+					FNs[truth[j].Start] = truth[j]
+				}
+				j++
+			} else if ciStore.Get(rid).Head <= truth[j].End && truth[j].End <= ciStore.Get(rid).Tail {
+				if _, ok := FPs[result[i].ID]; ok {
+					delete(FPs, result[i].ID)
+				}
+				if _, ok := FNs[truth[j].Start]; ok {
+					delete(FNs, truth[j].Start)
+				}
+				TPs[result[i].ID] = result[i]
+				i++
+				j++
+			} else if ciStore.Get(rid).Tail < truth[j].End {
+				if _, ok := TPs[result[i].ID]; !ok {
+					FPs[result[i].ID] = result[i]
+				}
+				i++
+			}
+		}
+	}
+	for ; i < len(result); i++ {
+		FPs[result[i].ID] = result[i]
+	}
+
+	for ; j < len(truth); j++ {
+		FNs[truth[j].Start] = truth[j]
+	}
+
+	fmt.Printf("TP: %d FP: %d FN: %d\n", len(TPs), len(FPs), len(FNs))
+}
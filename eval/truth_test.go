@@ -0,0 +1,31 @@
+package eval
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/balanur/brosv-go/sv"
+)
+
+const refinedWithBreakends = `##fileformat=VCFv4.2
+#CHROM	POS	ID	REF	ALT	QUAL	FILTER	INFO
+chr1	100	del	N	<DEL>	.	PASS	SVTYPE=DEL;END=500
+chr1	1000	bnd	A	A[chr2:3000[	.	PASS	SVTYPE=BND;MATEID=bnd_2
+chr2	3000	bnd_2	C	]chr1:1000]C	.	PASS	SVTYPE=BND;MATEID=bnd
+`
+
+func TestCompareWithTruthSkipsBreakends(t *testing.T) {
+	dir := t.TempDir()
+	resultFile, truthFile := filepath.Join(dir, "refined.vcf"), filepath.Join(dir, "truth.bed")
+	if err := os.WriteFile(resultFile, []byte(refinedWithBreakends), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(truthFile, []byte("chr1\t100\t500\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	policy := &sv.Policy{Strict: true}
+	if err := CompareWithTruth(Config{ResultFile: resultFile, TruthFile: truthFile, Type: "del", Margin: 10, Policy: policy}); err != nil {
+		t.Fatal(err)
+	}
+}
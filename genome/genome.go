@@ -0,0 +1,154 @@
+// Package genome loads a fasta reference through its fai index.
+package genome
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/balanur/brosv-go/sv"
+)
+
+// FaiEntry is a line from fasta index
+type FaiEntry struct {
+	Title     string
+	Length    int64
+	Offset    int64
+	LineBases int
+	LineWidth int
+}
+
+// Chromosome title and content
+type Chromosome struct {
+	Title   string
+	Content string
+}
+
+// Genome : Whole genome consisting of fasta index and chromosome contents
+type Genome struct {
+	faiEntries []FaiEntry
+	chms       []Chromosome
+	chmMap     map[string]int
+}
+
+// Chr returns the chromosome titled title, empty if the reference has none
+func (genome *Genome) Chr(title string) Chromosome {
+	i, ok := genome.chmMap[title]
+	if !ok {
+		return Chromosome{Title: title}
+	}
+	return genome.chms[i]
+}
+
+// Chromosomes returns the chromosomes in fai order
+func (genome *Genome) Chromosomes() []Chromosome {
+	return genome.chms
+}
+
+// ParseFaiLine go
+func ParseFaiLine(line string) (FaiEntry, error) {
+	lineScanner := bufio.NewScanner(strings.NewReader(line))
+	lineScanner.Split(bufio.ScanWords)
+	var counter int
+	var result FaiEntry
+	for lineScanner.Scan() {
+		word := lineScanner.Text()
+		var e error
+		switch counter {
+		case 0:
+			result.Title = word
+		case 1:
+			result.Length, e = strconv.ParseInt(word, 10, 64)
+		case 2:
+			result.Offset, e = strconv.ParseInt(word, 10, 64)
+		}
+		if e != nil {
+			return result, e
+		}
+		counter++
+	}
+	if counter < 3 {
+		return result, errors.New("fai line has fewer than 3 columns")
+	}
+	return result, nil
+}
+
+// ReadChr go
+func ReadChr(file *os.File, entry FaiEntry) (Chromosome, error) {
+	var result Chromosome
+	result.Title = entry.Title
+
+	var buffer bytes.Buffer
+	fmt.Printf("Seeking to %d for %s\n", entry.Offset, entry.Title)
+	if _, err := file.Seek(entry.Offset, 0); err != nil {
+		return result, err
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1<<20), 1<<20)
+	scanner.Split(bufio.ScanLines)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) > 0 && line[0] == '>' {
+			result.Content = buffer.String()
+			buffer.Reset()
+			break
+		} else {
+			buffer.WriteString(line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return result, err
+	}
+	// last chromosome of the file
+	if result.Content == "" {
+		result.Content = buffer.String()
+	}
+	return result, nil
+}
+
+// Read loads every chromosome of the reference listed in referencePath.fai
+func Read(referencePath string) (Genome, error) {
+	var genome Genome
+	genome.chmMap = make(map[string]int)
+	faiFile, err := os.Open(referencePath + ".fai")
+	if err != nil {
+		return genome, &sv.FileError{Op: "open", File: referencePath + ".fai", Err: err}
+	}
+	defer faiFile.Close()
+
+	fastaFile, err := os.Open(referencePath)
+	if err != nil {
+		return genome, &sv.FileError{Op: "open", File: referencePath, Err: err}
+	}
+	defer fastaFile.Close()
+
+	log.Println("Reading reference genome from", referencePath)
+	scanner := bufio.NewScanner(faiFile)
+	line := 0
+	for scanner.Scan() {
+		line++
+		entry, err := ParseFaiLine(scanner.Text())
+		if err != nil {
+			return genome, &sv.RecordError{File: referencePath + ".fai", Record: "line " + strconv.Itoa(line), CI: -1, Err: err}
+		}
+		genome.faiEntries = append(genome.faiEntries, entry)
+
+		chm, err := ReadChr(fastaFile, entry)
+		if err != nil {
+			return genome, &sv.FileError{Op: "read", File: referencePath, Err: err}
+		}
+		genome.chms = append(genome.chms, chm)
+		genome.chmMap[chm.Title] = len(genome.chms) - 1
+		fmt.Printf("Loaded %s\t\t\t\r", chm.Title)
+	}
+	if err := scanner.Err(); err != nil {
+		return genome, &sv.FileError{Op: "read", File: referencePath + ".fai", Err: err}
+	}
+	return genome, nil
+}
@@ -0,0 +1,28 @@
+package genome
+
+func Reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+func Complement(s string) string {
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case 'A':
+			runes[i] = 'T'
+		case 'T':
+			runes[i] = 'A'
+		case 'G':
+			runes[i] = 'C'
+		case 'C':
+			runes[i] = 'G'
+		default:
+			runes[i] = 'N'
+		}
+	}
+	return string(runes)
+}
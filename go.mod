@@ -0,0 +1,11 @@
+module github.com/balanur/brosv-go
+
+go 1.21
+
+require (
+	github.com/balanur/vcfgo v0.0.0-00010101000000-000000000000
+	github.com/biogo/hts v1.4.3
+)
+
+// the VCF reader lives in the tree; see third_party/vcfgo
+replace github.com/balanur/vcfgo => ./third_party/vcfgo
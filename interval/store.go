@@ -0,0 +1,129 @@
+// Package interval stores the confidence intervals (CIs) around SV
+// breakpoints and answers overlap queries against them.
+package interval
+
+import (
+	"sort"
+)
+
+// Side of Confidence interval
+type Side int
+
+const (
+	Left Side = iota + 1
+	Right
+	Copy
+)
+
+// Interval is the confidence interval of one breakpoint of an SV. Chr is
+// set by Store.Add; the breakends of a translocation lie on different ones.
+type Interval struct {
+	Chr  string
+	Head int
+	Tail int
+	SVID string
+	Side Side
+}
+
+// Store holds the CIs of a callset, indexed by position in the order they were added
+type Store struct {
+	list  []Interval
+	byChr map[string][]int
+	index map[string]*intervalIndex
+	// CI of each side of every SV
+	sides map[Side]map[string]int
+}
+
+func NewStore() *Store {
+	return &Store{
+		byChr: make(map[string][]int),
+		index: make(map[string]*intervalIndex),
+		sides: map[Side]map[string]int{
+			Left:  make(map[string]int),
+			Right: make(map[string]int),
+			Copy:  make(map[string]int),
+		},
+	}
+}
+
+// Add appends interval on chromosome chrName and returns its CI index
+func (store *Store) Add(chrName string, interval Interval) int {
+	interval.Chr = chrName
+	store.list = append(store.list, interval)
+	ciIndex := len(store.list) - 1
+	store.byChr[chrName] = append(store.byChr[chrName], ciIndex)
+	delete(store.index, chrName)
+	if ids, ok := store.sides[interval.Side]; ok {
+		ids[interval.SVID] = ciIndex
+	}
+	return ciIndex
+}
+
+func (store *Store) Get(index int) Interval {
+	return store.list[index]
+}
+
+// Valid reports whether index is the index of a CI in the store
+func (store *Store) Valid(index int) bool {
+	return index >= 0 && index < len(store.list)
+}
+
+func (store *Store) Len() int {
+	return len(store.list)
+}
+
+// Chromosomes returns the chromosomes having CIs
+func (store *Store) Chromosomes() []string {
+	var result []string
+	for chrName := range store.byChr {
+		result = append(result, chrName)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// OnChromosome returns the indices of the CIs of a chromosome
+func (store *Store) OnChromosome(chrName string) []int {
+	return store.byChr[chrName]
+}
+
+// Side returns the CI index of one side of an SV
+func (store *Store) Side(svID string, side Side) (int, bool) {
+	ciIndex, ok := store.sides[side][svID]
+	return ciIndex, ok
+}
+
+// SVIDs returns the IDs of the SVs having a CI on side
+func (store *Store) SVIDs(side Side) []string {
+	var result []string
+	for id := range store.sides[side] {
+		result = append(result, id)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// BuildIndex builds the interval tree of every chromosome; call it once all CIs are added
+func (store *Store) BuildIndex() {
+	for chrName, indices := range store.byChr {
+		store.index[chrName] = newIntervalIndex(store, indices)
+	}
+}
+
+// Overlapping returns the CIs overlapping [start, end] in ascending order
+func (store *Store) Overlapping(chrName string, start int, end int) []int {
+	var result []int
+	if idx, ok := store.index[chrName]; ok {
+		result = idx.overlapping(start, end, result)
+	} else {
+		// index not built yet
+		for _, i := range store.byChr[chrName] {
+			interval := store.Get(i)
+			if interval.Head <= end && start <= interval.Tail {
+				result = append(result, i)
+			}
+		}
+	}
+	sort.Ints(result)
+	return result
+}
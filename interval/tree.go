@@ -0,0 +1,180 @@
+package interval
+
+import (
+	"sort"
+)
+
+// intervalIndex is an implicit augmented interval tree over the CIs of one
+// chromosome, laid out as in cgranges: intervals are sorted by head and the
+// sorted array is read as an in-order binary tree, where the level of node i
+// is the number of trailing 1 bits of i. maxEnd[i] is the largest end in the
+// subtree rooted at i. Ends are stored exclusive (tail + 1).
+type intervalIndex struct {
+	heads    []int
+	ends     []int
+	maxEnd   []int
+	ciIndex  []int
+	maxLevel int
+}
+
+func newIntervalIndex(store *Store, indices []int) *intervalIndex {
+	sorted := append([]int(nil), indices...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return store.list[sorted[i]].Head < store.list[sorted[j]].Head
+	})
+
+	n := len(sorted)
+	idx := &intervalIndex{
+		heads:   make([]int, n),
+		ends:    make([]int, n),
+		maxEnd:  make([]int, n),
+		ciIndex: sorted,
+	}
+	for i, ci := range sorted {
+		idx.heads[i] = store.list[ci].Head
+		idx.ends[i] = store.list[ci].Tail + 1
+	}
+	idx.maxLevel = idx.augment()
+	return idx
+}
+
+// augment fills maxEnd bottom-up and returns the level of the root
+func (idx *intervalIndex) augment() int {
+	n := len(idx.heads)
+	if n == 0 {
+		return -1
+	}
+	lastI, last := 0, 0
+	for i := 0; i < n; i += 2 {
+		lastI, last = i, idx.ends[i]
+		idx.maxEnd[i] = idx.ends[i]
+	}
+	k := 1
+	for ; 1<<k <= n; k++ {
+		x := 1 << (k - 1)
+		i0 := (x << 1) - 1
+		step := x << 2
+		for i := i0; i < n; i += step {
+			el := idx.maxEnd[i-x]
+			er := last
+			if i+x < n {
+				er = idx.maxEnd[i+x]
+			}
+			e := idx.ends[i]
+			if el > e {
+				e = el
+			}
+			if er > e {
+				e = er
+			}
+			idx.maxEnd[i] = e
+		}
+		if lastI>>k&1 != 0 {
+			lastI -= x
+		} else {
+			lastI += x
+		}
+		if lastI < n && idx.maxEnd[lastI] > last {
+			last = idx.maxEnd[lastI]
+		}
+	}
+	return k - 1
+}
+
+type treeNode struct {
+	x, k     int
+	leftDone bool
+}
+
+// overlapping appends the CIs overlapping the closed range [start, end] to result
+func (idx *intervalIndex) overlapping(start int, end int, result []int) []int {
+	n := len(idx.heads)
+	if n == 0 {
+		return result
+	}
+	st, en := start, end+1
+	stack := make([]treeNode, 0, 64)
+	stack = append(stack, treeNode{x: (1 << idx.maxLevel) - 1, k: idx.maxLevel})
+	for len(stack) > 0 {
+		z := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if z.k <= 3 {
+			// small subtree, scan it linearly
+			i0 := z.x >> z.k << z.k
+			i1 := i0 + (1 << (z.k + 1)) - 1
+			if i1 > n {
+				i1 = n
+			}
+			for i := i0; i < i1 && idx.heads[i] < en; i++ {
+				if st < idx.ends[i] {
+					result = append(result, idx.ciIndex[i])
+				}
+			}
+		} else if !z.leftDone {
+			// revisit z after its left child, which may lie past the end of the array
+			y := z.x - (1 << (z.k - 1))
+			stack = append(stack, treeNode{x: z.x, k: z.k, leftDone: true})
+			if y >= n || idx.maxEnd[y] > st {
+				stack = append(stack, treeNode{x: y, k: z.k - 1})
+			}
+		} else if z.x < n && idx.heads[z.x] < en {
+			if st < idx.ends[z.x] {
+				result = append(result, idx.ciIndex[z.x])
+			}
+			stack = append(stack, treeNode{x: z.x + (1 << (z.k - 1)), k: z.k - 1})
+		}
+	}
+	return result
+}
+
+// Sweeper answers overlap queries for coordinate-sorted reads in one forward
+// pass. CIs enter the active set once the sweep reaches their head and leave it
+// once the sweep start is past their tail. The store index must be built.
+type Sweeper struct {
+	store  *Store
+	chr    string
+	sorted []int
+	next   int
+	active []int
+}
+
+func (store *Store) NewSweeper() *Sweeper {
+	return &Sweeper{store: store}
+}
+
+// Query returns the CIs overlapping [start, end]; start must not decrease
+// between calls on the same chromosome
+func (s *Sweeper) Query(chrName string, start int, end int) []int {
+	if chrName != s.chr {
+		s.chr = chrName
+		s.next = 0
+		s.active = s.active[:0]
+		if idx, ok := s.store.index[chrName]; ok {
+			s.sorted = idx.ciIndex
+		} else {
+			s.sorted = nil
+		}
+	}
+
+	for s.next < len(s.sorted) && s.store.list[s.sorted[s.next]].Head <= end {
+		s.active = append(s.active, s.sorted[s.next])
+		s.next++
+	}
+
+	var result []int
+	kept := s.active[:0]
+	for _, i := range s.active {
+		interval := s.store.list[i]
+		if interval.Tail < start {
+			continue
+		}
+		kept = append(kept, i)
+		if interval.Head <= end {
+			result = append(result, i)
+		}
+	}
+	s.active = kept
+	sort.Ints(result)
+	return result
+}
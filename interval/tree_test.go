@@ -0,0 +1,193 @@
+package interval
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// linearScan is the overlap query the tree replaced
+func linearScan(store *Store, chrName string, start int, end int) []int {
+	var result []int
+	for _, i := range store.byChr[chrName] {
+		interval := store.Get(i)
+		if interval.Head <= end && start <= interval.Tail {
+			result = append(result, i)
+		}
+	}
+	sort.Ints(result)
+	return result
+}
+
+func newTestStore(cis []Interval) *Store {
+	store := NewStore()
+	for _, ci := range cis {
+		store.Add(ci.Chr, ci)
+	}
+	store.BuildIndex()
+	return store
+}
+
+func TestOverlapping(t *testing.T) {
+	store := newTestStore([]Interval{
+		{Chr: "chr1", Head: 100, Tail: 200, SVID: "a", Side: Left},
+		{Chr: "chr1", Head: 150, Tail: 160, SVID: "a", Side: Right},
+		{Chr: "chr1", Head: 300, Tail: 400, SVID: "b", Side: Left},
+		{Chr: "chr2", Head: 100, Tail: 200, SVID: "c", Side: Left},
+	})
+	tests := []struct {
+		name       string
+		chr        string
+		start, end int
+		want       []int
+	}{
+		{"inside", "chr1", 120, 130, []int{0}},
+		{"nested", "chr1", 155, 155, []int{0, 1}},
+		{"touching head", "chr1", 50, 100, []int{0}},
+		{"touching tail", "chr1", 400, 450, []int{2}},
+		{"spans whole CI", "chr1", 140, 170, []int{0, 1}},
+		{"spans every CI", "chr1", 0, 1000, []int{0, 1, 2}},
+		{"between", "chr1", 201, 299, nil},
+		{"past the end", "chr1", 401, 500, nil},
+		{"other chromosome", "chr2", 150, 150, []int{3}},
+		{"unknown chromosome", "chr3", 0, 1000, nil},
+	}
+	for _, tt := range tests {
+		got := store.Overlapping(tt.chr, tt.start, tt.end)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Overlapping(%s, %d, %d) = %v, want %v", tt.name, tt.chr, tt.start, tt.end, got, tt.want)
+		}
+	}
+}
+
+func TestOverlappingBeforeIndex(t *testing.T) {
+	store := NewStore()
+	store.Add("chr1", Interval{Head: 10, Tail: 20})
+	if got := store.Overlapping("chr1", 0, 10); !reflect.DeepEqual(got, []int{0}) {
+		t.Errorf("Overlapping before BuildIndex = %v, want [0]", got)
+	}
+}
+
+// randomStore fills a store with n CIs on two chromosomes, some long
+// enough to hold others
+func randomStore(r *rand.Rand, n int, length int) *Store {
+	store := NewStore()
+	for i := 0; i < n; i++ {
+		chr := "chr1"
+		if r.Intn(4) == 0 {
+			chr = "chr2"
+		}
+		head := r.Intn(length)
+		width := r.Intn(500)
+		if r.Intn(20) == 0 {
+			width = r.Intn(20000)
+		}
+		store.Add(chr, Interval{Head: head, Tail: head + width})
+	}
+	store.BuildIndex()
+	return store
+}
+
+func TestOverlappingRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, n := range []int{0, 1, 2, 7, 8, 9, 31, 33, 100, 1000} {
+		store := randomStore(r, n, 100000)
+		for q := 0; q < 500; q++ {
+			chr := "chr1"
+			if q%3 == 0 {
+				chr = "chr2"
+			}
+			start := r.Intn(110000) - 5000
+			end := start + r.Intn(1000)
+			got := store.Overlapping(chr, start, end)
+			want := linearScan(store, chr, start, end)
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("n=%d: Overlapping(%s, %d, %d) = %v, want %v", n, chr, start, end, got, want)
+			}
+		}
+	}
+}
+
+func TestSweeper(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	store := randomStore(r, 500, 100000)
+	sweeper := store.NewSweeper()
+	for _, chr := range []string{"chr1", "chr2", "chr3"} {
+		start := 0
+		for q := 0; q < 1000; q++ {
+			start += r.Intn(150)
+			end := start + r.Intn(300)
+			got := sweeper.Query(chr, start, end)
+			want := linearScan(store, chr, start, end)
+			if len(got) == 0 && len(want) == 0 {
+				continue
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("Query(%s, %d, %d) = %v, want %v", chr, start, end, got, want)
+			}
+		}
+	}
+}
+
+func TestSweeperSpanningRead(t *testing.T) {
+	store := newTestStore([]Interval{
+		{Chr: "chr1", Head: 100, Tail: 110},
+		{Chr: "chr1", Head: 105, Tail: 500},
+	})
+	sweeper := store.NewSweeper()
+	if got := sweeper.Query("chr1", 90, 120); !reflect.DeepEqual(got, []int{0, 1}) {
+		t.Errorf("read spanning a CI: got %v, want [0 1]", got)
+	}
+	if got := sweeper.Query("chr1", 200, 250); !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("read inside the long CI: got %v, want [1]", got)
+	}
+}
+
+// benchQueries are read sized queries spread over the chromosome
+func benchQueries(r *rand.Rand, n int, length int) [][2]int {
+	queries := make([][2]int, n)
+	for i := range queries {
+		start := r.Intn(length)
+		queries[i] = [2]int{start, start + 150}
+	}
+	return queries
+}
+
+func BenchmarkOverlappingTree(b *testing.B) {
+	r := rand.New(rand.NewSource(3))
+	store := randomStore(r, 10000, 10000000)
+	queries := benchQueries(r, 1024, 10000000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		q := queries[i%len(queries)]
+		store.Overlapping("chr1", q[0], q[1])
+	}
+}
+
+func BenchmarkOverlappingScan(b *testing.B) {
+	r := rand.New(rand.NewSource(3))
+	store := randomStore(r, 10000, 10000000)
+	queries := benchQueries(r, 1024, 10000000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		q := queries[i%len(queries)]
+		linearScan(store, "chr1", q[0], q[1])
+	}
+}
+
+func BenchmarkSweeper(b *testing.B) {
+	r := rand.New(rand.NewSource(3))
+	store := randomStore(r, 10000, 10000000)
+	b.ResetTimer()
+	sweeper := store.NewSweeper()
+	start := 0
+	for i := 0; i < b.N; i++ {
+		start += 10
+		if start > 10000000 {
+			start = 0
+			sweeper = store.NewSweeper()
+		}
+		sweeper.Query("chr1", start, start+150)
+	}
+}
@@ -3,307 +3,641 @@ package main
 import (
 	"flag"
 	"fmt"
-	"io"
 	"log"
-	"math"
 	"os"
-	"os/exec"
 	"path"
+	"runtime"
 	"strconv"
 	"strings"
 
-	"github.com/balanur/vcfgo"
-	"github.com/biogo/hts/bam"
-	"github.com/biogo/hts/sam"
+	"github.com/balanur/brosv-go/aligner"
+	"github.com/balanur/brosv-go/assembly"
+	"github.com/balanur/brosv-go/bamio"
+	"github.com/balanur/brosv-go/eval"
+	"github.com/balanur/brosv-go/interval"
+	"github.com/balanur/brosv-go/signal"
+	"github.com/balanur/brosv-go/sv"
+	"github.com/balanur/brosv-go/vcf"
+	"github.com/balanur/brosv-go/vote"
 )
 
 var (
-	mode = flag.Int("mode", 3, "Running mode.\n"+
-		"1: Generate Signaling Reads\n"+
-		"2: Voting\n")
-	vcfFile = flag.String("vcf", "", "vcf input file")
-	bamFile = flag.String("bam", "", "bam input file")
-	refFile = flag.String("ref", "", "reference file")
-	sr      = flag.String("sr", "signalingReads40.txt", "Signaling Reads file")
-	workdir = flag.String("workdir", "", "Working directory")
-	threads = flag.Int("threads", 0, "number of threads to use (0 = auto)")
-	margin  = flag.Int("margin", 0, "number of error bp allowed (0 = auto)")
-	help    = flag.Bool("help", false, "display help")
+	vcfFile    string
+	bamFile    string
+	normalFile string
+	refFile    string
+	workdir    string
+	truthFile  string
+	sample     string
+	svTypeName string
+	threads    int
+	margin     int
+	force      bool
+	lenient    bool
+
+	sortMemory    int
+	groupInMemory bool
+	maxWindow     = aligner.DefaultMaxWindow
+	scoringName   string
+	minIdentity   float64
+	qualityAware  bool
+	scoring       = aligner.Illumina()
+	deletionCigar string
+	voteConfig    = vote.DefaultConfig()
+
+	assemble          bool
+	assemblyConfig    = assembly.DefaultConfig()
+	assemblyTolerance int
+
+	maxNormalSupport int
 )
 
-var svTag, lbpTag, rbpTag, copyTag sam.Tag
-var segmentSize, variance int
-var leftCIs, rightCIs, copyCIs map[string]int
-var ciStore CIStore
-var svStore SVStore
+var policy = &sv.Policy{Strict: true}
 
-func readVcf(fileName string) (SVStore, CIStore) {
-	return readVcfFiltered(fileName, "", "")
-}
+// progress receives the progress lines of the steps
+var progress = log.New(os.Stdout, "", 0)
 
-func readVcfFiltered(fileName string, filter string, samplefilter string) (SVStore, CIStore) {
-	svStore := NewSVStore()
-	ciStore := NewCIStore()
+var readFilter = bamio.DefaultReadFilter()
 
-	f, _ := os.Open(fileName)
-	rdr, err := vcfgo.NewReader(f, false)
-	if err != nil {
-		panic(err)
-	}
+// inputs of -bam, split at commas, followed by those of -normal
+var bamFiles []string
 
-	var filter2 string
-	if filter == "tandup" {
-		filter = "DUP"
-		filter2 = "DUP:TANDEM"
-	} else if filter == "intdup" {
-		filter = "DUP"
-		filter2 = "DUP:ISP"
-	}
-	SVcount := 0
-	for {
-		variant := rdr.Read()
+// inputs of -normal, split at commas
+var normalFiles []string
 
-		if variant == nil {
-			break
-		}
+// pipeline is the callset loaded for a run and the settings its steps share
+type pipeline struct {
+	svType     sv.Type
+	insertSize signal.InsertSize
+	inserts    signal.InsertSizes
+	// the bams and the sample column of each, named in samples; normal
+	// marks the columns of the matched normal in somatic runs
+	inputs  []signal.Input
+	samples []string
+	normal  []bool
+	svs     *sv.Store
+	cis     *interval.Store
+}
 
-		svType, _ := variant.Info().Get("SVTYPE")
-		sample, _ := variant.Info().Get("SAMPLE")
+// signalConfig is the configuration of a pass over the input reads, its
+// rejections counted under pass
+func (p *pipeline) signalConfig(pass string) signal.Config {
+	return signal.Config{
+		SVType:     p.svType,
+		InsertSize: p.insertSize,
+		RefFile:    refFile,
+		Threads:    threads,
+		Policy:     policy,
+		Filter:     readFilter.Pass(pass),
+		Log:        progress,
+	}
+}
 
-		if !strings.Contains(svType.(string), filter) || !strings.Contains(variant.Alt()[0], filter2) {
-			continue
-		}
+func (p *pipeline) alignerConfig() aligner.Config {
+	return aligner.Config{
+		RefFile:     refFile,
+		Threads:     threads,
+		SegmentSize: p.insertSize.Mean,
+		MaxWindow:   maxWindow,
+		Scoring:     scoring,
+		DeletionOp:  deletionOp(),
+		Policy:      policy,
+		Log:         progress,
+	}
+}
 
-		if sample != nil && !strings.Contains(sample.(string), samplefilter) {
-			continue
-		}
+// deletionOp is the CIGAR operator of -deletion-cigar, 0 if unset
+func deletionOp() byte {
+	if deletionCigar == "" {
+		return 0
+	}
+	return deletionCigar[0]
+}
 
-		var tempSV SV
-		tempSV.Start = int(variant.Pos)
-		endPosition, _ := variant.Info().Get("END")
-		tempSV.End = endPosition.(int)
-		tempSV.Chromosome = variant.Chromosome
+// Organizer functions for each step of the workflow
+func (p *pipeline) extractSignalingReadsMode() error {
+	fmt.Printf("Running extract - Signaling read extraction\n")
+	cfg := p.signalConfig("extract")
+	if err := signal.Extract(cfg, p.inputs, path.Join(workdir, "cluster.bam"), p.cis); err != nil {
+		return err
+	}
+	return signal.SetBreakpointTags(cfg, path.Join(workdir, "cluster.bam"), path.Join(workdir, "cluster_withbp.bam"), p.cis, p.svs)
+}
 
-		if tempSV.Chromosome == "MT" {
-			continue
+func (p *pipeline) votingMode() error {
+	fmt.Printf("Running vote - Breakpoint Voting \n")
+	sortCfg := bamio.SortConfig{
+		TmpDir:    workdir,
+		MemBudget: int64(sortMemory) << 20,
+		RefFile:   refFile,
+		Threads:   threads,
+		Log:       progress,
+	}
+	var records bamio.RecordSource
+	if groupInMemory {
+		groups, err := bamio.GroupByCI(sortCfg, path.Join(workdir, "cluster_withbp.bam"))
+		if err != nil {
+			return err
 		}
-
-		tempSV.Type = svType.(string)
-		tempSV.id = strings.TrimSpace(variant.Id())
-
-		svsize := tempSV.End - tempSV.Start
-
-		svStore.add(tempSV)
-		SVcount++
-
-		var leftInterval Interval
-		if ciPos, err := variant.Info().Get("CIPOS"); err == nil {
-			leftInterval.head = tempSV.Start + ciPos.([]int)[0]
-			leftInterval.tail = tempSV.Start + ciPos.([]int)[1]
-			leftInterval.svId = tempSV.id
-			leftInterval.side = leftCI
-		} else {
-			leftInterval.head = tempSV.Start
-			leftInterval.tail = tempSV.Start
-			leftInterval.svId = tempSV.id
-			leftInterval.side = leftCI
+		records = groups
+	} else {
+		if err := bamio.SortBySVTag(sortCfg, path.Join(workdir, "cluster_withbp.bam"), path.Join(workdir, "sorted.bam")); err != nil {
+			return err
 		}
-
-		var rightInterval Interval
-		if ciEnd, err := variant.Info().Get("CIEND"); err == nil {
-			rightInterval.head = tempSV.End + ciEnd.([]int)[0]
-			rightInterval.tail = tempSV.End + ciEnd.([]int)[1]
-			rightInterval.svId = tempSV.id
-			rightInterval.side = rightCI
-		} else {
-			rightInterval.head = tempSV.End
-			rightInterval.tail = tempSV.End
-			rightInterval.svId = tempSV.id
-			rightInterval.side = rightCI
+		sorted, err := bamio.Open(path.Join(workdir, "sorted.bam"), refFile, threads)
+		if err != nil {
+			return err
 		}
-
-		if svsize < segmentSize+100 {
-			leftInterval.tail += svsize / 2
-			rightInterval.head -= svsize / 2
-		} else {
-			leftInterval.tail += (segmentSize + 100)
-			rightInterval.head -= (segmentSize + 100)
+		defer sorted.Close()
+		records = sorted
+	}
+	clips := vote.NewClips(p.cis, p.svs)
+	if err := vote.SplitReads(records, path.Join(workdir, "votes.txt"), p.cis, clips, policy, readFilter.Pass("vote")); err != nil {
+		return err
+	}
+	cfg := voteConfig
+	cfg.Inserts = p.inserts
+	top, err := vote.Read(path.Join(workdir, "votes.txt"), p.cis, p.svs, cfg)
+	if err != nil {
+		return err
+	}
+	top.Insertions = clips.Insertions(top)
+	if assemble {
+		assembled, err := vote.ReadAssembled(path.Join(workdir, "contigs.bam"), p.cis, policy)
+		if err != nil {
+			return err
 		}
-		leftInterval.head -= 100
-		rightInterval.tail += 100
+		top.SetAssembled(assembled, assemblyTolerance)
+	}
 
-		if leftInterval.head < 0 {
-			leftInterval.head = 1
+	fmt.Printf("Counting reference support\n")
+	loci := top.Loci(p.svs)
+	refs := make([]map[string]signal.RefSupport, len(p.samples))
+	for _, input := range p.inputs {
+		counts, err := signal.CountReference(p.signalConfig("reference"), input.Path, loci)
+		if err != nil {
+			return err
 		}
-		if rightInterval.head < 0 {
-			rightInterval.head = 1
+		if refs[input.Sample] == nil {
+			refs[input.Sample] = counts
+			continue
 		}
-		ciStore.add(svStore, leftInterval)
-		ciStore.add(svStore, rightInterval)
-
-		var copyInterval Interval
-		if filter2 == "DUP:ISP" {
-			if strings.Contains(variant.Alt()[0], "DUP:ISP") {
-				start, _ := variant.Info().Get("POS2")
-				tempSV.copyPos, _ = strconv.Atoi(start.(string))
-				copyInterval.head = tempSV.copyPos - (segmentSize + 100)
-				copyInterval.tail = tempSV.copyPos + (segmentSize + 100)
-				copyInterval.svId = tempSV.id
-				copyInterval.side = copyCI
-
-				if copyInterval.head < 0 {
-					copyInterval.head = 1
-				}
-
-				ciStore.add(svStore, copyInterval)
-			}
+		for id, c := range counts {
+			total := refs[input.Sample][id]
+			refs[input.Sample][id] = signal.RefSupport{Reads: total.Reads + c.Reads, Pairs: total.Pairs + c.Pairs}
 		}
+	}
+	top.SetReference(refs)
+	refined, err := vcf.WriteRefined(vcfFile, path.Join(workdir, "refined.vcf"), refFile, p.svs, top, vcf.Samples{
+		Names:            p.samples,
+		Normal:           p.normal,
+		MaxNormalSupport: maxNormalSupport,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Refined %d SVs\n", refined)
+	return nil
+}
 
+func (p *pipeline) alignmentMode() error {
+	fmt.Printf("Running align - Aligning clusters\n")
+	cfg := p.alignerConfig()
+	if err := aligner.AlignClusters(cfg, path.Join(workdir, "cluster.bam"), path.Join(workdir, "alignment40"), p.svs, p.cis); err != nil {
+		return err
 	}
-	fmt.Printf("Number of CIs / SVs %d / %d\n", len(ciStore.ciList), len(svStore.svMap))
-	fmt.Printf("Total SV count: %d\n", SVcount)
-	return svStore, ciStore
+	return aligner.WriteSupported(cfg, path.Join(workdir, "alignment40.bam"), path.Join(workdir, "supportedSVs.txt"), p.cis, p.svs)
 }
 
-func findAverageSegmentSize(bamFilePath string, thr int, N int) (int, int) {
-	f, _ := os.Open(bamFilePath)
-	defer f.Close()
+// assemblyMode assembles the reads of each CI and split-aligns the contigs
+// against its reference windows
+func (p *pipeline) assemblyMode() error {
+	fmt.Printf("Running assemble - Assembling clusters\n")
+	clusterBamPath := path.Join(workdir, "cluster.bam")
+	cfg := assemblyConfig
+	cfg.RefFile, cfg.Threads, cfg.Policy, cfg.Log = refFile, threads, policy, progress
+	contigs, err := assembly.AssembleClusters(cfg, clusterBamPath, p.cis)
+	if err != nil {
+		return err
+	}
+	bamReader, err := bamio.Open(clusterBamPath, refFile, 1)
+	if err != nil {
+		return err
+	}
+	header := bamReader.Header()
+	bamReader.Close()
+	return aligner.AlignContigs(p.alignerConfig(), contigs, header, path.Join(workdir, "contigs"), p.svs, p.cis)
+}
 
-	bamReader, _ := bam.NewReader(f, *threads)
-	defer bamReader.Close()
+func (p *pipeline) evalMode() error {
+	fmt.Printf("Running eval - Comparing with truth set\n")
+	return eval.CompareWithTruth(eval.Config{
+		ResultFile: path.Join(workdir, "refined.vcf"),
+		TruthFile:  truthFile,
+		Type:       p.svType.FilterName(),
+		Sample:     sample,
+		Margin:     margin,
+		Policy:     policy,
+	})
+}
 
-	i := 0
-	sum := 0
-	for {
-		rec, err := bamReader.Read()
-		if err == io.EOF || i >= N {
-			break
-		}
-		if err != nil {
-			log.Fatalf("error reading bam: %v", err)
+func refineMode(m *Manifest, p *pipeline) error {
+	if err := m.runStep("extract", p.extractSignalingReadsMode); err != nil {
+		return err
+	}
+	if assemble {
+		if err := m.runStep("assemble", p.assemblyMode); err != nil {
+			return err
 		}
-		if rec.Flags&sam.Paired != 0 && rec.Flags&sam.ProperPair != 0 && rec.TempLen > 0 && rec.TempLen < thr {
-			sum += rec.TempLen
-			i++
+	}
+	if err := m.runStep("vote", p.votingMode); err != nil {
+		return err
+	}
+	if err := m.runStep("align", p.alignmentMode); err != nil {
+		return err
+	}
+	if truthFile != "" {
+		if err := p.evalMode(); err != nil {
+			return &sv.StepError{Step: "eval", Err: err}
 		}
 	}
-	f.Close()
-	f, _ = os.Open(bamFilePath)
-	defer f.Close()
+	return nil
+}
 
-	bamReader, _ = bam.NewReader(f, *threads)
-	defer bamReader.Close()
+// command is a brosv subcommand with its own flag set
+type command struct {
+	name     string
+	summary  string
+	needsVcf bool
+	setFlags func(fs *flag.FlagSet)
+	run      func(m *Manifest, p *pipeline) error
+}
 
-	mean := sum / i
-	i = 0
-	sum = 0
-	for {
-		rec, err := bamReader.Read()
-		if err == io.EOF || i >= N {
-			break
+func inputFlags(fs *flag.FlagSet) {
+	fs.StringVar(&vcfFile, "vcf", "", "vcf input file")
+	fs.StringVar(&bamFile, "bam", "", "bam or cram input files, comma separated; bams of one sample (SM) share its column")
+	fs.StringVar(&normalFile, "normal", "", "bam or cram files of the matched normal, comma separated; -bam holds the tumor and breakpoints are voted from it alone")
+	fs.IntVar(&maxNormalSupport, "max-normal-support", 1, "with -normal, filter calls with more normal split reads and discordant pairs than this as GERMLINE")
+	fs.StringVar(&workdir, "workdir", "", "Working directory")
+	fs.IntVar(&threads, "threads", 0, "number of threads to use (0 = auto)")
+	fs.StringVar(&svTypeName, "svtype", "del", "SV type to refine: "+strings.Join(sv.TypeNames(), ", "))
+	fs.BoolVar(&force, "force", false, "discard workdir artifacts made from a different vcf/bam pair")
+	policyFlags(fs)
+	filterFlags(fs)
+}
+
+func filterFlags(fs *flag.FlagSet) {
+	fs.IntVar(&readFilter.MinMapQ, "min-mapq", readFilter.MinMapQ, "skip reads mapped with a lower MAPQ")
+	fs.BoolVar(&readFilter.Duplicates, "skip-dup", readFilter.Duplicates, "skip reads flagged as PCR or optical duplicates")
+	fs.BoolVar(&readFilter.QCFail, "skip-qcfail", readFilter.QCFail, "skip reads failing platform/vendor quality checks")
+	fs.BoolVar(&readFilter.Secondary, "skip-secondary", readFilter.Secondary, "skip secondary alignments")
+	fs.IntVar(&readFilter.MinClip, "min-clip", readFilter.MinClip, "shortest clip in bp taken as a split")
+	fs.Float64Var(&readFilter.MaxMismatchRate, "max-mismatch-rate", readFilter.MaxMismatchRate, "skip reads with more NM per aligned base (0 = no limit)")
+}
+
+func policyFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&policy.Strict, "strict", true, "abort on malformed records")
+	fs.BoolVar(&lenient, "lenient", false, "skip malformed records with a warning (overrides -strict)")
+}
+
+func voteFlags(fs *flag.FlagSet) {
+	fs.IntVar(&sortMemory, "sort-mem", 768, "memory budget in MB for sorting reads by SV tag; larger inputs spill to the workdir")
+	fs.BoolVar(&groupInMemory, "in-memory", false, "group reads by CI in memory instead of writing sorted.bam")
+	fs.Float64Var(&voteConfig.CIFraction, "ci-fraction", voteConfig.CIFraction, "fraction of the split read votes, or of the paired-end posterior without them, the refined CIPOS/CIEND hold")
+	fs.IntVar(&voteConfig.ModeGap, "mode-gap", voteConfig.ModeGap, "voted positions further apart than this many bp belong to different modes")
+	fs.Float64Var(&voteConfig.ModeRatio, "mode-ratio", voteConfig.ModeRatio, "flag a breakpoint MULTIMODAL when a second mode holds this fraction of the votes of the top one")
+}
+
+func assembleFlags(fs *flag.FlagSet) {
+	fs.IntVar(&assemblyConfig.K, "assembly-k", assemblyConfig.K, "k-mer length of the local assembly graph")
+	fs.IntVar(&assemblyConfig.MinCoverage, "assembly-min-coverage", assemblyConfig.MinCoverage, "k-mers seen in fewer reads are dropped as errors")
+	fs.IntVar(&assemblyConfig.MinLength, "assembly-min-length", assemblyConfig.MinLength, "shortest contig kept")
+}
+
+// assembledFlags are the flags of the steps using the assembled breakpoints
+func assembledFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&assemble, "assemble", false, "also place breakpoints with contigs assembled from the reads of each CI, written as ASMPOS/ASMEND next to the voted ones")
+	fs.IntVar(&assemblyTolerance, "assembly-tolerance", 5, "flag SVs ASMDISAGREE when assembled and voted breakpoints are further apart than this many bp")
+}
+
+func alignFlags(fs *flag.FlagSet) {
+	fs.IntVar(&maxWindow, "max-window", aligner.DefaultMaxWindow, "largest reference window in bp a read is split-aligned against; larger CIs are malformed")
+	fs.StringVar(&scoringName, "scoring", "illumina", "split aligner scoring: "+strings.Join(aligner.ScoringNames(), ", ")+", or custom match,mismatch,gapopen,gapextend")
+	fs.Float64Var(&minIdentity, "min-identity", 0, "identity both parts of a split alignment must reach (0 = from -scoring)")
+	fs.BoolVar(&qualityAware, "qual", false, "scale mismatch penalties down at low quality read bases")
+	fs.StringVar(&deletionCigar, "deletion-cigar", "", "write reads split across a deletion as one record spanning it with this CIGAR operator (D or N) instead of primary and supplementary records")
+}
+
+func refFlag(fs *flag.FlagSet) {
+	fs.StringVar(&refFile, "ref", "", "reference file (also used to decode CRAM input)")
+}
+
+func evalFlags(fs *flag.FlagSet) {
+	fs.StringVar(&truthFile, "truth", "", "truth set (.bed or .vcf) to compare against")
+	fs.StringVar(&sample, "sample", "", "sample name filter for the truth set")
+	fs.IntVar(&margin, "margin", 0, "number of error bp allowed (0 = auto)")
+}
+
+var commands = []command{
+	{
+		name:     "extract",
+		summary:  "extract signaling reads in confidence intervals and tag their breakpoints",
+		needsVcf: true,
+		setFlags: func(fs *flag.FlagSet) { inputFlags(fs); refFlag(fs) },
+		run: func(m *Manifest, p *pipeline) error {
+			return m.runStep("extract", p.extractSignalingReadsMode)
+		},
+	},
+	{
+		name:     "assemble",
+		summary:  "assemble the reads of each CI and split-align the contigs against the reference",
+		needsVcf: true,
+		setFlags: func(fs *flag.FlagSet) { inputFlags(fs); refFlag(fs); alignFlags(fs); assembleFlags(fs) },
+		run: func(m *Manifest, p *pipeline) error {
+			if err := m.requireStep("extract"); err != nil {
+				return err
+			}
+			return m.runStep("assemble", p.assemblyMode)
+		},
+	},
+	{
+		name:     "vote",
+		summary:  "vote breakpoint locations and write refined.vcf",
+		needsVcf: true,
+		setFlags: func(fs *flag.FlagSet) { inputFlags(fs); refFlag(fs); voteFlags(fs); assembledFlags(fs) },
+		run: func(m *Manifest, p *pipeline) error {
+			if err := m.requireStep("extract"); err != nil {
+				return err
+			}
+			if assemble {
+				if err := m.requireStep("assemble"); err != nil {
+					return err
+				}
+			}
+			return m.runStep("vote", p.votingMode)
+		},
+	},
+	{
+		name:     "align",
+		summary:  "split-align clustered reads against the reference",
+		needsVcf: true,
+		setFlags: func(fs *flag.FlagSet) { inputFlags(fs); refFlag(fs); alignFlags(fs) },
+		run: func(m *Manifest, p *pipeline) error {
+			if err := m.requireStep("extract"); err != nil {
+				return err
+			}
+			return m.runStep("align", p.alignmentMode)
+		},
+	},
+	{
+		name:     "refine",
+		summary:  "run the full pipeline: extract, vote and align (assemble with -assemble, eval with -truth)",
+		needsVcf: true,
+		setFlags: func(fs *flag.FlagSet) {
+			inputFlags(fs)
+			refFlag(fs)
+			voteFlags(fs)
+			assembledFlags(fs)
+			alignFlags(fs)
+			assembleFlags(fs)
+			evalFlags(fs)
+		},
+		run: refineMode,
+	},
+	{
+		name:    "eval",
+		summary: "compare workdir/refined.vcf with a truth set",
+		setFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&workdir, "workdir", "", "Working directory")
+			fs.StringVar(&svTypeName, "svtype", "del", "SV type to evaluate: "+strings.Join(sv.TypeNames(), ", "))
+			evalFlags(fs)
+			policyFlags(fs)
+		},
+		run: func(_ *Manifest, p *pipeline) error {
+			return p.evalMode()
+		},
+	},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: brosv <command> [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'brosv <command> -help' for the flags of a command.\n")
+}
+
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
 		}
+	}
+	return nil
+}
+
+// loadSamples names the sample column of every bam by the SM of its read
+// groups; bams of the same sample share its column. With -normal only the
+// tumor columns vote.
+func (p *pipeline) loadSamples() error {
+	columns := make(map[string]int)
+	firstNormal := len(bamFiles) - len(normalFiles)
+	for i, bamFilePath := range bamFiles {
+		bamReader, err := bamio.Open(bamFilePath, refFile, 1)
 		if err != nil {
-			log.Fatalf("error reading bam: %v", err)
+			return err
 		}
-		if rec.Flags&sam.Paired != 0 && rec.Flags&sam.ProperPair != 0 && rec.TempLen > 0 && rec.TempLen < thr {
-			sum += (rec.TempLen - mean) * (rec.TempLen - mean)
-			i++
+		name := bamReader.Sample(bamFilePath)
+		bamReader.Close()
+		isNormal := i >= firstNormal
+		column, ok := columns[name]
+		if !ok {
+			column = len(p.samples)
+			columns[name] = column
+			p.samples = append(p.samples, name)
+			p.normal = append(p.normal, isNormal)
+		} else if p.normal[column] != isNormal {
+			return fmt.Errorf("sample %s is in both the tumor and the normal bams", name)
 		}
+		p.inputs = append(p.inputs, signal.Input{Path: bamFilePath, Sample: column})
 	}
-	variance := int(math.Sqrt(float64(sum / i)))
-	return mean, variance
-}
-
-func linkLeftRightCIs(svStore SVStore, ciStore CIStore) {
-	leftCIs = make(map[string]int)
-	rightCIs = make(map[string]int)
-	copyCIs = make(map[string]int)
-
-	for i, interval := range ciStore.ciList {
-		if interval.side == leftCI {
-			leftCIs[interval.svId] = i
-		} else if interval.side == rightCI {
-			rightCIs[interval.svId] = i
-		} else {
-			copyCIs[interval.svId] = i
+	fmt.Printf("%d bams of %d samples: %s\n", len(p.inputs), len(p.samples), strings.Join(p.samples, ", "))
+	if len(normalFiles) > 0 {
+		voteConfig.Voting = make(map[int]bool)
+		for column, isNormal := range p.normal {
+			if !isNormal {
+				voteConfig.Voting[column] = true
+			}
 		}
 	}
+	return nil
 }
 
-// Organizer functions for each step of the workflow
-func extractSignalingReadsMode(svType SVType) {
-	fmt.Printf("Running in mode 1 - Signaling read extraction\n")
-	extractSignalingInCI(*bamFile, path.Join(*workdir, "cluster.bam"), ciStore, svType)
-	setBreakpointTags(path.Join(*workdir, "cluster.bam"), *workdir, ciStore)
-}
+// loadInputs names the samples, estimates the insert size and loads the
+// SVs and CIs of the vcf
+func (p *pipeline) loadInputs(m *Manifest) error {
+	if err := p.loadSamples(); err != nil {
+		return err
+	}
+	m.Params["svtype"] = strings.ToLower(svTypeName)
+	m.flags = map[string]string{
+		"ciFraction":          strconv.FormatFloat(voteConfig.CIFraction, 'g', -1, 64),
+		"modeGap":             strconv.Itoa(voteConfig.ModeGap),
+		"modeRatio":           strconv.FormatFloat(voteConfig.ModeRatio, 'g', -1, 64),
+		"normalBams":          strconv.Itoa(len(normalFiles)),
+		"maxNormalSupport":    strconv.Itoa(maxNormalSupport),
+		"maxWindow":           strconv.Itoa(maxWindow),
+		"assemblyK":           strconv.Itoa(assemblyConfig.K),
+		"assemblyMinCoverage": strconv.Itoa(assemblyConfig.MinCoverage),
+		"assemblyMinLength":   strconv.Itoa(assemblyConfig.MinLength),
+		"assemble":            strconv.FormatBool(assemble),
+		"assemblyTolerance":   strconv.Itoa(assemblyTolerance),
+		"scoring":             scoring.String(),
+		"deletionCigar":       deletionCigar,
+	}
+	if m.Params["readFilter"] != readFilter.String() {
+		// the insert size was estimated from the reads of another filter
+		delete(m.Params, "segmentSize")
+		delete(m.Params, "variance")
+		m.Params["readFilter"] = readFilter.String()
+	}
 
-func votingMode(strType string, sample string) {
-	fmt.Printf("Running in mode 2 - Breakpoint Voting \n")
-	cmd := exec.Command("samtools", "sort", "-t", "SV", path.Join(*workdir, "cluster_withbp.bam"), "-o", path.Join(*workdir, "sorted.bam"))
-	cmd.Run()
-	calculateSplitReadSupport(path.Join(*workdir, "sorted.bam"), path.Join(*workdir, "votes.txt"), ciStore, svStore)
-	writeRefinedVcf(path.Join(*workdir, "votes.txt"), path.Join(*workdir, "refined.vcf"), *refFile, ciStore, svStore)
-	compareWithTruth(path.Join(*workdir, "refined.vcf"), "data/simu/del_true_all.bed", strType, sample, ciStore)
+	// the histograms of a previous run are kept next to its manifest
+	insertFile := path.Join(workdir, "insertsize.txt")
+	_, _, ok := m.segmentSize()
+	var err error
+	if ok {
+		p.inserts, err = signal.ReadInsertSizes(insertFile)
+		ok = err == nil
+		for rg := range p.inserts.ByGroup {
+			// read groups of bams the workdir no longer has
+			ok = ok && rg.Bam < len(bamFiles)
+		}
+	}
+	if !ok {
+		p.inserts, err = signal.EstimateInsertSize(p.signalConfig("insert size"), bamFiles, 1000000)
+		if err != nil {
+			return err
+		}
+		if err := signal.WriteInsertSizes(insertFile, p.inserts); err != nil {
+			return err
+		}
+		if err := m.setSegmentSize(p.inserts.All.Mean, p.inserts.All.SD); err != nil {
+			return err
+		}
+	}
+	p.insertSize = p.inserts.All
+	size := p.insertSize.Mean
+	fmt.Printf("Segment size = %d  SD = %d  (median and MAD of %d pairs)\n", size, p.insertSize.SD, p.insertSize.Pairs())
+	for rg, insertSize := range p.inserts.ByGroup {
+		fmt.Printf("  read group %s of %s: %d  SD = %d\n", rg.Name, bamFiles[rg.Bam], insertSize.Mean, insertSize.SD)
+	}
 
+	p.svs, p.cis, err = vcf.Load(vcfFile, vcf.LoadConfig{
+		Type:        p.svType,
+		SegmentSize: size,
+		Policy:      policy,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Number of CIs / SVs %d / %d\n", p.cis.Len(), p.svs.Len())
+	return nil
 }
 
 func main() {
-	flag.Parse()
-	if *help {
-		flag.Usage()
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	switch os.Args[1] {
+	case "help", "-help", "--help", "-h":
+		usage()
 		os.Exit(0)
 	}
 
-	svTag = sam.NewTag("SV")
-	lbpTag = sam.NewTag("LBP")
-	rbpTag = sam.NewTag("RBP")
-	copyTag = sam.NewTag("CPY")
+	cmd := findCommand(os.Args[1])
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
 
-	svType := del
+	fs := flag.NewFlagSet("brosv "+cmd.name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: brosv %s [flags]\n\n%s\n\nFlags:\n", cmd.name, cmd.summary)
+		fs.PrintDefaults()
+	}
+	cmd.setFlags(fs)
+	fs.Parse(os.Args[2:])
 
-	var strType string
-	if svType == del {
-		strType = "DEL"
-	} else if svType == inv {
-		strType = "INV"
-	} else if svType == ins {
-		strType = "INS"
-	} else if svType == tandup {
-		strType = "tandup"
-	} else if svType == intdup {
-		strType = "intdup"
+	svType, err := sv.ParseType(svTypeName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if scoringName != "" {
+		scoring, err = aligner.ParseScoring(scoringName)
+		if err == nil && minIdentity != 0 {
+			scoring.MinIdentity = minIdentity
+			err = scoring.Validate()
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		scoring.QualityAware = qualityAware
+	}
+	if deletionCigar != "" && deletionCigar != "D" && deletionCigar != "N" {
+		fmt.Fprintf(os.Stderr, "-deletion-cigar must be D or N, not %q\n", deletionCigar)
+		os.Exit(2)
+	}
+	if threads <= 0 {
+		threads = runtime.NumCPU()
+	}
+	if lenient {
+		policy.Strict = false
+	}
+	bamFiles = strings.Split(bamFile, ",")
+	if normalFile != "" {
+		normalFiles = strings.Split(normalFile, ",")
+		bamFiles = append(bamFiles, normalFiles...)
 	}
 
-	segmentSize, variance = findAverageSegmentSize(*bamFile, 1000, 1000000)
-	fmt.Printf("Segment size = %d  Variance = %d\n", segmentSize, variance)
-	if svType == all {
-		svStore, ciStore = readVcf(*vcfFile)
-	} else {
-		svStore, ciStore = readVcfFiltered(*vcfFile, strType, "")
+	p := &pipeline{svType: svType}
+	var m *Manifest
+	if cmd.needsVcf {
+		m, err = openManifest(workdir, force)
+		if err == nil {
+			err = p.loadInputs(m)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "brosv %s: %v\n", cmd.name, err)
+			os.Exit(1)
+		}
 	}
-	linkLeftRightCIs(svStore, ciStore)
 
 	/*
-		writeCIstobed(path.Join(*workdir, "cifile.csv"), ciStore, strType)
+		eval.WriteCIsToBed(path.Join(workdir, "cifile.csv"), p.svs, p.cis, strType)
 		return
-		compareWithTruth("data/simu/lumpy_30x.vcf", "data/simu/del_true_all.bed", "del", "", ciStore)
+		eval.CompareWithTruth(eval.Config{ResultFile: "data/simu/lumpy_30x.vcf", TruthFile: "data/simu/del_true_all.bed", Type: "del"})
 		return
 	*/
 
-	switch *mode {
-	case 1:
-		extractSignalingReadsMode(svType)
-	case 2:
-		votingMode(strType, "")
-	case 3:
-		alignmentMode()
-	default:
-		extractSignalingReadsMode(svType)
-		votingMode(strType, "")
+	err = cmd.run(m, p)
+	if skipped := policy.Skipped(); skipped > 0 {
+		fmt.Fprintf(os.Stderr, "Skipped %d malformed records\n", skipped)
+	}
+	if rejected := readFilter.Report(); rejected != "" {
+		fmt.Fprintf(os.Stderr, "Filtered reads: %s\n", rejected)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "brosv %s: %v\n", cmd.name, err)
+		os.Exit(1)
 	}
-
 }
 
 /*
-	./brosv-go -vcf data/tardis_40x.vcf -bam data/cnv_1200_40x.bam -ref data/human_g1k_v37.fasta -threads 8 -margin 5 -mode 2 -workdir dels/
+	./brosv-go refine -vcf data/tardis_40x.vcf -bam data/cnv_1200_40x.bam -ref data/human_g1k_v37.fasta -threads 8 -workdir dels/
+	./brosv-go eval -workdir dels/ -truth data/simu/del_true_all.bed -margin 5
 */
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/balanur/brosv-go/bamio"
+	"github.com/balanur/brosv-go/sv"
+)
+
+const manifestName = "manifest.json"
+
+// large inputs (bam, reference) are hashed in sampleChunks chunks of
+// sampleChunk bytes spaced evenly from the head to the tail of the file
+const (
+	sampleChunk  = 1 << 20
+	sampleChunks = 16
+)
+
+// FileChecksum identifies an input file by size and content hash.
+// Sampled checksums hash sampleChunks chunks spread across the file, so a
+// re-sorted or re-filtered bam of the same size still differs.
+type FileChecksum struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	Sha256  string `json:"sha256"`
+	Sampled bool   `json:"sampled"`
+}
+
+// StepState is the completion state of a pipeline step and the parameters
+// it ran with
+type StepState struct {
+	Done        bool              `json:"done"`
+	Fingerprint string            `json:"fingerprint"`
+	Outputs     []string          `json:"outputs"`
+	Params      map[string]string `json:"params,omitempty"`
+	Finished    time.Time         `json:"finished"`
+}
+
+// Manifest records the inputs, shared parameters and finished steps of a
+// workdir. Params holds the settings every step depends on: the SV type,
+// the read filter and the insert size estimated with it.
+type Manifest struct {
+	Vcf FileChecksum `json:"vcf"`
+	Bam FileChecksum `json:"bam"`
+	// bams after the first of a multi-sample run
+	OtherBams []FileChecksum       `json:"otherBams,omitempty"`
+	Ref       FileChecksum         `json:"ref"`
+	Params    map[string]string    `json:"params"`
+	Steps     map[string]StepState `json:"steps"`
+
+	path string
+	// parameters of the steps given on this command line
+	flags map[string]string
+	// some input is CRAM, decoded with the reference
+	cram bool
+}
+
+// pipelineStep is a step of the pipeline with the files it writes into the
+// workdir, the parameters it reads and the steps whose outputs it reads.
+// A step in when is only read with the parameter it names set to true.
+type pipelineStep struct {
+	name    string
+	outputs []string
+	params  []string
+	after   []string
+	when    map[string]string
+}
+
+// pipeline steps in execution order
+var pipelineSteps = []pipelineStep{
+	{name: "extract", outputs: []string{"cluster.bam", "cluster_withbp.bam"}},
+	{name: "assemble", outputs: []string{"contigs.bam", "contigs.bam.bai"},
+		params: []string{"assemblyK", "assemblyMinCoverage", "assemblyMinLength", "maxWindow", "scoring"},
+		after:  []string{"extract"}},
+	{name: "vote", outputs: []string{"votes.txt", "refined.vcf"},
+		params: []string{"ciFraction", "modeGap", "modeRatio", "normalBams", "maxNormalSupport", "assemble", "assemblyTolerance"},
+		after:  []string{"extract", "assemble"}, when: map[string]string{"assemble": "assemble"}},
+	{name: "align", outputs: []string{"alignment40.bam", "alignment40.bam.bai", "supportedSVs.txt"},
+		params: []string{"maxWindow", "scoring", "deletionCigar"},
+		after:  []string{"extract"}},
+}
+
+func findStep(name string) pipelineStep {
+	for _, s := range pipelineSteps {
+		if s.name == name {
+			return s
+		}
+	}
+	panic("unknown pipeline step " + name)
+}
+
+// upstream returns the steps whose outputs s reads when run with params
+func (s pipelineStep) upstream(params map[string]string) []string {
+	var result []string
+	for _, step := range s.after {
+		if param, ok := s.when[step]; ok && params[param] != "true" {
+			continue
+		}
+		result = append(result, step)
+	}
+	return result
+}
+
+func checksumFile(filePath string, sampled bool) (FileChecksum, error) {
+	result := FileChecksum{Path: filePath, Sampled: sampled}
+	if filePath == "" {
+		return result, nil
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return result, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return result, err
+	}
+	result.Size = info.Size()
+
+	h := sha256.New()
+	if !sampled || result.Size <= sampleChunks*sampleChunk {
+		result.Sampled = false
+		if _, err := io.Copy(h, f); err != nil {
+			return result, err
+		}
+	} else {
+		chunk := make([]byte, sampleChunk)
+		for i := int64(0); i < sampleChunks; i++ {
+			offset := i * (result.Size - sampleChunk) / (sampleChunks - 1)
+			if _, err := f.ReadAt(chunk, offset); err != nil {
+				return result, err
+			}
+			h.Write(chunk)
+		}
+	}
+	result.Sha256 = hex.EncodeToString(h.Sum(nil))
+	return result, nil
+}
+
+func (c FileChecksum) matches(other FileChecksum) bool {
+	return c.Size == other.Size && c.Sampled == other.Sampled && c.Sha256 == other.Sha256
+}
+
+func sameChecksums(a []FileChecksum, b []FileChecksum) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].matches(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// openManifest loads the manifest of the workdir and checks it against the
+// current inputs. Artifacts of a different vcf/bam pair are never reused:
+// unless force is set, such a workdir is rejected.
+func openManifest(dir string, force bool) (*Manifest, error) {
+	if dir == "" {
+		dir = "."
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	vcfSum, err := checksumFile(vcfFile, false)
+	if err != nil {
+		return nil, err
+	}
+	bamSum, err := checksumFile(bamFiles[0], true)
+	if err != nil {
+		return nil, err
+	}
+	var otherSums []FileChecksum
+	for _, other := range bamFiles[1:] {
+		sum, err := checksumFile(other, true)
+		if err != nil {
+			return nil, err
+		}
+		otherSums = append(otherSums, sum)
+	}
+	refSum, err := checksumFile(refFile, true)
+	if err != nil {
+		return nil, err
+	}
+	cram := false
+	for _, bamFilePath := range bamFiles {
+		format, err := bamio.DetectFormat(bamFilePath)
+		if err != nil {
+			return nil, err
+		}
+		cram = cram || format == bamio.CRAM
+	}
+
+	m := &Manifest{path: path.Join(dir, manifestName), cram: cram}
+	data, err := os.ReadFile(m.path)
+	if err == nil {
+		if err := json.Unmarshal(data, m); err != nil {
+			return nil, fmt.Errorf("corrupt manifest %s: %v", m.path, err)
+		}
+		if !m.Vcf.matches(vcfSum) || !m.Bam.matches(bamSum) || !sameChecksums(m.OtherBams, otherSums) {
+			if !force {
+				return nil, fmt.Errorf("workdir %s holds artifacts of vcf %s / bam %s; use another -workdir or -force to discard them",
+					dir, m.Vcf.Path, m.Bam.Path)
+			}
+			fmt.Printf("Discarding artifacts of vcf %s / bam %s\n", m.Vcf.Path, m.Bam.Path)
+			m.Steps = nil
+			m.Params = nil
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if cram && m.Params != nil && !m.Ref.matches(refSum) {
+		// the insert size was estimated from reads decoded with another
+		// reference
+		delete(m.Params, "segmentSize")
+		delete(m.Params, "variance")
+	}
+	m.Vcf, m.Bam, m.OtherBams, m.Ref = vcfSum, bamSum, otherSums, refSum
+	if m.Steps == nil {
+		m.Steps = make(map[string]StepState)
+	}
+	if m.Params == nil {
+		m.Params = make(map[string]string)
+	}
+	return m, m.save()
+}
+
+func (m *Manifest) save() error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.path)
+}
+
+// segmentSize returns the insert size recorded for the current bam, if any
+func (m *Manifest) segmentSize() (int, int, bool) {
+	size, err1 := strconv.Atoi(m.Params["segmentSize"])
+	vari, err2 := strconv.Atoi(m.Params["variance"])
+	return size, vari, err1 == nil && err2 == nil
+}
+
+func (m *Manifest) setSegmentSize(size int, vari int) error {
+	m.Params["segmentSize"] = strconv.Itoa(size)
+	m.Params["variance"] = strconv.Itoa(vari)
+	return m.save()
+}
+
+// stepParams returns the parameters of step given on this command line
+func (m *Manifest) stepParams(step string) map[string]string {
+	params := make(map[string]string)
+	for _, param := range findStep(step).params {
+		params[param] = m.flags[param]
+	}
+	return params
+}
+
+// fingerprint of a step run with params covers the inputs and shared
+// parameters, the parameters the step reads and the fingerprints of the
+// steps whose outputs it reads
+func (m *Manifest) fingerprint(step string, params map[string]string) string {
+	s := findStep(step)
+	h := sha256.New()
+	fmt.Fprintf(h, "vcf=%s\nbam=%s\nsvtype=%s\n", m.Vcf.Sha256, m.Bam.Sha256, m.Params["svtype"])
+	for _, other := range m.OtherBams {
+		fmt.Fprintf(h, "bam=%s\n", other.Sha256)
+	}
+	fmt.Fprintf(h, "readFilter=%s\nsegmentSize=%s\nvariance=%s\n", m.Params["readFilter"], m.Params["segmentSize"], m.Params["variance"])
+	fmt.Fprintf(h, "step=%s\n", s.name)
+	// extract only reads the reference to decode CRAM input
+	if s.name != "extract" || m.cram {
+		fmt.Fprintf(h, "ref=%s\n", m.Ref.Sha256)
+	}
+	for _, param := range s.params {
+		fmt.Fprintf(h, "%s=%s\n", param, params[param])
+	}
+	for _, up := range s.upstream(params) {
+		fmt.Fprintf(h, "after %s=%s\n", up, m.Steps[up].Fingerprint)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// finished reports whether step ran with params on the current inputs,
+// after steps that are themselves still finished, and its outputs still
+// exist
+func (m *Manifest) finished(step string, params map[string]string) bool {
+	state, ok := m.Steps[step]
+	if !ok || !state.Done || state.Fingerprint != m.fingerprint(step, params) {
+		return false
+	}
+	for _, out := range state.Outputs {
+		if _, err := os.Stat(path.Join(path.Dir(m.path), out)); err != nil {
+			return false
+		}
+	}
+	for _, up := range findStep(step).upstream(params) {
+		if !m.finished(up, m.Steps[up].Params) {
+			return false
+		}
+	}
+	return true
+}
+
+// upToDate reports whether step finished with the parameters of this run
+func (m *Manifest) upToDate(step string) bool {
+	return m.finished(step, m.stepParams(step))
+}
+
+// invalidate marks step and every finished step that read its outputs as
+// not done
+func (m *Manifest) invalidate(step string) error {
+	stale := map[string]bool{step: true}
+	for _, s := range pipelineSteps {
+		for _, up := range s.upstream(m.Steps[s.name].Params) {
+			if stale[up] {
+				stale[s.name] = true
+			}
+		}
+	}
+	for name := range stale {
+		delete(m.Steps, name)
+	}
+	return m.save()
+}
+
+// runStep runs fn unless step is already up to date
+func (m *Manifest) runStep(step string, fn func() error) error {
+	if m.upToDate(step) {
+		fmt.Printf("Skipping %s (up to date in %s)\n", step, path.Dir(m.path))
+		return nil
+	}
+	if err := m.invalidate(step); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		return &sv.StepError{Step: step, Err: err}
+	}
+	params := m.stepParams(step)
+	m.Steps[step] = StepState{
+		Done:        true,
+		Fingerprint: m.fingerprint(step, params),
+		Outputs:     findStep(step).outputs,
+		Params:      params,
+		Finished:    time.Now(),
+	}
+	return m.save()
+}
+
+// requireStep fails unless step finished on the current inputs, with the
+// parameters it ran with
+func (m *Manifest) requireStep(step string) error {
+	state := m.Steps[step]
+	if !m.finished(step, state.Params) {
+		return fmt.Errorf("step %s has not completed for the current inputs in %s; run it first or use refine", step, path.Dir(m.path))
+	}
+	return nil
+}
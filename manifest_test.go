@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+// testManifest is a manifest of an empty workdir with the default
+// parameters of every step
+func testManifest(t *testing.T) *Manifest {
+	return &Manifest{
+		Params: map[string]string{"svtype": "del", "segmentSize": "300", "variance": "30"},
+		Steps:  make(map[string]StepState),
+		path:   path.Join(t.TempDir(), manifestName),
+		flags: map[string]string{
+			"ciFraction": "0.95", "modeGap": "10", "assemble": "false",
+			"maxWindow": "10000", "scoring": "illumina", "assemblyK": "31",
+		},
+	}
+}
+
+// run runs step, writing its outputs, and fails unless it ran when want
+func run(t *testing.T, m *Manifest, step string, want bool) {
+	t.Helper()
+	ran := false
+	err := m.runStep(step, func() error {
+		ran = true
+		for _, out := range findStep(step).outputs {
+			if err := os.WriteFile(path.Join(path.Dir(m.path), out), nil, 0644); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ran != want {
+		t.Fatalf("%s ran: %v, want %v", step, ran, want)
+	}
+}
+
+func TestStepsDependOnTheirOwnParams(t *testing.T) {
+	m := testManifest(t)
+	run(t, m, "extract", true)
+	m.flags["ciFraction"] = "0.5"
+	run(t, m, "vote", true)
+	run(t, m, "align", true)
+
+	// align run with the default vote flags leaves the tuned vote alone
+	m.flags["ciFraction"] = "0.95"
+	run(t, m, "align", false)
+	if !m.finished("vote", m.Steps["vote"].Params) {
+		t.Error("vote went stale after align")
+	}
+
+	// rerunning align does not drop vote
+	m.flags["maxWindow"] = "5000"
+	run(t, m, "align", true)
+	if _, ok := m.Steps["vote"]; !ok {
+		t.Error("align invalidated vote")
+	}
+
+	// a new extract leaves both stale
+	m.Params["readFilter"] = "mapq=20"
+	if m.requireStep("vote") == nil || m.requireStep("align") == nil {
+		t.Error("vote and align still finished after the read filter changed")
+	}
+}
+
+func TestExtractDependsOnTheReferenceOfCRAM(t *testing.T) {
+	for _, cram := range []bool{false, true} {
+		m := testManifest(t)
+		m.cram = cram
+		m.Ref.Sha256 = "ref1"
+		run(t, m, "extract", true)
+		m.Ref.Sha256 = "ref2"
+		if got := m.upToDate("extract"); got == cram {
+			t.Errorf("extract of CRAM %v up to date after the reference changed: %v", cram, got)
+		}
+	}
+}
+
+func TestVoteUsesRecordedAssembly(t *testing.T) {
+	m := testManifest(t)
+	run(t, m, "extract", true)
+	m.flags["assemblyK"] = "25"
+	run(t, m, "assemble", true)
+
+	// vote -assemble checks the assembly it reads by the k it ran with,
+	// not the default of this command line
+	m.flags["assemblyK"] = "31"
+	m.flags["assemble"] = "true"
+	if err := m.requireStep("assemble"); err != nil {
+		t.Fatal(err)
+	}
+	run(t, m, "vote", true)
+	run(t, m, "vote", false)
+
+	// a new assembly leaves the vote that read the old one stale
+	run(t, m, "assemble", true)
+	if _, ok := m.Steps["vote"]; ok {
+		t.Error("vote still recorded after a new assembly")
+	}
+
+	// without -assemble vote does not read the assembly
+	m.flags["assemble"] = "false"
+	run(t, m, "vote", true)
+	m.flags["assemblyK"] = "21"
+	run(t, m, "assemble", true)
+	if !m.finished("vote", m.Steps["vote"].Params) {
+		t.Error("vote without -assemble went stale after a new assembly")
+	}
+}
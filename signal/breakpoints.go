@@ -0,0 +1,204 @@
+package signal
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/balanur/brosv-go/bamio"
+	"github.com/balanur/brosv-go/interval"
+	"github.com/balanur/brosv-go/sv"
+	"github.com/biogo/hts/sam"
+)
+
+// SetBreakpointTags copies the extracted reads of bamFilePath with the
+// breakpoint each votes for set in the LBP, RBP or CPY tag of its CI side.
+// A split read whose supplementary alignment falls in another CI of the
+// SV carries the tag of that side too.
+// Discordant reads facing the breakpoint, with their mate in the other CI
+// of the SV, are copied with the DP tag instead.
+func SetBreakpointTags(cfg Config, bamFilePath string, outputBamFilePath string, cis *interval.Store, svs *sv.Store) error {
+	bamReader, err := bamio.Open(bamFilePath, cfg.RefFile, cfg.Threads)
+	if err != nil {
+		return err
+	}
+	defer bamReader.Close()
+
+	out, err := bamio.Create(outputBamFilePath, bamReader.Header())
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	readIndex := 0
+	for {
+		rec, err := bamReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return &sv.FileError{Op: "read", File: bamFilePath, Err: err}
+		}
+
+		ciIndex, err := bamio.TagValue(rec, bamio.SVTag)
+		if err == nil && !cis.Valid(ciIndex) {
+			err = fmt.Errorf("no CI %d", ciIndex)
+		}
+		if err != nil {
+			if err := cfg.Policy.Malformed(sv.ReadError(bamFilePath, rec, -1, err)); err != nil {
+				return err
+			}
+			continue
+		}
+		currentCI := cis.Get(ciIndex)
+		call := svs.Get(currentCI.SVID)
+
+		// a read votes at the end of its alignment where it is split from
+		// its supplementary alignment or, without one, clipped the longest
+		own, other, split := splitJunction(rec)
+		clips := ClippingOf(rec.Cigar)
+		if !split {
+			own = Breakend{Chr: rec.Ref.Name(), Pos: rec.Pos, Strand: '-'}
+			if clips.End > clips.Start {
+				own = Breakend{Chr: rec.Ref.Name(), Pos: rec.End(), Strand: '+'}
+			}
+		}
+		clippedEnd := own.Strand == '+'
+		significant := matched(rec.Cigar) >= 10 && (split || clips.Longest() >= cfg.Filter.MinClip)
+		if call.Type == "BND" && significant {
+			// a '+' breakend takes reads clipped at their end, a '-'
+			// breakend reads clipped at their start
+			significant = clippedEnd == (call.Strand(currentCI.Side) == '+')
+		}
+		if !significant && facesBreakpoint(rec, call, currentCI, cis, cfg.InsertSize) {
+			newAux, err := sam.NewAux(bamio.PairTag, 1)
+			if err != nil {
+				return sv.ReadError(outputBamFilePath, rec, ciIndex, err)
+			}
+			rec.AuxFields = append(rec.AuxFields, newAux)
+			if err := out.Write(rec); err != nil {
+				return err
+			}
+			rec.AuxFields = rec.AuxFields[:len(rec.AuxFields)-1]
+		}
+
+		// eliminate insignificant splits
+		if significant {
+			if call.Type == "DEL" {
+				if clippedEnd && currentCI.Side == interval.Right {
+					continue
+				}
+				if !clippedEnd && currentCI.Side == interval.Left {
+					continue
+				}
+			}
+			tags := []sam.Aux{}
+			newAux, err := sam.NewAux(bamio.BreakpointTag(currentCI.Side), own.Pos)
+			if err != nil {
+				return sv.ReadError(outputBamFilePath, rec, ciIndex, err)
+			}
+			tags = append(tags, newAux)
+			// a split read joining two CIs of the SV votes for both
+			// breakpoints at once, from its primary record only
+			if otherSide, ok := junctionSide(cis, currentCI, other); split && ok {
+				if rec.Flags&sam.Supplementary != 0 {
+					continue
+				}
+				otherAux, err := sam.NewAux(bamio.BreakpointTag(otherSide), other.Pos)
+				if err != nil {
+					return sv.ReadError(outputBamFilePath, rec, ciIndex, err)
+				}
+				tags = append(tags, otherAux)
+			}
+			n := len(rec.AuxFields)
+			rec.AuxFields = append(rec.AuxFields, tags...)
+			if err := out.Write(rec); err != nil {
+				return err
+			}
+			rec.AuxFields = rec.AuxFields[:n]
+		}
+		readIndex++
+		if readIndex%1000000 == 0 {
+			sv.Progress(cfg.Log, "Reads at %s %d %d", rec.Ref.Name(), rec.Pos, rec.Pos+rec.Len())
+		}
+	}
+	return out.Close()
+}
+
+// pairStrands returns the strands the reads of the left and right CIs of
+// call face the breakpoint from: '+' for forward reads before it, '-' for
+// reverse reads after it. Both reads of a pair across an inversion are on
+// the strand of rec. It returns false for SVs without a pair model.
+func pairStrands(rec *sam.Record, call sv.SV, cis *interval.Store) (string, bool) {
+	switch strings.ToUpper(call.Type) {
+	case "DEL":
+		return "+-", true
+	case "INV":
+		if rec.Flags&sam.Reverse != 0 {
+			return "--", true
+		}
+		return "++", true
+	case "BND":
+		return call.Strands, len(call.Strands) == 2
+	case "DUP", "DUP:TANDEM":
+		if _, ok := cis.Side(call.ID, interval.Copy); !ok {
+			return "-+", true
+		}
+	}
+	return "", false
+}
+
+// facesBreakpoint reports whether rec and its mate are a discordant pair
+// across the SV of ci: each read on the strand facing its breakpoint, the
+// mate inside the CI of the other side, and too far apart for a normal
+// insert if they are placed like one
+func facesBreakpoint(rec *sam.Record, call sv.SV, ci interval.Interval, cis *interval.Store, insertSize InsertSize) bool {
+	if rec.Flags&sam.Paired == 0 || rec.Flags&sam.MateUnmapped != 0 || rec.MateRef == nil || ci.Side == interval.Copy {
+		return false
+	}
+	strands, ok := pairStrands(rec, call, cis)
+	if !ok {
+		return false
+	}
+	mateSide, strand, mateStrand := interval.Right, strands[0], strands[1]
+	if ci.Side == interval.Right {
+		mateSide, strand, mateStrand = interval.Left, strands[1], strands[0]
+	}
+	reverse := rec.Flags&sam.Reverse != 0
+	mateReverse := rec.Flags&sam.MateReverse != 0
+	if reverse != (strand == '-') || mateReverse != (mateStrand == '-') {
+		return false
+	}
+	mateIndex, ok := cis.Side(call.ID, mateSide)
+	if !ok {
+		return false
+	}
+	mateCI := cis.Get(mateIndex)
+	if rec.MateRef.Name() != mateCI.Chr || rec.MatePos < mateCI.Head || rec.MatePos > mateCI.Tail {
+		return false
+	}
+	if rec.Ref.Name() == rec.MateRef.Name() && reverse != mateReverse && reverse == (rec.Pos > rec.MatePos) {
+		return math.Abs(float64(rec.Pos-rec.MatePos)) > float64(insertSize.Mean+3*insertSize.SD)
+	}
+	return true
+}
+
+// junctionSide returns the side of the SV of ci, other than its own, whose
+// CI holds breakend b
+func junctionSide(cis *interval.Store, ci interval.Interval, b Breakend) (interval.Side, bool) {
+	for _, side := range []interval.Side{interval.Left, interval.Right, interval.Copy} {
+		if side == ci.Side {
+			continue
+		}
+		index, ok := cis.Side(ci.SVID, side)
+		if !ok {
+			continue
+		}
+		other := cis.Get(index)
+		if other.Chr == b.Chr && other.Head <= b.Pos && b.Pos <= other.Tail {
+			return side, true
+		}
+	}
+	return 0, false
+}
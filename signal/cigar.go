@@ -0,0 +1,207 @@
+package signal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/biogo/hts/sam"
+)
+
+var saTag = sam.NewTag("SA")
+
+// Clipping is the number of read bases clipped before and after the
+// aligned part of a CIGAR, soft and hard clips together
+type Clipping struct {
+	Start, End         int
+	SoftStart, SoftEnd int
+}
+
+// ClippingOf returns the clipping at both ends of cigar
+func ClippingOf(cigar sam.Cigar) Clipping {
+	var c Clipping
+	i := 0
+	for ; i < len(cigar) && isClip(cigar[i]); i++ {
+		c.Start += cigar[i].Len()
+		if cigar[i].Type() == sam.CigarSoftClipped {
+			c.SoftStart += cigar[i].Len()
+		}
+	}
+	for j := len(cigar) - 1; j >= i && isClip(cigar[j]); j-- {
+		c.End += cigar[j].Len()
+		if cigar[j].Type() == sam.CigarSoftClipped {
+			c.SoftEnd += cigar[j].Len()
+		}
+	}
+	return c
+}
+
+func isClip(op sam.CigarOp) bool {
+	return op.Type() == sam.CigarSoftClipped || op.Type() == sam.CigarHardClipped
+}
+
+// Longest returns the longest clip, soft or hard
+func (c Clipping) Longest() int {
+	if c.Start > c.End {
+		return c.Start
+	}
+	return c.End
+}
+
+// LongestSoft returns the longest soft clip
+func (c Clipping) LongestSoft() int {
+	if c.SoftStart > c.SoftEnd {
+		return c.SoftStart
+	}
+	return c.SoftEnd
+}
+
+// matched returns the number of read bases aligned to the reference
+func matched(cigar sam.Cigar) int {
+	n := 0
+	for _, op := range cigar {
+		switch op.Type() {
+		case sam.CigarMatch, sam.CigarEqual, sam.CigarMismatch:
+			n += op.Len()
+		}
+	}
+	return n
+}
+
+// Alignment is one alignment of a read, from its record or its SA tag.
+// Pos is 0-based, as in sam.Record.
+type Alignment struct {
+	Chr     string
+	Pos     int
+	Reverse bool
+	Cigar   sam.Cigar
+	MapQ    int
+	NM      int
+}
+
+func recordAlignment(rec *sam.Record) Alignment {
+	return Alignment{
+		Chr:     rec.Ref.Name(),
+		Pos:     rec.Pos,
+		Reverse: rec.Flags&sam.Reverse != 0,
+		Cigar:   rec.Cigar,
+		MapQ:    int(rec.MapQ),
+	}
+}
+
+// End is the exclusive 0-based end of the alignment on the reference
+func (a Alignment) End() int {
+	refLen, _ := a.Cigar.Lengths()
+	return a.Pos + refLen
+}
+
+// readRange returns the bases of the read the alignment covers, counted
+// on the strand the read was sequenced from
+func (a Alignment) readRange() (int, int) {
+	c := ClippingOf(a.Cigar)
+	_, readLen := a.Cigar.Lengths()
+	// hard clipped bases are not in the sequence length
+	for _, op := range a.Cigar {
+		if op.Type() == sam.CigarHardClipped {
+			readLen += op.Len()
+		}
+	}
+	if a.Reverse {
+		return c.End, readLen - c.Start
+	}
+	return c.Start, readLen - c.End
+}
+
+// ParseSA parses the value of an SA tag: rname,pos,strand,CIGAR,mapQ,NM;
+// entries with 1-based positions
+func ParseSA(value string) ([]Alignment, error) {
+	var result []Alignment
+	for _, entry := range strings.Split(strings.TrimSuffix(value, ";"), ";") {
+		fields := strings.Split(entry, ",")
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("SA entry %q: expected 6 fields, got %d", entry, len(fields))
+		}
+		pos, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("SA entry %q: %v", entry, err)
+		}
+		if fields[2] != "+" && fields[2] != "-" {
+			return nil, fmt.Errorf("SA entry %q: bad strand %q", entry, fields[2])
+		}
+		cigar, err := sam.ParseCigar([]byte(fields[3]))
+		if err != nil {
+			return nil, fmt.Errorf("SA entry %q: %v", entry, err)
+		}
+		mapQ, err1 := strconv.Atoi(fields[4])
+		nm, err2 := strconv.Atoi(fields[5])
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("SA entry %q: bad MAPQ or NM", entry)
+		}
+		result = append(result, Alignment{Chr: fields[0], Pos: pos - 1, Reverse: fields[2] == "-", Cigar: cigar, MapQ: mapQ, NM: nm})
+	}
+	return result, nil
+}
+
+// Breakend is one side of a split read junction: the last base before the
+// junction on the forward strand, 1-based, and the strand of the breakend
+// as in sv.SV
+type Breakend struct {
+	Chr    string
+	Pos    int
+	Strand byte
+}
+
+// Junction returns the breakends a read split into alignments a and b
+// joins, in the order of a and b. The part first in the read ends at the
+// junction, the other part starts at it.
+func Junction(a Alignment, b Alignment) (Breakend, Breakend) {
+	startA, _ := a.readRange()
+	startB, _ := b.readRange()
+	aFirst := startA <= startB
+	return junctionEnd(a, aFirst), junctionEnd(b, !aFirst)
+}
+
+// junctionEnd is the breakend of alignment a at the junction: its end in
+// the read if first, its start otherwise
+func junctionEnd(a Alignment, first bool) Breakend {
+	if first != a.Reverse {
+		return Breakend{Chr: a.Chr, Pos: a.End(), Strand: '+'}
+	}
+	return Breakend{Chr: a.Chr, Pos: a.Pos, Strand: '-'}
+}
+
+// splitJunction returns the breakends of the junction between rec and the
+// supplementary alignment of its SA tag nearest to it in the read: the one
+// on rec first. It returns false for records without a usable SA tag.
+func splitJunction(rec *sam.Record) (Breakend, Breakend, bool) {
+	aux := rec.AuxFields.Get(saTag)
+	if aux == nil {
+		return Breakend{}, Breakend{}, false
+	}
+	value, ok := aux.Value().(string)
+	if !ok {
+		return Breakend{}, Breakend{}, false
+	}
+	others, err := ParseSA(value)
+	if err != nil || len(others) == 0 {
+		return Breakend{}, Breakend{}, false
+	}
+	own := recordAlignment(rec)
+	ownStart, ownEnd := own.readRange()
+	best, bestGap := -1, 0
+	for i, other := range others {
+		start, end := other.readRange()
+		gap := start - ownEnd
+		if ownStart-end > gap {
+			gap = ownStart - end
+		}
+		if gap < 0 {
+			gap = -gap
+		}
+		if best < 0 || gap < bestGap {
+			best, bestGap = i, gap
+		}
+	}
+	ownBreakend, otherBreakend := Junction(own, others[best])
+	return ownBreakend, otherBreakend, true
+}
@@ -0,0 +1,148 @@
+package signal
+
+import (
+	"math"
+
+	"github.com/balanur/brosv-go/sv"
+	"github.com/biogo/hts/sam"
+)
+
+// IsSignaling reports whether a read is evidence for an SV of svType: a
+// read clipped by at least minClip bases, placed against its mate as the
+// SV type predicts, or an unclipped discordant pair.
+func IsSignaling(record *sam.Record, svType sv.Type, insertSize InsertSize, minClip int) bool {
+	flags := record.Flags
+	pos := record.Pos
+	matePos := record.MatePos
+
+	if flags&sam.Unmapped != 0 {
+		return false
+	}
+
+	// Clipped alignments: a long enough clip, or a supplementary alignment
+	clips := ClippingOf(record.Cigar)
+	softClipped := clips.LongestSoft() >= minClip
+	clipped := clips.Longest() >= minClip || record.AuxFields.Get(saTag) != nil
+
+	if svType == sv.Ins {
+		// clipped at the insertion point; the mate may be anywhere, or
+		// unmapped when it lies in the inserted sequence
+		return softClipped
+	}
+
+	if flags&sam.Paired == 0 {
+		return false
+	}
+
+	// Mate is unmapped
+	if flags&sam.MateUnmapped != 0 {
+		return false
+	}
+
+	if svType == sv.Bnd {
+		// clipped at the breakend, or discordant: the mate on another
+		// chromosome or further away than any insert
+		if clipped {
+			return true
+		}
+		max := float64(insertSize.Mean + 3*insertSize.SD)
+		return record.Ref.Name() != record.MateRef.Name() || math.Abs(float64(pos-matePos)) > max
+	}
+
+	// Mate is in another chromosome
+	if record.Ref.Name() != record.MateRef.Name() {
+		return false
+	}
+
+	if svType == sv.All {
+		// split in ci region
+		if clipped {
+			return true
+		}
+	}
+
+	if svType == sv.IntDup {
+		// Read placed before/after its mate -+
+		if clipped { // split in dup region
+			if flags&sam.Reverse != 0 && flags&sam.MateReverse == 0 && pos <= matePos {
+				return true
+			}
+			if flags&sam.Reverse == 0 && flags&sam.MateReverse != 0 && pos > matePos {
+				return true
+			}
+		}
+	}
+	if svType == sv.TanDup {
+		// Read placed before/after its mate -+
+		if clipped { // split in dup region
+			if flags&sam.Reverse != 0 && flags&sam.MateReverse == 0 && pos <= matePos {
+				return true
+			}
+			if flags&sam.Reverse == 0 && flags&sam.MateReverse != 0 && pos > matePos {
+				return true
+			}
+		}
+	}
+
+	if svType == sv.Inv {
+		// Same direction with mate
+		if clipped { // split in inv region
+			if flags&sam.Reverse != 0 && flags&sam.MateReverse != 0 && softClipped { // --
+				return true
+			}
+			if flags&sam.Reverse == 0 && flags&sam.MateReverse == 0 && softClipped { // ++
+				return true
+			}
+		}
+	}
+
+	if svType == sv.Del {
+		// Insert size (pairs mapped too closer or farther than expected)
+
+		if clipped { // split in del region
+			max := float64(insertSize.Mean + 3*insertSize.SD)
+			if math.Abs(float64(pos-matePos)) > max {
+
+				return true
+
+			}
+			if flags&sam.Reverse != 0 && flags&sam.MateReverse == 0 { // +-
+				return true
+			}
+
+			if flags&sam.Reverse == 0 && flags&sam.MateReverse != 0 { // +-
+				return true
+			}
+		}
+
+		// Just clipped (not mapping too farther than expected)
+		if clipped {
+			return true
+		}
+
+	}
+
+	// unclipped discordant pairs are paired-end evidence for the vote step
+	return discordant(record, svType, insertSize)
+}
+
+// discordant reports whether a pair on one chromosome is placed as an SV
+// of svType predicts: further apart than any insert for a deletion, on the
+// same strand for an inversion, facing away from each other for a tandem
+// duplication
+func discordant(record *sam.Record, svType sv.Type, insertSize InsertSize) bool {
+	reverse := record.Flags&sam.Reverse != 0
+	mateReverse := record.Flags&sam.MateReverse != 0
+	switch svType {
+	case sv.Del:
+		far := math.Abs(float64(record.Pos-record.MatePos)) > float64(insertSize.Mean+3*insertSize.SD)
+		return far && reverse != mateReverse && reverse == (record.Pos > record.MatePos)
+	case sv.Inv:
+		return reverse == mateReverse
+	case sv.TanDup:
+		return reverse != mateReverse && reverse == (record.Pos <= record.MatePos)
+	case sv.All:
+		return discordant(record, sv.Del, insertSize) || discordant(record, sv.Inv, insertSize) || discordant(record, sv.TanDup, insertSize)
+	}
+	return false
+}
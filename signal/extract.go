@@ -0,0 +1,382 @@
+// Package signal finds the reads signaling an SV inside the confidence
+// intervals and tags the breakpoints they vote for.
+package signal
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/balanur/brosv-go/bamio"
+	"github.com/balanur/brosv-go/interval"
+	"github.com/balanur/brosv-go/sv"
+	"github.com/biogo/hts/bam"
+	"github.com/biogo/hts/sam"
+)
+
+// Config controls signaling read extraction
+type Config struct {
+	SVType     sv.Type
+	InsertSize InsertSize
+	// reference used to decode CRAM input
+	RefFile string
+	Threads int
+	Policy  *sv.Policy
+	Filter  *bamio.ReadFilter
+	// progress lines, nil for none
+	Log *log.Logger
+}
+
+// Input is an alignment file and the sample column its reads support
+type Input struct {
+	Path   string
+	Sample int
+
+	// index of the input among those extracted together
+	bam int
+}
+
+// Extract writes the signaling reads of every input overlapping a CI that
+// pass cfg.Filter to outputBamFilePath, once per CI. Each copy is tagged
+// with the CI index, the sample of the input and the index of the input
+// in inputs, which is the bam index EstimateInsertSize gives the same
+// bams. Inputs must share the references of the first, whose header the
+// output gets. Indexed BAM input is fetched region by region, anything
+// else is scanned whole.
+func Extract(cfg Config, inputs []Input, outputBamFilePath string, cis *interval.Store) error {
+	first, err := bamio.Open(inputs[0].Path, cfg.RefFile, 1)
+	if err != nil {
+		return err
+	}
+	header := first.Header()
+	first.Close()
+	out, err := bamio.Create(outputBamFilePath, header)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	for i, input := range inputs {
+		input.bam = i
+		format, err := bamio.DetectFormat(input.Path)
+		if err != nil {
+			return err
+		}
+		if indexPath, ok := bamio.FindIndex(input.Path); ok && format == bamio.BAM {
+			sv.Progress(cfg.Log, "Using index %s for region extraction", indexPath)
+			err = extractIndexed(cfg, input, indexPath, header, out, cis)
+		} else {
+			sv.Progress(cfg.Log, "No bam index found for %s (%s), scanning the whole file", input.Path, format)
+			err = extractFullScan(cfg, input, header, out, cis)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return out.Close()
+}
+
+// sameReferences checks that records read with header can be written with
+// the header of the output: references are written by their index
+func sameReferences(filePath string, header *sam.Header, out *sam.Header) error {
+	refs, outRefs := header.Refs(), out.Refs()
+	if len(refs) != len(outRefs) {
+		return &sv.FileError{Op: "read", File: filePath, Err: fmt.Errorf("%d references, the first input has %d", len(refs), len(outRefs))}
+	}
+	for i, ref := range refs {
+		if ref.Name() != outRefs[i].Name() || ref.Len() != outRefs[i].Len() {
+			return &sv.FileError{Op: "read", File: filePath, Err: fmt.Errorf("reference %d is %s, in the first input %s", i, ref.Name(), outRefs[i].Name())}
+		}
+	}
+	return nil
+}
+
+// ciHit is a read together with the CIs it overlaps
+type ciHit struct {
+	rec       *sam.Record
+	intervals []int
+}
+
+// writeTagged writes rec once per CI it overlaps, tagged with the CI index
+// and the sample and index of input
+func writeTagged(out *bamio.Writer, writeLock *sync.Mutex, rec *sam.Record, intervals []int, input Input) error {
+	sampleAux, err := sam.NewAux(bamio.SampleTag, input.Sample)
+	if err != nil {
+		return sv.ReadError(out.Path(), rec, -1, err)
+	}
+	bamAux, err := sam.NewAux(bamio.BamTag, input.bam)
+	if err != nil {
+		return sv.ReadError(out.Path(), rec, -1, err)
+	}
+	rec.AuxFields = append(rec.AuxFields, sampleAux, bamAux)
+	defer func() { rec.AuxFields = rec.AuxFields[:len(rec.AuxFields)-2] }()
+	for _, intervalIndex := range intervals {
+		newAux, err := sam.NewAux(bamio.SVTag, intervalIndex)
+		if err != nil {
+			return sv.ReadError(out.Path(), rec, intervalIndex, err)
+		}
+		rec.AuxFields = append(rec.AuxFields, newAux)
+		writeLock.Lock()
+		err = out.Write(rec)
+		writeLock.Unlock()
+		rec.AuxFields = rec.AuxFields[:len(rec.AuxFields)-1]
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractFullScan(cfg Config, input Input, header *sam.Header, out *bamio.Writer, cis *interval.Store) error {
+	threads := cfg.Threads
+	bamFilePath := input.Path
+
+	bamReader, err := bamio.Open(bamFilePath, cfg.RefFile, threads)
+	if err != nil {
+		return err
+	}
+	defer bamReader.Close()
+	if err := sameReferences(bamFilePath, bamReader.Header(), header); err != nil {
+		return err
+	}
+
+	// coordinate-sorted input is matched to CIs with a sweep while reading,
+	// so only reads inside CIs are handed to the threads
+	var sweeper *interval.Sweeper
+	if bamReader.Header().SortOrder == sam.Coordinate {
+		sweeper = cis.NewSweeper()
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(threads)
+	channels := make([]chan ciHit, threads)
+	var writeLock sync.Mutex
+	var errs sv.FirstError
+
+	for threadIndex := 0; threadIndex < threads; threadIndex++ {
+		channels[threadIndex] = make(chan ciHit, 2000)
+		go func(tIndex int) {
+			defer wg.Done()
+
+			for hit := range channels[tIndex] {
+				rec := hit.rec
+
+				if errs.Get() == nil && cfg.Filter.Accept(rec) && IsSignaling(rec, cfg.SVType, cfg.InsertSize, cfg.Filter.MinClip) {
+
+					intersectingIntervals := hit.intervals
+					if sweeper == nil {
+						intersectingIntervals = cis.Overlapping(rec.Ref.Name(), rec.Pos, rec.Pos+rec.Len())
+					}
+
+					if err := writeTagged(out, &writeLock, rec, intersectingIntervals, input); err != nil {
+						errs.Set(err)
+					}
+				}
+			}
+		}(threadIndex)
+	}
+
+	sv.Progress(cfg.Log, "Distributing to threads")
+
+	readIndex := 0
+	for errs.Get() == nil {
+		rec, err := bamReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			errs.Set(&sv.FileError{Op: "read", File: bamFilePath, Err: err})
+			break
+		}
+
+		hit := ciHit{rec: rec}
+		if sweeper != nil {
+			hit.intervals = sweeper.Query(rec.Ref.Name(), rec.Pos, rec.Pos+rec.Len())
+		}
+		if sweeper == nil || len(hit.intervals) > 0 {
+			channels[readIndex%threads] <- hit
+		}
+		readIndex++
+		if readIndex%progressReads == 0 {
+			sv.Progress(cfg.Log, "Distributed %d, at %s %d", readIndex, rec.Ref.Name(), rec.Pos)
+		}
+	}
+
+	for i := 0; i < threads; i++ {
+		close(channels[i])
+	}
+	sv.Progress(cfg.Log, "Waiting on threads")
+	wg.Wait()
+
+	return errs.Get()
+}
+
+// reads between two progress lines of a pass over a whole bam
+const progressReads = 10000000
+
+// gap under which neighbouring CIs are fetched as one region
+const regionMergeGap = 1000
+
+// ciRegion is a merged span of confidence intervals on one chromosome.
+// prevTail is the tail of the previous region on the chromosome (-1 if none),
+// used so that a read overlapping two regions is only processed once.
+type ciRegion struct {
+	chr      string
+	head     int
+	tail     int
+	prevTail int
+}
+
+func mergedCIRegions(cis *interval.Store) []ciRegion {
+	var regions []ciRegion
+	for _, chr := range cis.Chromosomes() {
+		indices := cis.OnChromosome(chr)
+		intervals := make([]interval.Interval, 0, len(indices))
+		for _, i := range indices {
+			intervals = append(intervals, cis.Get(i))
+		}
+		sort.Slice(intervals, func(i, j int) bool { return intervals[i].Head < intervals[j].Head })
+
+		var chrRegions []ciRegion
+		for _, ci := range intervals {
+			last := len(chrRegions) - 1
+			if last >= 0 && ci.Head <= chrRegions[last].tail+regionMergeGap {
+				if ci.Tail > chrRegions[last].tail {
+					chrRegions[last].tail = ci.Tail
+				}
+				continue
+			}
+			prevTail := -1
+			if last >= 0 {
+				prevTail = chrRegions[last].tail
+			}
+			chrRegions = append(chrRegions, ciRegion{chr: chr, head: ci.Head, tail: ci.Tail, prevTail: prevTail})
+		}
+		regions = append(regions, chrRegions...)
+	}
+	return regions
+}
+
+// extractIndexed fetches only the merged CI regions through the bam index,
+// one region per worker at a time
+func extractIndexed(cfg Config, input Input, indexPath string, header *sam.Header, out *bamio.Writer, cis *interval.Store) error {
+	threads := cfg.Threads
+	bamFilePath := input.Path
+	chunks, err := bamio.ReadIndex(indexPath)
+	if err != nil {
+		return err
+	}
+
+	bamReader, err := bamio.Open(bamFilePath, cfg.RefFile, 1)
+	if err != nil {
+		return err
+	}
+	defer bamReader.Close()
+	if err := sameReferences(bamFilePath, bamReader.Header(), header); err != nil {
+		return err
+	}
+
+	refs := make(map[string]*sam.Reference)
+	for _, ref := range bamReader.Header().Refs() {
+		refs[ref.Name()] = ref
+	}
+
+	regions := mergedCIRegions(cis)
+	sv.Progress(cfg.Log, "Fetching %d merged CI regions", len(regions))
+
+	var wg sync.WaitGroup
+	wg.Add(threads)
+	regionChannel := make(chan ciRegion, len(regions))
+	var writeLock sync.Mutex
+	var doneLock sync.Mutex
+	var errs sv.FirstError
+	done := 0
+
+	fetchRegion := func(regionReader *bam.Reader, region ciRegion) error {
+		ref, ok := refs[region.chr]
+		if !ok {
+			return nil
+		}
+		beg := region.head - 1
+		if beg < 0 {
+			beg = 0
+		}
+		end := region.tail + 1
+		if end > ref.Len() {
+			end = ref.Len()
+		}
+		regionChunks, err := chunks(ref, beg, end)
+		if err != nil {
+			sv.Progress(cfg.Log, "No index entries for %s:%d-%d: %v", region.chr, region.head, region.tail, err)
+			return nil
+		}
+
+		it, err := bam.NewIterator(regionReader, regionChunks)
+		if err != nil {
+			return &sv.FileError{Op: "read", File: bamFilePath, Err: fmt.Errorf("seeking %s:%d-%d: %v", region.chr, region.head, region.tail, err)}
+		}
+		defer it.Close()
+		for it.Next() {
+			rec := it.Record()
+			recEnd := rec.Pos + rec.Len()
+			if rec.Pos > region.tail || recEnd < region.head {
+				continue
+			}
+			// read was already handled with the previous region
+			if rec.Pos < region.head && region.prevTail >= 0 && rec.Pos <= region.prevTail {
+				continue
+			}
+			if !cfg.Filter.Accept(rec) || !IsSignaling(rec, cfg.SVType, cfg.InsertSize, cfg.Filter.MinClip) {
+				continue
+			}
+			if err := writeTagged(out, &writeLock, rec, cis.Overlapping(rec.Ref.Name(), rec.Pos, recEnd), input); err != nil {
+				return err
+			}
+		}
+		if err := it.Error(); err != nil {
+			return &sv.FileError{Op: "read", File: bamFilePath, Err: err}
+		}
+		return nil
+	}
+
+	for threadIndex := 0; threadIndex < threads; threadIndex++ {
+		go func() {
+			defer wg.Done()
+
+			regionReader, err := bamio.Open(bamFilePath, cfg.RefFile, 1)
+			if err != nil {
+				errs.Set(err)
+				return
+			}
+			defer regionReader.Close()
+
+			for region := range regionChannel {
+				if errs.Get() != nil {
+					continue
+				}
+				if err := fetchRegion(regionReader.Reader, region); err != nil {
+					errs.Set(err)
+					continue
+				}
+
+				doneLock.Lock()
+				done++
+				if done%1000 == 0 || done == len(regions) {
+					sv.Progress(cfg.Log, "Fetched %d / %d regions", done, len(regions))
+				}
+				doneLock.Unlock()
+			}
+		}()
+	}
+
+	for _, region := range regions {
+		regionChannel <- region
+	}
+	close(regionChannel)
+	sv.Progress(cfg.Log, "Waiting on threads")
+	wg.Wait()
+
+	return errs.Get()
+}
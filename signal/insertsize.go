@@ -0,0 +1,430 @@
+package signal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/balanur/brosv-go/bamio"
+	"github.com/balanur/brosv-go/sv"
+	"github.com/biogo/hts/bam"
+	"github.com/biogo/hts/bgzf"
+	"github.com/biogo/hts/sam"
+)
+
+const (
+	// regions of the genome pairs are sampled from through the index
+	insertRegions = 200
+	// inserts further than this many MADs from the median are outliers
+	insertTrim = 10
+	// MAD of a normal distribution per SD
+	madPerSD = 0.6745
+)
+
+// InsertSize is the fragment length distribution of a library. Mean and
+// SD are robust: the median of the inserts and their MAD scaled to the SD
+// of a normal distribution. Counts is the histogram of the inserts left
+// after trimming outliers, Counts[i] pairs with an insert of Min+i.
+type InsertSize struct {
+	Mean   int
+	SD     int
+	Min    int
+	Counts []int
+
+	// cumulative[i] is the sum of Counts[:i]
+	cumulative []int
+}
+
+// ReadGroup is a read group of one of the bams, by the index of the bam:
+// bams may reuse the IDs of read groups of another library
+type ReadGroup struct {
+	Bam  int
+	Name string
+}
+
+// InsertSizes is the insert size distribution of every read group of the
+// bams, and of all their pairs together
+type InsertSizes struct {
+	All     InsertSize
+	ByGroup map[ReadGroup]InsertSize
+}
+
+// Of returns the distribution of a read group of a bam, or that of all
+// pairs for read groups without one
+func (s InsertSizes) Of(bam int, readGroup string) InsertSize {
+	if size, ok := s.ByGroup[ReadGroup{Bam: bam, Name: readGroup}]; ok {
+		return size
+	}
+	return s.All
+}
+
+// Pairs is the number of pairs in the histogram
+func (s InsertSize) Pairs() int {
+	if len(s.cumulative) == 0 {
+		return 0
+	}
+	return s.cumulative[len(s.cumulative)-1]
+}
+
+// Density is the share of pairs with an insert of size, read from the
+// histogram averaged over SD/10 bases on each side. Without a histogram
+// it is the normal density of Mean and SD.
+func (s InsertSize) Density(size int) float64 {
+	sd := float64(s.SD)
+	if sd < 1 {
+		sd = 1
+	}
+	if s.Pairs() == 0 {
+		z := (float64(size) - float64(s.Mean)) / sd
+		return math.Exp(-z*z/2) / (sd * math.Sqrt(2*math.Pi))
+	}
+	w := s.SD / 10
+	if w < 1 {
+		w = 1
+	}
+	lo, hi := size-w-s.Min, size+w+1-s.Min
+	if lo < 0 {
+		lo = 0
+	}
+	if hi > len(s.Counts) {
+		hi = len(s.Counts)
+	}
+	if lo >= hi {
+		return 0
+	}
+	return float64(s.cumulative[hi]-s.cumulative[lo]) / float64(s.Pairs()*(2*w+1))
+}
+
+// newInsertSize summarizes inserts: the median and MAD of all of them,
+// then the same of those within insertTrim MADs of the median, with
+// their histogram
+func newInsertSize(inserts []int) InsertSize {
+	sort.Ints(inserts)
+	median, mad := medianMAD(inserts)
+	lo := sort.SearchInts(inserts, median-insertTrim*mad)
+	hi := sort.SearchInts(inserts, median+insertTrim*mad+1)
+	if lo < hi {
+		inserts = inserts[lo:hi]
+		median, mad = medianMAD(inserts)
+	}
+
+	result := InsertSize{Mean: median, SD: int(math.Round(float64(mad) / madPerSD))}
+	if len(inserts) == 0 {
+		return result
+	}
+	result.Min = inserts[0]
+	result.Counts = make([]int, inserts[len(inserts)-1]-result.Min+1)
+	for _, insert := range inserts {
+		result.Counts[insert-result.Min]++
+	}
+	result.accumulate()
+	return result
+}
+
+// medianMAD returns the median of sorted inserts and their median
+// absolute deviation from it
+func medianMAD(sorted []int) (int, int) {
+	if len(sorted) == 0 {
+		return 0, 0
+	}
+	median := sorted[len(sorted)/2]
+	deviations := make([]int, len(sorted))
+	for i, insert := range sorted {
+		deviations[i] = insert - median
+		if deviations[i] < 0 {
+			deviations[i] = -deviations[i]
+		}
+	}
+	sort.Ints(deviations)
+	return median, deviations[len(deviations)/2]
+}
+
+func (s *InsertSize) accumulate() {
+	s.cumulative = make([]int, len(s.Counts)+1)
+	for i, n := range s.Counts {
+		s.cumulative[i+1] = s.cumulative[i] + n
+	}
+}
+
+// insertSample collects the inserts of sampled pairs by read group, n of
+// them from bam, the one being sampled
+type insertSample struct {
+	filter  *bamio.ReadFilter
+	byGroup map[ReadGroup][]int
+	bam     int
+	n       int
+}
+
+// add keeps the insert of rec if it is the forward read of a pair facing
+// its reverse mate on the same chromosome, once per pair
+func (s *insertSample) add(rec *sam.Record) bool {
+	flags := rec.Flags
+	if flags&sam.Paired == 0 || flags&(sam.Unmapped|sam.MateUnmapped|sam.Secondary|sam.Supplementary) != 0 {
+		return false
+	}
+	if flags&sam.Reverse != 0 || flags&sam.MateReverse == 0 || rec.TempLen <= 0 || rec.Ref.ID() != rec.MateRef.ID() {
+		return false
+	}
+	if !s.filter.Accept(rec) {
+		return false
+	}
+	rg := ReadGroup{Bam: s.bam, Name: bamio.ReadGroup(rec)}
+	s.byGroup[rg] = append(s.byGroup[rg], rec.TempLen)
+	s.n++
+	return true
+}
+
+func (s *insertSample) sizes() InsertSizes {
+	result := InsertSizes{ByGroup: make(map[ReadGroup]InsertSize)}
+	var all []int
+	for rg, inserts := range s.byGroup {
+		all = append(all, inserts...)
+		if rg.Name != "" {
+			result.ByGroup[rg] = newInsertSize(inserts)
+		}
+	}
+	result.All = newInsertSize(all)
+	return result
+}
+
+// EstimateInsertSize estimates the insert size distribution of every read
+// group of each bam, by the index of the bam in bamFilePaths, from up to N
+// pairs passing cfg.Filter of the bam, in one pass over it. Indexed bams are sampled in regions spread evenly over the
+// genome, anything else is read from its start.
+func EstimateInsertSize(cfg Config, bamFilePaths []string, N int) (InsertSizes, error) {
+	sample := &insertSample{filter: cfg.Filter, byGroup: make(map[ReadGroup][]int)}
+	for i, bamFilePath := range bamFilePaths {
+		format, err := bamio.DetectFormat(bamFilePath)
+		if err != nil {
+			return InsertSizes{}, err
+		}
+		sample.bam, sample.n = i, 0
+		if indexPath, ok := bamio.FindIndex(bamFilePath); ok && format == bamio.BAM {
+			err = sampleIndexed(cfg, bamFilePath, indexPath, N, sample)
+		} else {
+			err = sampleStream(cfg, bamFilePath, N, sample)
+		}
+		if err != nil {
+			return InsertSizes{}, err
+		}
+		if sample.n == 0 {
+			return InsertSizes{}, &sv.FileError{Op: "read", File: bamFilePath, Err: fmt.Errorf("no read pairs to estimate the insert size from")}
+		}
+	}
+	return sample.sizes(), nil
+}
+
+func sampleStream(cfg Config, bamFilePath string, N int, sample *insertSample) error {
+	bamReader, err := bamio.Open(bamFilePath, cfg.RefFile, cfg.Threads)
+	if err != nil {
+		return err
+	}
+	defer bamReader.Close()
+
+	for sample.n < N {
+		rec, err := bamReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return &sv.FileError{Op: "read", File: bamFilePath, Err: err}
+		}
+		sample.add(rec)
+	}
+	return nil
+}
+
+// sampleIndexed takes N/insertRegions pairs from each of insertRegions
+// points spread evenly over the references, reading on from each point
+// until it has them or its reference ends
+func sampleIndexed(cfg Config, bamFilePath string, indexPath string, N int, sample *insertSample) error {
+	chunks, err := bamio.ReadIndex(indexPath)
+	if err != nil {
+		return err
+	}
+	bamReader, err := bamio.Open(bamFilePath, cfg.RefFile, cfg.Threads)
+	if err != nil {
+		return err
+	}
+	defer bamReader.Close()
+
+	refs := bamReader.Header().Refs()
+	total := 0
+	for _, ref := range refs {
+		total += ref.Len()
+	}
+	if total == 0 {
+		return nil
+	}
+	quota := (N + insertRegions - 1) / insertRegions
+	step := float64(total) / insertRegions
+	offset := 0
+	for _, ref := range refs {
+		first := int(math.Ceil(float64(offset)/step - 0.5))
+		for k := first; (float64(k)+0.5)*step < float64(offset+ref.Len()) && sample.n < N; k++ {
+			beg := int((float64(k)+0.5)*step) - offset
+			if beg < 0 {
+				beg = 0
+			}
+			regionChunks, err := chunks(ref, beg, ref.Len())
+			if err != nil || len(regionChunks) == 0 {
+				continue
+			}
+			if err := sampleChunks(bamReader.Reader, regionChunks, beg, quota, sample); err != nil {
+				return &sv.FileError{Op: "read", File: bamFilePath, Err: err}
+			}
+		}
+		offset += ref.Len()
+	}
+	return nil
+}
+
+func sampleChunks(reader *bam.Reader, chunks []bgzf.Chunk, beg int, quota int, sample *insertSample) error {
+	it, err := bam.NewIterator(reader, chunks)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	taken := 0
+	for taken < quota && it.Next() {
+		rec := it.Record()
+		if rec.Pos < beg {
+			continue
+		}
+		if sample.add(rec) {
+			taken++
+		}
+	}
+	return it.Error()
+}
+
+// WriteInsertSizes saves the distributions of sizes to filePath, each as
+// an "rg bam name median sd" line followed by "insert count" lines of its
+// histogram. The distribution of all pairs has the line "rg * median sd".
+func WriteInsertSizes(filePath string, sizes InsertSizes) error {
+	f, err := os.Create(filePath)
+	if err != nil {
+		return &sv.FileError{Op: "create", File: filePath, Err: err}
+	}
+	defer f.Close()
+	writer := bufio.NewWriter(f)
+
+	groups := make([]ReadGroup, 0, len(sizes.ByGroup))
+	for rg := range sizes.ByGroup {
+		groups = append(groups, rg)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Bam != groups[j].Bam {
+			return groups[i].Bam < groups[j].Bam
+		}
+		return groups[i].Name < groups[j].Name
+	})
+	write := func(name string, size InsertSize) {
+		fmt.Fprintf(writer, "rg %s %d %d\n", name, size.Mean, size.SD)
+		for i, n := range size.Counts {
+			if n > 0 {
+				fmt.Fprintf(writer, "%d %d\n", size.Min+i, n)
+			}
+		}
+	}
+	write("*", sizes.All)
+	for _, rg := range groups {
+		write(strconv.Itoa(rg.Bam)+" "+rg.Name, sizes.ByGroup[rg])
+	}
+	if err := writer.Flush(); err != nil {
+		return &sv.FileError{Op: "write", File: filePath, Err: err}
+	}
+	return f.Close()
+}
+
+// ReadInsertSizes reads distributions saved by WriteInsertSizes
+func ReadInsertSizes(filePath string) (InsertSizes, error) {
+	result := InsertSizes{ByGroup: make(map[ReadGroup]InsertSize)}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return result, &sv.FileError{Op: "open", File: filePath, Err: err}
+	}
+	defer f.Close()
+
+	type entry struct {
+		// group is nil for the distribution of all pairs
+		group *ReadGroup
+		size  InsertSize
+		count map[int]int
+	}
+	var entries []*entry
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 {
+			continue
+		}
+		bad := &sv.RecordError{File: filePath, Record: "line " + strconv.Itoa(line), CI: -1, Err: fmt.Errorf("bad insert size line %q", scanner.Text())}
+		if words[0] == "rg" {
+			var group *ReadGroup
+			switch {
+			case len(words) == 4 && words[1] == "*":
+			case len(words) == 5:
+				bam, err := strconv.Atoi(words[1])
+				if err != nil || bam < 0 {
+					return result, bad
+				}
+				group = &ReadGroup{Bam: bam, Name: words[2]}
+			default:
+				return result, bad
+			}
+			mean, err1 := strconv.Atoi(words[len(words)-2])
+			sd, err2 := strconv.Atoi(words[len(words)-1])
+			if err1 != nil || err2 != nil {
+				return result, bad
+			}
+			entries = append(entries, &entry{group: group, size: InsertSize{Mean: mean, SD: sd}, count: make(map[int]int)})
+			continue
+		}
+		if len(words) != 2 || len(entries) == 0 {
+			return result, bad
+		}
+		insert, err1 := strconv.Atoi(words[0])
+		n, err2 := strconv.Atoi(words[1])
+		if err1 != nil || err2 != nil {
+			return result, bad
+		}
+		entries[len(entries)-1].count[insert] += n
+	}
+	if err := scanner.Err(); err != nil {
+		return result, &sv.FileError{Op: "read", File: filePath, Err: err}
+	}
+
+	for _, e := range entries {
+		if len(e.count) > 0 {
+			lo, hi := math.MaxInt32, math.MinInt32
+			for insert := range e.count {
+				if insert < lo {
+					lo = insert
+				}
+				if insert > hi {
+					hi = insert
+				}
+			}
+			e.size.Min = lo
+			e.size.Counts = make([]int, hi-lo+1)
+			for insert, n := range e.count {
+				e.size.Counts[insert-lo] = n
+			}
+			e.size.accumulate()
+		}
+		if e.group == nil {
+			result.All = e.size
+		} else {
+			result.ByGroup[*e.group] = e.size
+		}
+	}
+	return result, nil
+}
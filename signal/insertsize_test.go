@@ -0,0 +1,94 @@
+package signal
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/balanur/brosv-go/bamio"
+	"github.com/biogo/hts/sam"
+)
+
+func TestInsertSizesRoundTrip(t *testing.T) {
+	sizes := InsertSizes{
+		All: newInsertSize([]int{300, 310, 290, 305, 500}),
+		ByGroup: map[ReadGroup]InsertSize{
+			{Bam: 0, Name: "rg1"}: newInsertSize([]int{300, 310, 290}),
+			{Bam: 0, Name: "rg2"}: newInsertSize([]int{305}),
+			// another bam reusing a read group ID
+			{Bam: 1, Name: "rg1"}: newInsertSize([]int{500}),
+		},
+	}
+	file := filepath.Join(t.TempDir(), "insertsize.txt")
+	if err := WriteInsertSizes(file, sizes); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadInsertSizes(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, sizes) {
+		t.Errorf("read back %+v, want %+v", got, sizes)
+	}
+}
+
+func TestInsertSampleKeysGroupsByBam(t *testing.T) {
+	ref, err := sam.NewReference("chr1", "", "", 10000, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// records only link to references of a header
+	if _, err := sam.NewHeader(nil, []*sam.Reference{ref}); err != nil {
+		t.Fatal(err)
+	}
+	rg, err := sam.NewAux(sam.NewTag("RG"), "lib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sample := &insertSample{filter: bamio.DefaultReadFilter(), byGroup: make(map[ReadGroup][]int)}
+	// both bams name their read group lib, with libraries of other sizes
+	for bam, insert := range []int{300, 500} {
+		sample.bam = bam
+		for i := 0; i < 3; i++ {
+			rec, err := sam.NewRecord("pair", ref, ref, 1000, 1000+insert-100, insert, 60,
+				[]sam.CigarOp{sam.NewCigarOp(sam.CigarMatch, 100)}, make([]byte, 100), nil, []sam.Aux{rg})
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec.Flags = sam.Paired | sam.MateReverse
+			if !sample.add(rec) {
+				t.Fatalf("pair of bam %d not sampled", bam)
+			}
+		}
+	}
+	sizes := sample.sizes()
+	if len(sizes.ByGroup) != 2 {
+		t.Fatalf("%d read groups, want 2", len(sizes.ByGroup))
+	}
+	for bam, want := range []int{300, 500} {
+		if got := sizes.Of(bam, "lib").Mean; got != want {
+			t.Errorf("read group lib of bam %d has mean %d, want %d", bam, got, want)
+		}
+	}
+}
+
+func TestReadInsertSizesMalformed(t *testing.T) {
+	for _, content := range []string{
+		"rg * 300 20\n300\n",
+		"rg * 300 20\n300 1 2\n",
+		"rg * 300 20\n300 x\n",
+		"300 1\n",
+		"rg * 300\n",
+		"rg rg1 300 20\n",
+		"rg x rg1 300 20\n",
+	} {
+		file := filepath.Join(t.TempDir(), "insertsize.txt")
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadInsertSizes(file); err == nil {
+			t.Errorf("no error reading %q", content)
+		}
+	}
+}
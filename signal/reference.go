@@ -0,0 +1,218 @@
+package signal
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/balanur/brosv-go/bamio"
+	"github.com/balanur/brosv-go/sv"
+	"github.com/biogo/hts/bam"
+	"github.com/biogo/hts/sam"
+)
+
+// aligned bases a read needs on both sides of a breakpoint to span it
+const minSpan = 20
+
+// Locus is a breakpoint of an SV: the last base before the junction on
+// the forward strand, 1-based
+type Locus struct {
+	SVID string
+	Chr  string
+	Pos  int
+}
+
+// RefSupport is the reads spanning a breakpoint of an SV unbroken, and
+// the concordant pairs whose fragment spans it, both supporting the
+// reference allele
+type RefSupport struct {
+	Reads int
+	Pairs int
+}
+
+// refCounter collects the names of the reference supporting reads and
+// pairs of every SV, so a read spanning two breakpoints of an SV counts once
+type refCounter struct {
+	cfg   Config
+	loci  map[string][]Locus
+	reads map[string]map[string]bool
+	pairs map[string]map[string]bool
+}
+
+// CountReference counts the reads of bamFilePath supporting the reference
+// allele at loci, by SV ID: reads passing cfg.Filter aligned across a
+// breakpoint with minSpan bases on each side and no clip or supplementary
+// alignment, and forward reads of concordant pairs with the breakpoint
+// between them. Indexed bams are fetched around each locus, anything else
+// is scanned whole.
+func CountReference(cfg Config, bamFilePath string, loci []Locus) (map[string]RefSupport, error) {
+	c := &refCounter{
+		cfg:   cfg,
+		loci:  make(map[string][]Locus),
+		reads: make(map[string]map[string]bool),
+		pairs: make(map[string]map[string]bool),
+	}
+	for _, locus := range loci {
+		c.loci[locus.Chr] = append(c.loci[locus.Chr], locus)
+	}
+	for _, chrLoci := range c.loci {
+		sort.Slice(chrLoci, func(i, j int) bool { return chrLoci[i].Pos < chrLoci[j].Pos })
+	}
+
+	format, err := bamio.DetectFormat(bamFilePath)
+	if err != nil {
+		return nil, err
+	}
+	if indexPath, ok := bamio.FindIndex(bamFilePath); ok && format == bamio.BAM {
+		err = c.fetch(bamFilePath, indexPath)
+	} else {
+		err = c.scan(bamFilePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]RefSupport)
+	for _, locus := range loci {
+		result[locus.SVID] = RefSupport{Reads: len(c.reads[locus.SVID]), Pairs: len(c.pairs[locus.SVID])}
+	}
+	return result, nil
+}
+
+// maxInsert is the longest insert of a concordant pair
+func (c *refCounter) maxInsert() int {
+	return c.cfg.InsertSize.Mean + 3*c.cfg.InsertSize.SD
+}
+
+// add counts rec at every locus it supports the reference allele at
+func (c *refCounter) add(rec *sam.Record) {
+	if rec.Flags&(sam.Unmapped|sam.Secondary|sam.Supplementary) != 0 || !c.cfg.Filter.Accept(rec) {
+		return
+	}
+	chrLoci := c.loci[rec.Ref.Name()]
+	// loci a read or its fragment could span lie within maxInsert of its start
+	i := sort.Search(len(chrLoci), func(i int) bool { return chrLoci[i].Pos >= rec.Pos })
+	for ; i < len(chrLoci) && chrLoci[i].Pos <= rec.Pos+c.maxInsert(); i++ {
+		locus := chrLoci[i]
+		if spansUnbroken(rec, locus.Pos, c.cfg.Filter.MinClip) {
+			mark(c.reads, locus.SVID, rec.Name+readNumber(rec))
+		}
+		if c.concordantAcross(rec, locus.Pos) {
+			mark(c.pairs, locus.SVID, rec.Name)
+		}
+	}
+}
+
+func mark(names map[string]map[string]bool, id string, name string) {
+	if names[id] == nil {
+		names[id] = make(map[string]bool)
+	}
+	names[id][name] = true
+}
+
+// readNumber tells the two reads of a pair apart
+func readNumber(rec *sam.Record) string {
+	if rec.Flags&sam.Read2 != 0 {
+		return "/2"
+	}
+	return "/1"
+}
+
+// spansUnbroken reports whether rec is aligned across bp with minSpan
+// bases on each side and neither a clip of minClip bases nor an SA tag
+func spansUnbroken(rec *sam.Record, bp int, minClip int) bool {
+	if bp-rec.Pos < minSpan || rec.End()-bp < minSpan {
+		return false
+	}
+	return ClippingOf(rec.Cigar).Longest() < minClip && rec.AuxFields.Get(saTag) == nil
+}
+
+// concordantAcross reports whether rec is the forward read of a pair
+// facing its reverse mate at a concordant insert, with bp between them
+func (c *refCounter) concordantAcross(rec *sam.Record, bp int) bool {
+	flags := rec.Flags
+	if flags&sam.Paired == 0 || flags&sam.MateUnmapped != 0 || flags&sam.Reverse != 0 || flags&sam.MateReverse == 0 {
+		return false
+	}
+	if rec.Ref.ID() != rec.MateRef.ID() || rec.TempLen <= 0 || rec.TempLen > c.maxInsert() {
+		return false
+	}
+	return rec.End() <= bp && rec.MatePos >= bp
+}
+
+func (c *refCounter) scan(bamFilePath string) error {
+	bamReader, err := bamio.Open(bamFilePath, c.cfg.RefFile, c.cfg.Threads)
+	if err != nil {
+		return err
+	}
+	defer bamReader.Close()
+	for {
+		rec, err := bamReader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return &sv.FileError{Op: "read", File: bamFilePath, Err: err}
+		}
+		c.add(rec)
+	}
+}
+
+// fetch reads the reads starting up to maxInsert before each locus, each
+// once: add counts a read at every locus it reaches
+func (c *refCounter) fetch(bamFilePath string, indexPath string) error {
+	chunks, err := bamio.ReadIndex(indexPath)
+	if err != nil {
+		return err
+	}
+	bamReader, err := bamio.Open(bamFilePath, c.cfg.RefFile, c.cfg.Threads)
+	if err != nil {
+		return err
+	}
+	defer bamReader.Close()
+
+	refs := make(map[string]*sam.Reference)
+	for _, ref := range bamReader.Header().Refs() {
+		refs[ref.Name()] = ref
+	}
+	for chr, chrLoci := range c.loci {
+		ref, ok := refs[chr]
+		if !ok {
+			continue
+		}
+		prevEnd := 0
+		for _, locus := range chrLoci {
+			beg, end := locus.Pos-c.maxInsert(), locus.Pos+1
+			if beg < prevEnd {
+				beg = prevEnd
+			}
+			if end > ref.Len() {
+				end = ref.Len()
+			}
+			if beg >= end {
+				continue
+			}
+			prevEnd = end
+			regionChunks, err := chunks(ref, beg, end)
+			if err != nil || len(regionChunks) == 0 {
+				continue
+			}
+			it, err := bam.NewIterator(bamReader.Reader, regionChunks)
+			if err != nil {
+				return &sv.FileError{Op: "read", File: bamFilePath, Err: fmt.Errorf("seeking %s:%d: %v", chr, locus.Pos, err)}
+			}
+			for it.Next() {
+				rec := it.Record()
+				if rec.Pos >= beg && rec.Pos < end {
+					c.add(rec)
+				}
+			}
+			err = it.Error()
+			it.Close()
+			if err != nil {
+				return &sv.FileError{Op: "read", File: bamFilePath, Err: err}
+			}
+		}
+	}
+	return nil
+}
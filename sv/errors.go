@@ -0,0 +1,104 @@
+package sv
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/biogo/hts/sam"
+)
+
+// FileError is a failure to open, read or write a file
+type FileError struct {
+	Op   string
+	File string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Op, e.File, e.Err)
+}
+
+func (e *FileError) Unwrap() error { return e.Err }
+
+// RecordError is a malformed record in a file. CI is -1 when the record is
+// not tied to a confidence interval.
+type RecordError struct {
+	File   string
+	Record string
+	CI     int
+	Err    error
+}
+
+func (e *RecordError) Error() string {
+	if e.CI >= 0 {
+		return fmt.Sprintf("%s: record %s (ci %d): %v", e.File, e.Record, e.CI, e.Err)
+	}
+	return fmt.Sprintf("%s: record %s: %v", e.File, e.Record, e.Err)
+}
+
+func (e *RecordError) Unwrap() error { return e.Err }
+
+// StepError is an error raised by one step of the pipeline
+type StepError struct {
+	Step string
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Step, e.Err)
+}
+
+func (e *StepError) Unwrap() error { return e.Err }
+
+// ReadError is a RecordError for an alignment record
+func ReadError(file string, rec *sam.Record, ci int, err error) *RecordError {
+	name := "<nil>"
+	if rec != nil {
+		name = rec.Name
+	}
+	return &RecordError{File: file, Record: name, CI: ci, Err: err}
+}
+
+// Policy decides what happens to malformed records: strict runs abort on
+// the first one, lenient runs skip it with a warning.
+type Policy struct {
+	Strict  bool
+	skipped int64
+}
+
+// Malformed returns err in strict mode, otherwise logs it and returns nil
+func (p *Policy) Malformed(err *RecordError) error {
+	if p.Strict {
+		return err
+	}
+	atomic.AddInt64(&p.skipped, 1)
+	log.Printf("warning: skipping %v", err)
+	return nil
+}
+
+// Skipped returns the number of malformed records skipped so far
+func (p *Policy) Skipped() int64 {
+	return atomic.LoadInt64(&p.skipped)
+}
+
+// FirstError keeps the first error reported by concurrent workers
+type FirstError struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (f *FirstError) Set(err error) {
+	f.mu.Lock()
+	if f.err == nil {
+		f.err = err
+	}
+	f.mu.Unlock()
+}
+
+func (f *FirstError) Get() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
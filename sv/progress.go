@@ -0,0 +1,11 @@
+package sv
+
+import "log"
+
+// Progress writes a progress line to l, nothing if l is nil. Packages take
+// l from their config and leave it to main whether to print.
+func Progress(l *log.Logger, format string, v ...interface{}) {
+	if l != nil {
+		l.Printf(format, v...)
+	}
+}
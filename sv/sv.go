@@ -0,0 +1,135 @@
+// Package sv holds the structural variant model shared by the brosv packages,
+// together with the error types and the malformed record policy.
+package sv
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/balanur/brosv-go/interval"
+)
+
+// SV is a structural variant call from the input VCF. A breakend pair
+// (BND) joins Start on Chromosome to End on Chromosome2.
+type SV struct {
+	ID          string
+	Chromosome  string
+	Start       int
+	End         int
+	Type        string
+	CopyPos     int
+	Chromosome2 string
+	// strand of each breakend of a BND: '+' joins the sequence ending at
+	// the breakend, '-' the sequence starting at it
+	Strands string
+	// ID of the VCF record of the second breakend, if it has its own
+	MateID string
+}
+
+// Strand returns the strand of the left or right breakend of a BND
+func (sv SV) Strand(side interval.Side) byte {
+	if len(sv.Strands) != 2 || side == interval.Copy {
+		return '+'
+	}
+	return sv.Strands[side-interval.Left]
+}
+
+// Store holds SVs by ID
+type Store struct {
+	svMap map[string]SV
+	// SV ID by the ID of its mate record
+	mates map[string]string
+}
+
+func NewStore() *Store {
+	return &Store{svMap: make(map[string]SV), mates: make(map[string]string)}
+}
+
+func (store *Store) Add(sv SV) {
+	store.svMap[sv.ID] = sv
+	if sv.MateID != "" {
+		store.mates[sv.MateID] = sv.ID
+	}
+}
+
+func (store *Store) Get(id string) SV {
+	return store.svMap[id]
+}
+
+// Mate returns the BND whose second breakend is the record mateID
+func (store *Store) Mate(mateID string) (SV, bool) {
+	id, ok := store.mates[mateID]
+	if !ok {
+		return SV{}, false
+	}
+	return store.svMap[id], true
+}
+
+// IDs returns the IDs of the stored SVs in sorted order
+func (store *Store) IDs() []string {
+	result := make([]string, 0, len(store.svMap))
+	for id := range store.svMap {
+		result = append(result, id)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (store *Store) Len() int {
+	return len(store.svMap)
+}
+
+// Type is an SV type selected on the command line
+type Type int
+
+const (
+	None Type = iota
+	Del
+	Inv
+	Ins
+	TanDup
+	IntDup
+	Bnd
+	All
+)
+
+var typeByName = map[string]Type{
+	"del":    Del,
+	"inv":    Inv,
+	"ins":    Ins,
+	"tandup": TanDup,
+	"intdup": IntDup,
+	"bnd":    Bnd,
+	"all":    All,
+}
+
+func TypeNames() []string {
+	return []string{"del", "inv", "ins", "tandup", "intdup", "bnd", "all"}
+}
+
+func ParseType(name string) (Type, error) {
+	if svType, ok := typeByName[strings.ToLower(name)]; ok {
+		return svType, nil
+	}
+	return None, fmt.Errorf("unknown SV type %q (valid: %s)", name, strings.Join(TypeNames(), ", "))
+}
+
+// FilterName is the SVTYPE filter used when loading the VCF and comparing with a truth set
+func (svType Type) FilterName() string {
+	switch svType {
+	case Del:
+		return "DEL"
+	case Inv:
+		return "INV"
+	case Ins:
+		return "INS"
+	case TanDup:
+		return "tandup"
+	case IntDup:
+		return "intdup"
+	case Bnd:
+		return "BND"
+	}
+	return ""
+}
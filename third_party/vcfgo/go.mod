@@ -0,0 +1,3 @@
+module github.com/balanur/vcfgo
+
+go 1.21
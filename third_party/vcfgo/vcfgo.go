@@ -0,0 +1,354 @@
+// Package vcfgo reads VCF files record by record. It keeps the part of the
+// API of github.com/balanur/vcfgo that brosv uses, so the module builds
+// from this tree through the replace directive in its go.mod.
+package vcfgo
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Info is the declaration of an INFO field in the header
+type Info struct {
+	Id          string
+	Number      string
+	Type        string
+	Description string
+}
+
+// Header holds the declared INFO fields and the sample names of a VCF
+type Header struct {
+	Infos       map[string]*Info
+	SampleNames []string
+	Lines       []string
+}
+
+// Reader reads the records of a VCF
+type Reader struct {
+	Header      *Header
+	LazySamples bool
+
+	buf    *bufio.Reader
+	lineNo int
+	errs   []error
+}
+
+// NewReader reads the header of the VCF in r. Samples are not parsed,
+// lazySamples is kept for compatibility.
+func NewReader(r io.Reader, lazySamples bool) (*Reader, error) {
+	rdr := &Reader{
+		Header:      &Header{Infos: make(map[string]*Info)},
+		LazySamples: lazySamples,
+		buf:         bufio.NewReaderSize(r, 1<<16),
+	}
+	for {
+		line, err := rdr.readLine()
+		if err == io.EOF {
+			return nil, errors.New("vcfgo: no #CHROM header line")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if rdr.lineNo == 1 && !strings.HasPrefix(line, "##fileformat=VCF") {
+			return nil, fmt.Errorf("vcfgo: first line is not ##fileformat=VCF: %q", line)
+		}
+		if strings.HasPrefix(line, "#CHROM") {
+			fields := strings.Split(line, "\t")
+			if len(fields) > 9 {
+				rdr.Header.SampleNames = fields[9:]
+			}
+			return rdr, nil
+		}
+		if !strings.HasPrefix(line, "##") {
+			return nil, fmt.Errorf("vcfgo: header line %d: %q", rdr.lineNo, line)
+		}
+		rdr.Header.Lines = append(rdr.Header.Lines, line)
+		if strings.HasPrefix(line, "##INFO=<") {
+			info, err := parseInfo(line)
+			if err != nil {
+				return nil, fmt.Errorf("vcfgo: header line %d: %v", rdr.lineNo, err)
+			}
+			rdr.Header.Infos[info.Id] = info
+		}
+	}
+}
+
+func (r *Reader) readLine() (string, error) {
+	line, err := r.buf.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+	r.lineNo++
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// parseInfo reads an ##INFO=<ID=..,Number=..,Type=..,Description=".."> line
+func parseInfo(line string) (*Info, error) {
+	body := strings.TrimSuffix(strings.TrimPrefix(line, "##INFO=<"), ">")
+	info := &Info{}
+	for body != "" {
+		eq := strings.IndexByte(body, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("bad INFO declaration %q", line)
+		}
+		key, rest := body[:eq], body[eq+1:]
+		var value string
+		if strings.HasPrefix(rest, "\"") {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote in %q", line)
+			}
+			value, rest = rest[1:end+1], rest[end+2:]
+		} else if comma := strings.IndexByte(rest, ','); comma >= 0 {
+			value, rest = rest[:comma], rest[comma:]
+		} else {
+			value, rest = rest, ""
+		}
+		body = strings.TrimPrefix(rest, ",")
+		switch key {
+		case "ID":
+			info.Id = value
+		case "Number":
+			info.Number = value
+		case "Type":
+			info.Type = value
+		case "Description":
+			info.Description = value
+		}
+	}
+	if info.Id == "" {
+		return nil, fmt.Errorf("INFO declaration without ID %q", line)
+	}
+	return info, nil
+}
+
+// Read returns the next record, nil at the end of the file. A record that
+// does not parse is returned as far as it does, with the reason in Error.
+func (r *Reader) Read() *Variant {
+	for {
+		line, err := r.readLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			r.errs = append(r.errs, err)
+			return nil
+		}
+		if line == "" {
+			continue
+		}
+		return r.parse(line)
+	}
+}
+
+func (r *Reader) parse(line string) *Variant {
+	fields := strings.Split(line, "\t")
+	v := &Variant{Chromosome: fields[0], LineNumber: int64(r.lineNo), Info_: &infoMap{header: r.Header}}
+	if len(fields) < 8 {
+		r.errs = append(r.errs, fmt.Errorf("vcfgo: line %d has %d fields, want at least 8", r.lineNo, len(fields)))
+		return v
+	}
+	pos, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		r.errs = append(r.errs, fmt.Errorf("vcfgo: line %d: bad position %q", r.lineNo, fields[1]))
+	}
+	v.Pos = pos
+	v.Id_ = fields[2]
+	v.Reference = fields[3]
+	if fields[4] != "." {
+		v.Alternate = strings.Split(fields[4], ",")
+	}
+	if fields[5] != "." {
+		quality, err := strconv.ParseFloat(fields[5], 32)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("vcfgo: line %d: bad quality %q", r.lineNo, fields[5]))
+		}
+		v.Quality = float32(quality)
+	}
+	v.Filter = fields[6]
+	if fields[7] != "." {
+		for _, entry := range strings.Split(fields[7], ";") {
+			if entry == "" {
+				continue
+			}
+			key, value := entry, ""
+			if eq := strings.IndexByte(entry, '='); eq >= 0 {
+				key, value = entry[:eq], entry[eq+1:]
+			}
+			v.Info_.(*infoMap).add(key, value)
+		}
+	}
+	return v
+}
+
+// Error returns the errors of the records read since the last Clear
+func (r *Reader) Error() error {
+	if len(r.errs) == 0 {
+		return nil
+	}
+	return errors.Join(r.errs...)
+}
+
+// Clear forgets the errors reported by Error
+func (r *Reader) Clear() {
+	r.errs = nil
+}
+
+// Variant is a record of a VCF
+type Variant struct {
+	Chromosome string
+	Pos        uint64
+	Id_        string
+	Reference  string
+	Alternate  []string
+	Quality    float32
+	Filter     string
+	Info_      InfoMap
+	LineNumber int64
+}
+
+func (v *Variant) Id() string    { return v.Id_ }
+func (v *Variant) Ref() string   { return v.Reference }
+func (v *Variant) Alt() []string { return v.Alternate }
+func (v *Variant) Info() InfoMap { return v.Info_ }
+
+// InfoMap is the INFO column of a record
+type InfoMap interface {
+	Get(key string) (interface{}, error)
+	Set(key string, value interface{}) error
+	Keys() []string
+	String() string
+}
+
+// infoMap keeps the INFO entries of a record in their order, as text, and
+// converts them on Get by their declaration in the header
+type infoMap struct {
+	header *Header
+	keys   []string
+	values map[string]string
+}
+
+func (m *infoMap) add(key string, value string) {
+	if m.values == nil {
+		m.values = make(map[string]string)
+	}
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+// Get returns the value of key: bool for flags, int, float64 or string for
+// single values and a slice of them otherwise. Fields missing from the
+// header are integers if every value parses as one, strings if not.
+func (m *infoMap) Get(key string) (interface{}, error) {
+	value, ok := m.values[key]
+	if !ok {
+		return nil, fmt.Errorf("vcfgo: INFO field %s not found", key)
+	}
+	info, declared := m.header.Infos[key]
+	if declared && info.Type == "Flag" {
+		return true, nil
+	}
+	parts := strings.Split(value, ",")
+	single := len(parts) == 1
+	if declared {
+		single = info.Number == "1" || info.Number == "0"
+	}
+	typ := "String"
+	if declared {
+		typ = info.Type
+	} else if value != "" && allInts(parts) {
+		typ = "Integer"
+	}
+	switch typ {
+	case "Integer":
+		ints := make([]int, len(parts))
+		for i, part := range parts {
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, fmt.Errorf("vcfgo: INFO field %s: %q is not an integer", key, part)
+			}
+			ints[i] = n
+		}
+		if single && len(ints) == 1 {
+			return ints[0], nil
+		}
+		return ints, nil
+	case "Float":
+		floats := make([]float64, len(parts))
+		for i, part := range parts {
+			f, err := strconv.ParseFloat(part, 64)
+			if err != nil {
+				return nil, fmt.Errorf("vcfgo: INFO field %s: %q is not a number", key, part)
+			}
+			floats[i] = f
+		}
+		if single && len(floats) == 1 {
+			return floats[0], nil
+		}
+		return floats, nil
+	}
+	if single {
+		return value, nil
+	}
+	return parts, nil
+}
+
+func allInts(parts []string) bool {
+	for _, part := range parts {
+		if _, err := strconv.Atoi(part); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Set stores value as the text of key
+func (m *infoMap) Set(key string, value interface{}) error {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			m.add(key, "")
+		}
+	case []int:
+		parts := make([]string, len(v))
+		for i, n := range v {
+			parts[i] = strconv.Itoa(n)
+		}
+		m.add(key, strings.Join(parts, ","))
+	case []string:
+		m.add(key, strings.Join(v, ","))
+	default:
+		m.add(key, fmt.Sprint(v))
+	}
+	return nil
+}
+
+// Keys returns the INFO keys in the order of the record
+func (m *infoMap) Keys() []string {
+	return m.keys
+}
+
+// String is the INFO column of the record
+func (m *infoMap) String() string {
+	if len(m.keys) == 0 {
+		return "."
+	}
+	entries := make([]string, len(m.keys))
+	for i, key := range m.keys {
+		if info, ok := m.header.Infos[key]; ok && info.Type == "Flag" {
+			entries[i] = key
+		} else {
+			entries[i] = key + "=" + m.values[key]
+		}
+	}
+	return strings.Join(entries, ";")
+}
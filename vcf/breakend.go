@@ -0,0 +1,287 @@
+package vcf
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/balanur/brosv-go/genome"
+	"github.com/balanur/brosv-go/interval"
+	"github.com/balanur/brosv-go/sv"
+	"github.com/balanur/brosv-go/vote"
+	"github.com/balanur/vcfgo"
+)
+
+// bracketAlt is a BND ALT in bracket notation: t[p[, t]p], ]p]t or [p[t
+type bracketAlt struct {
+	// t, the reference base of the breakend with any inserted bases
+	seq     string
+	mateChr string
+	matePos int
+	// strands of the breakend and of its mate, see sv.SV
+	strands string
+}
+
+func parseBracketAlt(alt string) (bracketAlt, bool) {
+	var result bracketAlt
+	i := strings.IndexAny(alt, "[]")
+	if i < 0 {
+		return result, false
+	}
+	bracket := alt[i]
+	j := strings.IndexByte(alt[i+1:], bracket)
+	if j < 0 {
+		return result, false
+	}
+	j += i + 1
+	mate := alt[i+1 : j]
+	colon := strings.LastIndexByte(mate, ':')
+	if colon <= 0 {
+		return result, false
+	}
+	pos, err := strconv.Atoi(mate[colon+1:])
+	if err != nil {
+		return result, false
+	}
+	result.mateChr, result.matePos = mate[:colon], pos
+
+	strand := byte('-')
+	switch {
+	case i > 0 && j == len(alt)-1:
+		strand = '+'
+		result.seq = alt[:i]
+	case i == 0 && j < len(alt)-1:
+		result.seq = alt[j+1:]
+	default:
+		return result, false
+	}
+	mateStrand := byte('+')
+	if bracket == '[' {
+		mateStrand = '-'
+	}
+	result.strands = string([]byte{strand, mateStrand})
+	return result, true
+}
+
+func (a bracketAlt) String() string {
+	bracket := "]"
+	if a.strands[1] == '-' {
+		bracket = "["
+	}
+	mate := bracket + a.mateChr + ":" + strconv.Itoa(a.matePos) + bracket
+	if a.strands[0] == '+' {
+		return a.seq + mate
+	}
+	return mate + a.seq
+}
+
+// inserted returns the bases of t beyond the reference base
+func (a bracketAlt) inserted() string {
+	if len(a.seq) < 2 {
+		return ""
+	}
+	if a.strands[0] == '+' {
+		return a.seq[1:]
+	}
+	return a.seq[:len(a.seq)-1]
+}
+
+// strands written by callers using CHR2/POS2 instead of bracket ALTs
+var connectionTypes = map[string]string{
+	"3to5": "+-",
+	"5to3": "-+",
+	"3to3": "++",
+	"5to5": "--",
+}
+
+// setBreakend sets the second breakend, strands and mate record of a BND
+// from its bracket ALT and MATEID, or from CHR2 with POS2 or END and the
+// CT or STRANDS of the record. Joins of unknown strands are taken as '+-'.
+func setBreakend(call *sv.SV, variant *vcfgo.Variant) error {
+	info := variant.Info()
+	if mateID, ok := infoString(info, "MATEID"); ok {
+		call.MateID = mateID
+	}
+	if alt, ok := parseBracketAlt(variant.Alt()[0]); ok {
+		call.Chromosome2, call.End, call.Strands = alt.mateChr, alt.matePos, alt.strands
+		return nil
+	}
+
+	chr2, ok := infoString(info, "CHR2")
+	if !ok {
+		return fmt.Errorf("no bracket ALT or CHR2")
+	}
+	call.Chromosome2 = chr2
+	pos2, err := info.Get("POS2")
+	if err != nil {
+		if pos2, err = info.Get("END"); err != nil {
+			return fmt.Errorf("no POS2 or END")
+		}
+	}
+	if call.End, err = infoInt(pos2); err != nil {
+		return fmt.Errorf("bad POS2: %v", err)
+	}
+	call.Strands = "+-"
+	if ct, ok := infoString(info, "CT"); ok {
+		if strands, ok := connectionTypes[ct]; ok {
+			call.Strands = strands
+		}
+	} else if strands, ok := infoString(info, "STRANDS"); ok && len(strands) >= 2 && strings.Trim(strands[:2], "+-") == "" {
+		call.Strands = strands[:2]
+	}
+	return nil
+}
+
+// mateBreakend is a loaded BND waiting for the record of its second
+// breakend, with the CI to give that breakend
+type mateBreakend struct {
+	call sv.SV
+	ci   [2]int
+}
+
+// breakendInterval is the CI of a breakend at pos, widened by ci. The
+// reads of a '+' breakend lie before it, those of a '-' breakend after it.
+func breakendInterval(call sv.SV, side interval.Side, ci [2]int, segmentSize int) interval.Interval {
+	pos := call.Start
+	if side == interval.Right {
+		pos = call.End
+	}
+	result := interval.Interval{Head: pos + ci[0] - 100, Tail: pos + ci[1] + 100, SVID: call.ID, Side: side}
+	if call.Strand(side) == '+' {
+		result.Head -= segmentSize
+	} else {
+		result.Tail += segmentSize
+	}
+	if result.Head < 0 {
+		result.Head = 1
+	}
+	return result
+}
+
+// breakendOf returns the BND of a record and the side of its breakend the
+// record describes
+func breakendOf(fields []string, svs *sv.Store) (sv.SV, interval.Side, bool) {
+	id := strings.TrimSpace(fields[2])
+	pos, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return sv.SV{}, 0, false
+	}
+	if call := svs.Get(id); call.ID == id && call.Type == "BND" && call.Chromosome == fields[0] && call.Start == pos {
+		return call, interval.Left, true
+	}
+	if call, ok := svs.Mate(id); ok && call.Chromosome2 == fields[0] && call.End == pos {
+		return call, interval.Right, true
+	}
+	return sv.SV{}, 0, false
+}
+
+// breakend is one end of a refined BND
+type breakend struct {
+	chr    string
+	pos    int
+	orig   int
+	strand byte
+	voted  bool
+	vote   vote.Breakpoint
+}
+
+func newBreakend(call sv.SV, side interval.Side, votes map[string]vote.Breakpoint) breakend {
+	b := breakend{chr: call.Chromosome, pos: call.Start, strand: call.Strand(side)}
+	if side == interval.Right {
+		b.chr, b.pos = call.Chromosome2, call.End
+	}
+	b.orig = b.pos
+	b.vote, b.voted = votes[call.ID]
+	if b.voted {
+		// votes are the last base before the junction; the record of a
+		// '-' breakend is at the first base after it
+		b.pos = b.vote.Pos
+		if b.strand == '-' {
+			b.pos++
+		}
+	}
+	return b
+}
+
+// refineBreakend moves the breakends of the BND record in fields, the
+// record of side of call, to their voted positions. A record whose mate
+// breakend has no record of its own is followed by one, so the output
+// always holds the pair. It returns nil if the record was not refined.
+func refineBreakend(fields []string, ref genome.Genome, call sv.SV, side interval.Side, top vote.Breakpoints) [][]string {
+	left := newBreakend(call, interval.Left, top.Left)
+	right := newBreakend(call, interval.Right, top.Right)
+	if left.vote.VoteNum < minSupport && right.vote.VoteNum < minSupport && top.Pairs[call.ID] < minSupport {
+		return nil
+	}
+
+	if call.MateID != "" {
+		id, mateID, own, mate := call.ID, call.MateID, left, right
+		if side == interval.Right {
+			id, mateID, own, mate = call.MateID, call.ID, right, left
+		}
+		record := breakendRecord(fields, ref, call, top, own, mate, id, mateID, true)
+		if record == nil {
+			return nil
+		}
+		return [][]string{record}
+	}
+
+	mateID := call.ID + "_2"
+	first := breakendRecord(fields, ref, call, top, left, right, call.ID, mateID, true)
+	second := breakendRecord(fields, ref, call, top, right, left, mateID, call.ID, false)
+	if first == nil || second == nil {
+		return nil
+	}
+	return [][]string{first, second}
+}
+
+// breakendRecord returns a copy of fields as the record of breakend own
+// joined to mate. Inserted bases of the ALT are kept if the record in
+// fields is that of own.
+func breakendRecord(fields []string, ref genome.Genome, call sv.SV, top vote.Breakpoints, own breakend, mate breakend, id string, mateID string, isOwn bool) []string {
+	chr := ref.Chr(own.chr).Content
+	if own.pos < 1 || own.pos > len(chr) {
+		return nil
+	}
+	alt := bracketAlt{seq: chr[own.pos-1 : own.pos], mateChr: mate.chr, matePos: mate.pos, strands: string([]byte{own.strand, mate.strand})}
+	if old, ok := parseBracketAlt(fields[4]); ok && isOwn {
+		if own.strand == '+' {
+			alt.seq += old.inserted()
+		} else {
+			alt.seq = old.inserted() + alt.seq
+		}
+	}
+
+	info := parseInfo(fields[7])
+	ciEnd, hasCIEnd := info.get("CIEND")
+	// the mate breakend is in the ALT and its own record
+	for _, key := range []string{"END", "SVLEN", "CHR2", "POS2", "CIEND"} {
+		info.remove(key)
+	}
+	info.set("SVTYPE", "BND")
+	info.set("MATEID", mateID)
+	info.set("ORIGPOS", strconv.Itoa(own.orig))
+	info.set("SRSUPL", strconv.Itoa(top.Left[call.ID].VoteNum))
+	info.set("SRSUPR", strconv.Itoa(top.Right[call.ID].VoteNum))
+	setSupport(info, call.ID, top)
+	if own.voted {
+		info.set("CIPOS", formatCI(own.vote.CI))
+	} else if !isOwn && hasCIEnd {
+		info.set("CIPOS", ciEnd)
+	} else if !isOwn {
+		info.remove("CIPOS")
+	}
+	info.setFlag(MultimodalFlag, own.vote.Multimodal || mate.vote.Multimodal)
+
+	record := append([]string(nil), fields...)
+	record[0] = own.chr
+	record[1] = strconv.Itoa(own.pos)
+	record[2] = id
+	record[3] = alt.seq[:1]
+	if own.strand == '-' {
+		record[3] = alt.seq[len(alt.seq)-1:]
+	}
+	record[4] = alt.String()
+	record[7] = info.String()
+	return record
+}
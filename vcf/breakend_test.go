@@ -0,0 +1,214 @@
+package vcf
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/balanur/brosv-go/interval"
+	"github.com/balanur/brosv-go/sv"
+	"github.com/balanur/vcfgo"
+)
+
+func TestParseBracketAlt(t *testing.T) {
+	tests := []struct {
+		alt      string
+		ok       bool
+		want     bracketAlt
+		inserted string
+	}{
+		{alt: "G[chr2:3000[", ok: true, want: bracketAlt{seq: "G", mateChr: "chr2", matePos: 3000, strands: "+-"}},
+		{alt: "G]chr2:3000]", ok: true, want: bracketAlt{seq: "G", mateChr: "chr2", matePos: 3000, strands: "++"}},
+		{alt: "]chr2:3000]G", ok: true, want: bracketAlt{seq: "G", mateChr: "chr2", matePos: 3000, strands: "-+"}},
+		{alt: "[chr2:3000[G", ok: true, want: bracketAlt{seq: "G", mateChr: "chr2", matePos: 3000, strands: "--"}},
+		{alt: "GTT[chr2:3000[", ok: true, want: bracketAlt{seq: "GTT", mateChr: "chr2", matePos: 3000, strands: "+-"}, inserted: "TT"},
+		{alt: "[chr2:3000[TTG", ok: true, want: bracketAlt{seq: "TTG", mateChr: "chr2", matePos: 3000, strands: "--"}, inserted: "TT"},
+		// contigs whose names hold a colon
+		{alt: "G[HLA-A*01:01:01:01:3000[", ok: true, want: bracketAlt{seq: "G", mateChr: "HLA-A*01:01:01:01", matePos: 3000, strands: "+-"}},
+		{alt: "<DEL>"},
+		{alt: "G[chr2:3000"},
+		{alt: "G[chr2:x["},
+		{alt: "G[3000["},
+		{alt: "[chr2:3000["},
+		{alt: "G[chr2:3000[G"},
+	}
+	for _, tt := range tests {
+		got, ok := parseBracketAlt(tt.alt)
+		if ok != tt.ok {
+			t.Errorf("%s: parsed %v, want %v", tt.alt, ok, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: %+v, want %+v", tt.alt, got, tt.want)
+		}
+		if got.String() != tt.alt {
+			t.Errorf("%s: written back as %s", tt.alt, got.String())
+		}
+		if got.inserted() != tt.inserted {
+			t.Errorf("%s: inserted %q, want %q", tt.alt, got.inserted(), tt.inserted)
+		}
+	}
+}
+
+// readVariants reads the records of a VCF body under a header declaring
+// the INFO fields of breakends
+func readVariants(t *testing.T, body string) []*vcfgo.Variant {
+	header := `##fileformat=VCFv4.2
+##INFO=<ID=SVTYPE,Number=1,Type=String,Description="Type of structural variant">
+##INFO=<ID=END,Number=1,Type=Integer,Description="End position">
+##INFO=<ID=CIPOS,Number=2,Type=Integer,Description="Confidence interval around POS">
+##INFO=<ID=CIEND,Number=2,Type=Integer,Description="Confidence interval around END">
+##INFO=<ID=MATEID,Number=.,Type=String,Description="ID of the mate breakend">
+##INFO=<ID=CHR2,Number=1,Type=String,Description="Chromosome of the second breakend">
+##INFO=<ID=POS2,Number=1,Type=Integer,Description="Position of the second breakend">
+##INFO=<ID=CT,Number=1,Type=String,Description="Connection type">
+##INFO=<ID=STRANDS,Number=.,Type=String,Description="Strands of the breakends">
+#CHROM	POS	ID	REF	ALT	QUAL	FILTER	INFO
+`
+	rdr, err := vcfgo.NewReader(strings.NewReader(header+body), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var variants []*vcfgo.Variant
+	for variant := rdr.Read(); variant != nil; variant = rdr.Read() {
+		if err := rdr.Error(); err != nil {
+			t.Fatal(err)
+		}
+		variants = append(variants, variant)
+	}
+	return variants
+}
+
+func TestSetBreakend(t *testing.T) {
+	tests := []struct {
+		name   string
+		record string
+		ok     bool
+		want   sv.SV
+	}{
+		{
+			name:   "bracket ALT with mate",
+			record: "chr1\t1000\tbnd\tA\t]chr2:3000]A\t.\tPASS\tSVTYPE=BND;MATEID=bnd_2",
+			ok:     true,
+			want:   sv.SV{Chromosome2: "chr2", End: 3000, Strands: "-+", MateID: "bnd_2"},
+		},
+		{
+			name:   "CHR2 and POS2 with CT",
+			record: "chr1\t1000\ttra\tA\t<TRA>\t.\tPASS\tSVTYPE=TRA;CHR2=chr3;POS2=9000;CT=5to5",
+			ok:     true,
+			want:   sv.SV{Chromosome2: "chr3", End: 9000, Strands: "--"},
+		},
+		{
+			name:   "CHR2 and END with STRANDS",
+			record: "chr1\t1000\ttra\tA\t<TRA>\t.\tPASS\tSVTYPE=TRA;CHR2=chr3;END=9000;STRANDS=++:4",
+			ok:     true,
+			want:   sv.SV{Chromosome2: "chr3", End: 9000, Strands: "++"},
+		},
+		{
+			name:   "CT takes precedence over STRANDS",
+			record: "chr1\t1000\ttra\tA\t<TRA>\t.\tPASS\tSVTYPE=TRA;CHR2=chr3;POS2=9000;CT=3to3;STRANDS=--:4",
+			ok:     true,
+			want:   sv.SV{Chromosome2: "chr3", End: 9000, Strands: "++"},
+		},
+		{
+			name:   "unknown CT",
+			record: "chr1\t1000\ttra\tA\t<TRA>\t.\tPASS\tSVTYPE=TRA;CHR2=chr3;POS2=9000;CT=NtoN",
+			ok:     true,
+			want:   sv.SV{Chromosome2: "chr3", End: 9000, Strands: "+-"},
+		},
+		{
+			name:   "bad STRANDS",
+			record: "chr1\t1000\ttra\tA\t<TRA>\t.\tPASS\tSVTYPE=TRA;CHR2=chr3;POS2=9000;STRANDS=x",
+			ok:     true,
+			want:   sv.SV{Chromosome2: "chr3", End: 9000, Strands: "+-"},
+		},
+		{
+			name:   "no CHR2",
+			record: "chr1\t1000\ttra\tA\t<TRA>\t.\tPASS\tSVTYPE=TRA;POS2=9000",
+		},
+		{
+			name:   "no POS2 or END",
+			record: "chr1\t1000\ttra\tA\t<TRA>\t.\tPASS\tSVTYPE=TRA;CHR2=chr3",
+		},
+	}
+	for _, tt := range tests {
+		variant := readVariants(t, tt.record+"\n")[0]
+		var got sv.SV
+		err := setBreakend(&got, variant)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: error %v, want ok %v", tt.name, err, tt.ok)
+			continue
+		}
+		if tt.ok && got != tt.want {
+			t.Errorf("%s: %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+const breakendCalls = `chr1	1000	bnd1	A	A[chr2:3000[	.	PASS	SVTYPE=BND;MATEID=bnd1_2;CIPOS=-10,10;CIEND=-50,50
+chr1	5000	bnd2	G	G]chr3:7000]	.	PASS	SVTYPE=BND;CIEND=-5,5
+chr2	3000	bnd1_2	C	]chr1:1000]C	.	PASS	SVTYPE=BND;MATEID=bnd1;CIPOS=-20,30
+chr2	8000	bnd3	N	<TRA>	.	PASS	SVTYPE=TRA;CHR2=chr3;POS2=9000;CT=5to5
+chr1	9000	bnd4	T	T[chr3:1000[	.	PASS	SVTYPE=BND;MATEID=bnd4_2;CIEND=-7,7
+`
+
+func TestLoadBreakends(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "calls.vcf")
+	content := `##fileformat=VCFv4.2
+##INFO=<ID=SVTYPE,Number=1,Type=String,Description="Type of structural variant">
+##INFO=<ID=CIPOS,Number=2,Type=Integer,Description="Confidence interval around POS">
+##INFO=<ID=CIEND,Number=2,Type=Integer,Description="Confidence interval around END">
+##INFO=<ID=MATEID,Number=.,Type=String,Description="ID of the mate breakend">
+##INFO=<ID=CHR2,Number=1,Type=String,Description="Chromosome of the second breakend">
+##INFO=<ID=POS2,Number=1,Type=Integer,Description="Position of the second breakend">
+##INFO=<ID=CT,Number=1,Type=String,Description="Connection type">
+#CHROM	POS	ID	REF	ALT	QUAL	FILTER	INFO
+` + breakendCalls
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	svs, cis, err := Load(file, LoadConfig{Type: sv.Bnd, SegmentSize: 300, Policy: &sv.Policy{Strict: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if svs.Len() != 4 {
+		t.Errorf("%d SVs, want 4: the records of a MATEID pair load as one", svs.Len())
+	}
+
+	tests := []struct {
+		id         string
+		side       interval.Side
+		chr        string
+		head, tail int
+	}{
+		// a '+' breakend reads back over the insert size, a '-' one ahead
+		{"bnd1", interval.Left, "chr1", 1000 - 10 - 100 - 300, 1000 + 10 + 100},
+		// the mate record gives its CIPOS, not the CIEND of bnd1
+		{"bnd1", interval.Right, "chr2", 3000 - 20 - 100, 3000 + 30 + 100 + 300},
+		{"bnd2", interval.Left, "chr1", 5000 - 100 - 300, 5000 + 100},
+		// without a mate record CIEND widens the second breakend
+		{"bnd2", interval.Right, "chr3", 7000 - 5 - 100 - 300, 7000 + 5 + 100},
+		{"bnd3", interval.Left, "chr2", 8000 - 100, 8000 + 100 + 300},
+		{"bnd3", interval.Right, "chr3", 9000 - 100, 9000 + 100 + 300},
+		// a mate record missing from the file leaves CIEND
+		{"bnd4", interval.Right, "chr3", 1000 - 7 - 100, 1000 + 7 + 100 + 300},
+	}
+	for _, tt := range tests {
+		ciIndex, ok := cis.Side(tt.id, tt.side)
+		if !ok {
+			t.Errorf("%s: no CI on side %v", tt.id, tt.side)
+			continue
+		}
+		ci := cis.Get(ciIndex)
+		if ci.Chr != tt.chr || ci.Head != tt.head || ci.Tail != tt.tail {
+			t.Errorf("%s side %v: CI %s:%d-%d, want %s:%d-%d", tt.id, tt.side, ci.Chr, ci.Head, ci.Tail, tt.chr, tt.head, tt.tail)
+		}
+	}
+	if call := svs.Get("bnd1"); call.Chromosome2 != "chr2" || call.End != 3000 || call.Strands != "+-" {
+		t.Errorf("bnd1 joins %s:%d %s, want chr2:3000 +-", call.Chromosome2, call.End, call.Strands)
+	}
+}
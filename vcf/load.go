@@ -0,0 +1,342 @@
+// Package vcf loads the SV calls to refine and writes the refined callset.
+package vcf
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/balanur/brosv-go/interval"
+	"github.com/balanur/brosv-go/sv"
+	"github.com/balanur/vcfgo"
+)
+
+// infoInt reads an integer INFO field, which vcfgo may hand back as int or string
+func infoInt(value interface{}) (int, error) {
+	switch v := value.(type) {
+	case int:
+		return v, nil
+	case string:
+		return strconv.Atoi(v)
+	case []int:
+		if len(v) == 1 {
+			return v[0], nil
+		}
+	}
+	return 0, fmt.Errorf("not an integer: %v", value)
+}
+
+// infoPair reads a two-valued integer INFO field such as CIPOS
+func infoPair(value interface{}) ([2]int, error) {
+	var result [2]int
+	switch v := value.(type) {
+	case []int:
+		if len(v) == 2 {
+			result[0], result[1] = v[0], v[1]
+			return result, nil
+		}
+	case []interface{}:
+		if len(v) == 2 {
+			var err error
+			if result[0], err = infoInt(v[0]); err != nil {
+				return result, err
+			}
+			result[1], err = infoInt(v[1])
+			return result, err
+		}
+	}
+	return result, fmt.Errorf("not an integer pair: %v", value)
+}
+
+// infoString reads a string INFO field, the first value if it has several
+func infoString(info vcfgo.InfoMap, key string) (string, bool) {
+	value, err := info.Get(key)
+	if err != nil {
+		return "", false
+	}
+	switch v := value.(type) {
+	case string:
+		return v, v != ""
+	case []string:
+		if len(v) > 0 {
+			return v[0], v[0] != ""
+		}
+	case []interface{}:
+		if len(v) > 0 {
+			s, ok := v[0].(string)
+			return s, ok && s != ""
+		}
+	}
+	return "", false
+}
+
+// LoadConfig selects the records of the VCF to refine
+type LoadConfig struct {
+	// SV type to keep, sv.All for every record
+	Type sv.Type
+	// substring the SAMPLE INFO field must contain
+	Sample string
+	// insert size mean, sets the size of the CIs
+	SegmentSize int
+	Policy      *sv.Policy
+}
+
+// Load reads the SVs of a VCF and builds the confidence intervals around
+// their breakpoints, widened by the insert size. The two records of a BND
+// pair load as one SV, with a CI on the chromosome of each breakend
+// widened by the CIPOS of its record; a BND without a mate record widens
+// its second breakend by CIEND.
+func Load(fileName string, cfg LoadConfig) (*sv.Store, *interval.Store, error) {
+	svStore := sv.NewStore()
+	ciStore := interval.NewStore()
+	filter := cfg.Type.FilterName()
+	samplefilter := cfg.Sample
+	segmentSize := cfg.SegmentSize
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		return svStore, ciStore, &sv.FileError{Op: "open", File: fileName, Err: err}
+	}
+	defer f.Close()
+	rdr, err := vcfgo.NewReader(f, false)
+	if err != nil {
+		return svStore, ciStore, &sv.FileError{Op: "read", File: fileName, Err: err}
+	}
+
+	var filter2 string
+	if filter == "tandup" {
+		filter = "DUP"
+		filter2 = "DUP:TANDEM"
+	} else if filter == "intdup" {
+		filter = "DUP"
+		filter2 = "DUP:ISP"
+	}
+	// BNDs loaded whose mate record is still to come, by ID
+	mates := make(map[string]mateBreakend)
+	for {
+		variant := rdr.Read()
+
+		if variant == nil {
+			break
+		}
+		record := variant.Chromosome + ":" + strconv.FormatUint(variant.Pos, 10) + " " + variant.Id()
+		malformed := func(err error) error {
+			return cfg.Policy.Malformed(&sv.RecordError{File: fileName, Record: record, CI: -1, Err: err})
+		}
+		if err := rdr.Error(); err != nil {
+			rdr.Clear()
+			if err := malformed(err); err != nil {
+				return svStore, ciStore, err
+			}
+			continue
+		}
+
+		svTypeValue, err := variant.Info().Get("SVTYPE")
+		svType, ok := svTypeValue.(string)
+		if err != nil || !ok {
+			if err := malformed(fmt.Errorf("missing SVTYPE")); err != nil {
+				return svStore, ciStore, err
+			}
+			continue
+		}
+		sample, _ := variant.Info().Get("SAMPLE")
+
+		if len(variant.Alt()) == 0 {
+			if err := malformed(fmt.Errorf("missing ALT")); err != nil {
+				return svStore, ciStore, err
+			}
+			continue
+		}
+		if svType == "TRA" {
+			svType = "BND"
+		}
+		if !strings.Contains(svType, filter) || !strings.Contains(variant.Alt()[0], filter2) {
+			continue
+		}
+
+		if sampleName, ok := sample.(string); ok && !strings.Contains(sampleName, samplefilter) {
+			continue
+		}
+
+		var tempSV sv.SV
+		tempSV.Start = int(variant.Pos)
+		endPosition, err := variant.Info().Get("END")
+		if err == nil {
+			tempSV.End, err = infoInt(endPosition)
+		} else if svType == "INS" || svType == "BND" {
+			// an insertion point may come without END, a breakend
+			// has its mate elsewhere
+			tempSV.End, err = tempSV.Start, nil
+		}
+		if err != nil {
+			if err := malformed(fmt.Errorf("bad END: %v", err)); err != nil {
+				return svStore, ciStore, err
+			}
+			continue
+		}
+		tempSV.Chromosome = variant.Chromosome
+
+		if tempSV.Chromosome == "MT" {
+			continue
+		}
+
+		tempSV.Type = svType
+		tempSV.ID = strings.TrimSpace(variant.Id())
+
+		if svType == "BND" {
+			// the record of the second breakend of a loaded pair gives the
+			// CI of that breakend
+			if mateID, ok := infoString(variant.Info(), "MATEID"); ok && svStore.Get(mateID).ID == mateID {
+				mate, ok := mates[mateID]
+				if !ok {
+					continue
+				}
+				if value, err := variant.Info().Get("CIPOS"); err == nil {
+					ciPos, err := infoPair(value)
+					if err != nil {
+						if err := malformed(fmt.Errorf("bad CIPOS: %v", err)); err != nil {
+							return svStore, ciStore, err
+						}
+						continue
+					}
+					mate.ci = ciPos
+				}
+				ciStore.Add(mate.call.Chromosome2, breakendInterval(mate.call, interval.Right, mate.ci, segmentSize))
+				delete(mates, mateID)
+				continue
+			}
+			if err := setBreakend(&tempSV, variant); err != nil {
+				if err := malformed(fmt.Errorf("bad BND: %v", err)); err != nil {
+					return svStore, ciStore, err
+				}
+				continue
+			}
+			if tempSV.Chromosome2 == "MT" {
+				continue
+			}
+			var ciPos, ciEnd [2]int
+			if value, err := variant.Info().Get("CIPOS"); err == nil {
+				ciPos, err = infoPair(value)
+				if err != nil {
+					if err := malformed(fmt.Errorf("bad CIPOS: %v", err)); err != nil {
+						return svStore, ciStore, err
+					}
+					continue
+				}
+			}
+			if value, err := variant.Info().Get("CIEND"); err == nil {
+				ciEnd, err = infoPair(value)
+				if err != nil {
+					if err := malformed(fmt.Errorf("bad CIEND: %v", err)); err != nil {
+						return svStore, ciStore, err
+					}
+					continue
+				}
+			}
+			svStore.Add(tempSV)
+			ciStore.Add(tempSV.Chromosome, breakendInterval(tempSV, interval.Left, ciPos, segmentSize))
+			if tempSV.MateID != "" {
+				// wait for the CIPOS of the mate record, CIEND if it has none
+				mates[tempSV.ID] = mateBreakend{call: tempSV, ci: ciEnd}
+				continue
+			}
+			ciStore.Add(tempSV.Chromosome2, breakendInterval(tempSV, interval.Right, ciEnd, segmentSize))
+			continue
+		}
+
+		svsize := tempSV.End - tempSV.Start
+
+		var leftInterval interval.Interval
+		leftInterval.Head = tempSV.Start
+		leftInterval.Tail = tempSV.Start
+		leftInterval.SVID = tempSV.ID
+		leftInterval.Side = interval.Left
+		if ciPos, err := variant.Info().Get("CIPOS"); err == nil {
+			ci, err := infoPair(ciPos)
+			if err != nil {
+				if err := malformed(fmt.Errorf("bad CIPOS: %v", err)); err != nil {
+					return svStore, ciStore, err
+				}
+				continue
+			}
+			leftInterval.Head = tempSV.Start + ci[0]
+			leftInterval.Tail = tempSV.Start + ci[1]
+		}
+
+		var rightInterval interval.Interval
+		rightInterval.Head = tempSV.End
+		rightInterval.Tail = tempSV.End
+		rightInterval.SVID = tempSV.ID
+		rightInterval.Side = interval.Right
+		if ciEnd, err := variant.Info().Get("CIEND"); err == nil {
+			ci, err := infoPair(ciEnd)
+			if err != nil {
+				if err := malformed(fmt.Errorf("bad CIEND: %v", err)); err != nil {
+					return svStore, ciStore, err
+				}
+				continue
+			}
+			rightInterval.Head = tempSV.End + ci[0]
+			rightInterval.Tail = tempSV.End + ci[1]
+		}
+
+		var copyInterval interval.Interval
+		hasCopy := false
+		if filter2 == "DUP:ISP" {
+			if strings.Contains(variant.Alt()[0], "DUP:ISP") {
+				start, err := variant.Info().Get("POS2")
+				if err == nil {
+					tempSV.CopyPos, err = infoInt(start)
+				}
+				if err != nil {
+					if err := malformed(fmt.Errorf("bad POS2: %v", err)); err != nil {
+						return svStore, ciStore, err
+					}
+					continue
+				}
+				copyInterval.Head = tempSV.CopyPos - (segmentSize + 100)
+				copyInterval.Tail = tempSV.CopyPos + (segmentSize + 100)
+				copyInterval.SVID = tempSV.ID
+				copyInterval.Side = interval.Copy
+
+				if copyInterval.Head < 0 {
+					copyInterval.Head = 1
+				}
+				hasCopy = true
+			}
+		}
+
+		svStore.Add(tempSV)
+
+		if svsize < segmentSize+100 {
+			leftInterval.Tail += svsize / 2
+			rightInterval.Head -= svsize / 2
+		} else {
+			leftInterval.Tail += (segmentSize + 100)
+			rightInterval.Head -= (segmentSize + 100)
+		}
+		leftInterval.Head -= 100
+		rightInterval.Tail += 100
+
+		if leftInterval.Head < 0 {
+			leftInterval.Head = 1
+		}
+		if rightInterval.Head < 0 {
+			rightInterval.Head = 1
+		}
+		ciStore.Add(tempSV.Chromosome, leftInterval)
+		ciStore.Add(tempSV.Chromosome, rightInterval)
+		if hasCopy {
+			ciStore.Add(tempSV.Chromosome, copyInterval)
+		}
+	}
+	// mates missing from the file take CIEND, in ID order
+	for _, id := range svStore.IDs() {
+		if mate, ok := mates[id]; ok {
+			ciStore.Add(mate.call.Chromosome2, breakendInterval(mate.call, interval.Right, mate.ci, segmentSize))
+		}
+	}
+	ciStore.BuildIndex()
+	return svStore, ciStore, nil
+}
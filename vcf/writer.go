@@ -0,0 +1,580 @@
+package vcf
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/balanur/brosv-go/genome"
+	"github.com/balanur/brosv-go/interval"
+	"github.com/balanur/brosv-go/sv"
+	"github.com/balanur/brosv-go/vote"
+)
+
+// minimum split read votes on one side, or discordant pairs, for an SV to be refined
+const minSupport = 5
+
+// FILTER set on records whose breakpoints were not refined
+const NotRefinedFilter = "NOTREFINED"
+
+// INFO flag set on records whose votes are multimodal on any side
+const MultimodalFlag = "MULTIMODAL"
+
+// INFO flag set on records whose assembled breakpoints disagree with the
+// voted ones
+const AssemblyDisagreesFlag = "ASMDISAGREE"
+
+// FILTER set on calls of a somatic run the matched normal supports
+const GermlineFilter = "GERMLINE"
+
+// Samples are the sample columns of the output. In somatic runs Normal
+// marks the columns of the matched normal, and calls whose normal columns
+// have more than MaxNormalSupport alternate reads and pairs are germline.
+type Samples struct {
+	Names            []string
+	Normal           []bool
+	MaxNormalSupport int
+}
+
+// Somatic reports whether the samples are a tumor/normal pair
+func (s Samples) Somatic() bool {
+	for _, normal := range s.Normal {
+		if normal {
+			return true
+		}
+	}
+	return false
+}
+
+type headerLine struct {
+	kind string
+	id   string
+	line string
+}
+
+// header lines added to the input header, by ID
+var addedHeader = []headerLine{
+	{"INFO", "ORIGPOS", `##INFO=<ID=ORIGPOS,Number=1,Type=Integer,Description="POS before breakpoint refinement">`},
+	{"INFO", "ORIGEND", `##INFO=<ID=ORIGEND,Number=1,Type=Integer,Description="END before breakpoint refinement">`},
+	{"INFO", "ORIGPOS2", `##INFO=<ID=ORIGPOS2,Number=1,Type=Integer,Description="POS2 before breakpoint refinement">`},
+	{"INFO", "SRSUPL", `##INFO=<ID=SRSUPL,Number=1,Type=Integer,Description="Number of supporting split reads on left">`},
+	{"INFO", "SRSUPR", `##INFO=<ID=SRSUPR,Number=1,Type=Integer,Description="Number of supporting split reads on right">`},
+	{"INFO", "SR", `##INFO=<ID=SR,Number=1,Type=Integer,Description="Number of split reads supporting the refined breakpoints">`},
+	{"INFO", "PE", `##INFO=<ID=PE,Number=1,Type=Integer,Description="Number of discordant read pairs supporting the SV">`},
+	{"INFO", "SRSUPCPY", `##INFO=<ID=SRSUPCPY,Number=1,Type=Integer,Description="Number of supporting split reads on the copy locus">`},
+	{"INFO", "CIPOS", `##INFO=<ID=CIPOS,Number=2,Type=Integer,Description="Confidence interval around POS">`},
+	{"INFO", "CIEND", `##INFO=<ID=CIEND,Number=2,Type=Integer,Description="Confidence interval around END">`},
+	{"INFO", "MATEID", `##INFO=<ID=MATEID,Number=.,Type=String,Description="ID of mate breakends">`},
+	{"INFO", "SVINSSEQ", `##INFO=<ID=SVINSSEQ,Number=.,Type=String,Description="Sequence of insertion">`},
+	{"INFO", "LEFT_SVINSSEQ", `##INFO=<ID=LEFT_SVINSSEQ,Number=.,Type=String,Description="Known left side of insertion for an insertion of unknown length">`},
+	{"INFO", "RIGHT_SVINSSEQ", `##INFO=<ID=RIGHT_SVINSSEQ,Number=.,Type=String,Description="Known right side of insertion for an insertion of unknown length">`},
+	{"INFO", MultimodalFlag, `##INFO=<ID=` + MultimodalFlag + `,Number=0,Type=Flag,Description="Split read votes of a breakpoint fall into more than one mode">`},
+	{"FILTER", NotRefinedFilter, `##FILTER=<ID=` + NotRefinedFilter + `,Description="Breakpoints were not refined, coordinates are from the input">`},
+	{"FORMAT", "GT", `##FORMAT=<ID=GT,Number=1,Type=String,Description="Genotype">`},
+	{"FORMAT", "GQ", `##FORMAT=<ID=GQ,Number=1,Type=Integer,Description="Genotype quality">`},
+	{"FORMAT", "PL", `##FORMAT=<ID=PL,Number=G,Type=Integer,Description="Phred scaled genotype likelihoods">`},
+	{"FORMAT", "AD", `##FORMAT=<ID=AD,Number=R,Type=Integer,Description="Reads and pairs supporting the reference and alternate alleles">`},
+	{"FORMAT", "SR", `##FORMAT=<ID=SR,Number=1,Type=Integer,Description="Number of split reads supporting the alternate allele">`},
+	{"FORMAT", "PE", `##FORMAT=<ID=PE,Number=1,Type=Integer,Description="Number of discordant read pairs supporting the alternate allele">`},
+}
+
+// header lines added in somatic runs only
+var somaticHeader = []headerLine{
+	{"INFO", "TUMOR_SR", `##INFO=<ID=TUMOR_SR,Number=1,Type=Integer,Description="Number of tumor split reads supporting the SV">`},
+	{"INFO", "TUMOR_PE", `##INFO=<ID=TUMOR_PE,Number=1,Type=Integer,Description="Number of tumor discordant read pairs supporting the SV">`},
+	{"INFO", "NORMAL_SR", `##INFO=<ID=NORMAL_SR,Number=1,Type=Integer,Description="Number of normal split reads supporting the SV">`},
+	{"INFO", "NORMAL_PE", `##INFO=<ID=NORMAL_PE,Number=1,Type=Integer,Description="Number of normal discordant read pairs supporting the SV">`},
+	{"INFO", "TUMOR_VAF", `##INFO=<ID=TUMOR_VAF,Number=1,Type=Float,Description="Share of the tumor reads and pairs at the breakpoints supporting the SV">`},
+	{"FILTER", GermlineFilter, `##FILTER=<ID=` + GermlineFilter + `,Description="The matched normal supports the SV">`},
+}
+
+// header lines added when contigs were assembled
+var assemblyHeader = []headerLine{
+	{"INFO", "ASMPOS", `##INFO=<ID=ASMPOS,Number=1,Type=Integer,Description="Left breakpoint placed by the assembled contigs">`},
+	{"INFO", "ASMEND", `##INFO=<ID=ASMEND,Number=1,Type=Integer,Description="Right breakpoint placed by the assembled contigs">`},
+	{"INFO", "ASMPOS2", `##INFO=<ID=ASMPOS2,Number=1,Type=Integer,Description="Copy locus breakpoint placed by the assembled contigs">`},
+	{"INFO", "ASMCONTIGS", `##INFO=<ID=ASMCONTIGS,Number=1,Type=Integer,Description="Number of assembled contigs aligned across the SV">`},
+	{"INFO", AssemblyDisagreesFlag, `##INFO=<ID=` + AssemblyDisagreesFlag + `,Number=0,Type=Flag,Description="Assembled and voted breakpoints differ by more than the tolerance">`},
+}
+
+// FORMAT column of every record, see genotypeColumn
+const formatColumn = "GT:GQ:PL:AD:SR:PE"
+
+// sampleColumns lines the sample columns of the input VCF up with the
+// samples genotyped: a genotyped sample takes the input column of its name
+// if there is one, or a column after those of the input
+type sampleColumns struct {
+	names []string
+	// index of each column among the input samples and among the
+	// genotyped ones, -1 if it is not there
+	input, genotyped []int
+}
+
+func newSampleColumns(input []string, genotyped []string) sampleColumns {
+	var c sampleColumns
+	byName := make(map[string]int)
+	for i, name := range input {
+		c.names = append(c.names, name)
+		c.input = append(c.input, i)
+		c.genotyped = append(c.genotyped, -1)
+		byName[name] = i
+	}
+	for i, name := range genotyped {
+		if column, ok := byName[name]; ok && c.genotyped[column] < 0 {
+			c.genotyped[column] = i
+			continue
+		}
+		c.names = append(c.names, name)
+		c.input = append(c.input, -1)
+		c.genotyped = append(c.genotyped, i)
+	}
+	return c
+}
+
+// format returns the FORMAT and sample columns of a record: the keys of
+// formatColumn first, then those of the input FORMAT in fields, with the
+// values of genotypes, the genotype columns of the samples genotyped, in
+// place of the input ones. Keys a sample has no value for are '.'.
+func (c sampleColumns) format(fields []string, genotypes []string) []string {
+	keys := strings.Split(formatColumn, ":")
+	var inputKeys []string
+	if len(fields) > 8 {
+		inputKeys = strings.Split(fields[8], ":")
+	}
+	for _, key := range inputKeys {
+		if !strings.Contains(":"+formatColumn+":", ":"+key+":") {
+			keys = append(keys, key)
+		}
+	}
+
+	result := []string{strings.Join(keys, ":")}
+	for column := range c.names {
+		values := make(map[string]string)
+		if i := c.input[column]; i >= 0 && 9+i < len(fields) {
+			for k, value := range strings.Split(fields[9+i], ":") {
+				if k < len(inputKeys) {
+					values[inputKeys[k]] = value
+				}
+			}
+		}
+		if i := c.genotyped[column]; i >= 0 {
+			for k, value := range strings.Split(genotypes[i], ":") {
+				values[keys[k]] = value
+			}
+		}
+		sample := make([]string, len(keys))
+		for k, key := range keys {
+			sample[k] = values[key]
+			if sample[k] == "" {
+				sample[k] = "."
+			}
+		}
+		result = append(result, strings.Join(sample, ":"))
+	}
+	return result
+}
+
+// WriteRefined copies the input VCF to outfilePath. Records whose top voted
+// breakpoints have enough support are moved to the voted positions, keep
+// their input coordinates in ORIGPOS/ORIGEND and get CIPOS/CIEND from the
+// spread of the votes; every other record is passed
+// through unchanged apart from the NOTREFINED filter. Refined BNDs are
+// written as pairs of breakend records linked by MATEID. Header and QUAL
+// come from the input, as do the FORMAT and sample columns, with the
+// genotype of every sample called from top.Support merged in: its keys go
+// first in FORMAT and each sample fills the column of its name, a new one
+// if the input has none (see sampleColumns). In somatic
+// runs records also get the tumor and normal support and the tumor VAF,
+// and those the normal supports are filtered as GERMLINE. With contigs
+// assembled the breakpoints they place are written next to the voted ones.
+// It returns the number of SVs refined.
+func WriteRefined(inputPath string, outfilePath string, refFilePath string, svs *sv.Store, top vote.Breakpoints, samples Samples) (int, error) {
+	f, err := os.Open(inputPath)
+	if err != nil {
+		return 0, &sv.FileError{Op: "open", File: inputPath, Err: err}
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1<<20), 1<<26)
+
+	g, err := os.Create(outfilePath)
+	if err != nil {
+		return 0, &sv.FileError{Op: "create", File: outfilePath, Err: err}
+	}
+	defer g.Close()
+	writer := bufio.NewWriter(g)
+
+	ref, err := genome.Read(refFilePath)
+	if err != nil {
+		return 0, err
+	}
+
+	header := addedHeader
+	if samples.Somatic() {
+		header = append(header[:len(header):len(header)], somaticHeader...)
+	}
+	if top.Assembled != nil {
+		header = append(header[:len(header):len(header)], assemblyHeader...)
+	}
+	seen := make(map[string]bool)
+	columns := newSampleColumns(nil, samples.Names)
+	refined := 0
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if strings.HasPrefix(text, "##") {
+			for _, h := range header {
+				if strings.HasPrefix(text, "##"+h.kind+"=<ID="+h.id+",") {
+					seen[h.kind+h.id] = true
+				}
+			}
+			writer.WriteString(text + "\n")
+			continue
+		}
+		if strings.HasPrefix(text, "#") {
+			for _, h := range header {
+				if !seen[h.kind+h.id] {
+					writer.WriteString(h.line + "\n")
+				}
+			}
+			names := strings.Split(text, "\t")
+			if len(names) > 9 {
+				columns = newSampleColumns(names[9:], samples.Names)
+			}
+			if len(names) > 8 {
+				names = names[:8]
+			}
+			names = append(append(names, "FORMAT"), columns.names...)
+			writer.WriteString(strings.Join(names, "\t") + "\n")
+			continue
+		}
+		if text == "" {
+			continue
+		}
+
+		fields := strings.Split(text, "\t")
+		if len(fields) < 8 {
+			return 0, &sv.RecordError{File: inputPath, Record: "line " + strconv.Itoa(line), CI: -1, Err: fmt.Errorf("expected at least 8 columns, got %d", len(fields))}
+		}
+		call, side, isBreakend := breakendOf(fields, svs)
+		if !isBreakend {
+			call = svs.Get(strings.TrimSpace(fields[2]))
+		}
+		genotypes := make([]string, len(samples.Names))
+		for sample := range samples.Names {
+			genotypes[sample] = genotypeColumn(top.SupportOf(call.ID, sample))
+		}
+		fields = append(fields[:8:8], columns.format(fields, genotypes)...)
+		if samples.Somatic() {
+			setSomatic(fields, call.ID, top, samples)
+		}
+		if a, ok := top.Assembled[call.ID]; ok {
+			setAssembled(fields, a)
+		}
+		if isBreakend {
+			records := refineBreakend(fields, ref, call, side, top)
+			if records == nil {
+				fields[6] = addFilter(fields[6], NotRefinedFilter)
+				records = [][]string{fields}
+			} else if side == interval.Left {
+				refined++
+			}
+			for _, record := range records {
+				writer.WriteString(strings.Join(record, "\t") + "\n")
+			}
+			continue
+		}
+		if refineRecord(fields, ref, svs, top) {
+			refined++
+		} else {
+			fields[6] = addFilter(fields[6], NotRefinedFilter)
+		}
+		writer.WriteString(strings.Join(fields, "\t") + "\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, &sv.FileError{Op: "read", File: inputPath, Err: err}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return 0, &sv.FileError{Op: "write", File: outfilePath, Err: err}
+	}
+	return refined, nil
+}
+
+// refineRecord moves the record in fields to its voted breakpoints. It
+// returns false, leaving fields alone, if the record was not refined.
+func refineRecord(fields []string, ref genome.Genome, svs *sv.Store, top vote.Breakpoints) bool {
+	id := strings.TrimSpace(fields[2])
+	call := svs.Get(id)
+	pos, err := strconv.Atoi(fields[1])
+	if err != nil || call.ID != id || call.Chromosome != fields[0] || call.Start != pos {
+		return false
+	}
+	left, hasLeft := top.Left[id]
+	right, hasRight := top.Right[id]
+	copyLoc, hasCopy := top.Copy[id]
+
+	// if there is enough support
+	if left.VoteNum < minSupport && right.VoteNum < minSupport && top.Pairs[id] < minSupport {
+		return false
+	}
+	newPos, newEnd := call.Start, call.End
+	if hasLeft {
+		newPos = left.Pos
+	}
+	if hasRight {
+		newEnd = right.Pos
+	}
+	// both CIs of an insertion surround the insertion point
+	isInsertion := strings.EqualFold(call.Type, "INS")
+	ciLeft, ciRight := left.CI, right.CI
+	if isInsertion {
+		point, _, _ := top.InsertionPoint(id)
+		newPos, newEnd = point.Pos, point.Pos
+		ciLeft, ciRight = point.CI, point.CI
+	}
+	REF, ALT := getREFALT(ref, call, newPos-1, newEnd, fields[4])
+	if REF == "." {
+		return false
+	}
+
+	info := parseInfo(fields[7])
+	svlen := newEnd - newPos
+	if old, ok := info.get("SVLEN"); ok && strings.HasPrefix(old, "-") {
+		svlen = -svlen
+	}
+	info.set("END", strconv.Itoa(newEnd))
+	if !isInsertion {
+		info.set("SVLEN", strconv.Itoa(svlen))
+	}
+	info.set("ORIGPOS", strconv.Itoa(call.Start))
+	info.set("ORIGEND", strconv.Itoa(call.End))
+	info.set("SRSUPL", strconv.Itoa(left.VoteNum))
+	info.set("SRSUPR", strconv.Itoa(right.VoteNum))
+	setSupport(info, call.ID, top)
+	if hasLeft || isInsertion {
+		info.set("CIPOS", formatCI(ciLeft))
+	}
+	if hasRight || isInsertion {
+		info.set("CIEND", formatCI(ciRight))
+	}
+	if ins, ok := top.Insertions[id]; ok && isInsertion {
+		setInsertion(info, ins)
+	}
+	info.setFlag(MultimodalFlag, left.Multimodal || right.Multimodal || copyLoc.Multimodal)
+	if call.Type == "DUP:ISP" && hasCopy {
+		info.set("POS2", strconv.Itoa(copyLoc.Pos))
+		info.set("ORIGPOS2", strconv.Itoa(call.CopyPos))
+		info.set("SRSUPCPY", strconv.Itoa(copyLoc.VoteNum))
+	}
+
+	fields[1] = strconv.Itoa(newPos)
+	fields[3] = REF
+	fields[4] = ALT
+	fields[7] = info.String()
+	return true
+}
+
+// genotypeColumn is the sample column of an SV with support s
+func genotypeColumn(s vote.Support) string {
+	g := s.Genotype()
+	gq, pl := ".", "."
+	if g.Called() {
+		gq = strconv.Itoa(g.GQ)
+		pl = strconv.Itoa(g.PL[0]) + "," + strconv.Itoa(g.PL[1]) + "," + strconv.Itoa(g.PL[2])
+	}
+	ad := strconv.Itoa(s.Ref()) + "," + strconv.Itoa(s.Alt())
+	return strings.Join([]string{g.GT, gq, pl, ad, strconv.Itoa(s.AltReads), strconv.Itoa(s.AltPairs)}, ":")
+}
+
+// setSomatic writes the support of the tumor and the normal for an SV and
+// the tumor VAF, filtering the SV as germline if the normal supports it
+func setSomatic(fields []string, id string, top vote.Breakpoints, samples Samples) {
+	var tumor, normal vote.Support
+	for sample, isNormal := range samples.Normal {
+		s := top.SupportOf(id, sample)
+		sum := &tumor
+		if isNormal {
+			sum = &normal
+		}
+		sum.AltReads += s.AltReads
+		sum.AltPairs += s.AltPairs
+		sum.RefReads += s.RefReads
+		sum.RefPairs += s.RefPairs
+	}
+	info := parseInfo(fields[7])
+	info.set("TUMOR_SR", strconv.Itoa(tumor.AltReads))
+	info.set("TUMOR_PE", strconv.Itoa(tumor.AltPairs))
+	info.set("NORMAL_SR", strconv.Itoa(normal.AltReads))
+	info.set("NORMAL_PE", strconv.Itoa(normal.AltPairs))
+	if depth := tumor.Alt() + tumor.Ref(); depth > 0 {
+		info.set("TUMOR_VAF", strconv.FormatFloat(float64(tumor.Alt())/float64(depth), 'f', 3, 64))
+	}
+	fields[7] = info.String()
+	if normal.Alt() > samples.MaxNormalSupport {
+		fields[6] = addFilter(fields[6], GermlineFilter)
+	}
+}
+
+// setAssembled writes the breakpoints the contigs of an SV place, flagging
+// disagreement with the voted ones
+func setAssembled(fields []string, a vote.Assembled) {
+	info := parseInfo(fields[7])
+	for _, bp := range []struct {
+		key string
+		pos int
+	}{{"ASMPOS", a.Left}, {"ASMEND", a.Right}, {"ASMPOS2", a.Copy}} {
+		if bp.pos > 0 {
+			info.set(bp.key, strconv.Itoa(bp.pos))
+		}
+	}
+	info.set("ASMCONTIGS", strconv.Itoa(a.Contigs))
+	info.setFlag(AssemblyDisagreesFlag, a.Disagrees)
+	fields[7] = info.String()
+}
+
+// setSupport writes the split read and discordant pair support of an SV,
+// each read counted once however many of its breakpoints it votes for
+func setSupport(info *infoField, id string, top vote.Breakpoints) {
+	info.set("SR", strconv.Itoa(top.Reads[id]))
+	info.set("PE", strconv.Itoa(top.Pairs[id]))
+}
+
+// setInsertion writes the recovered sequence of an insertion: the whole of
+// it with its length, or the ends reads reached
+func setInsertion(info *infoField, ins vote.Insertion) {
+	if ins.Complete() {
+		info.set("SVINSSEQ", ins.Seq)
+		info.set("SVLEN", strconv.Itoa(len(ins.Seq)))
+		return
+	}
+	if ins.Left != "" {
+		info.set("LEFT_SVINSSEQ", ins.Left)
+	}
+	if ins.Right != "" {
+		info.set("RIGHT_SVINSSEQ", ins.Right)
+	}
+}
+
+// getREFALT returns the reference base at start and the ALT to write:
+// symbolic ALTs are kept, anything else is replaced by the symbolic SV type
+func getREFALT(ref genome.Genome, call sv.SV, start int, end int, alt string) (string, string) {
+	if end <= start {
+		return ".", "."
+	}
+	if start < 0 {
+		return ".", "."
+	}
+
+	chr := ref.Chr(call.Chromosome).Content
+	if end > len(chr) {
+		return ".", "."
+	}
+	REF := chr[start : start+1]
+
+	if strings.HasPrefix(alt, "<") {
+		return REF, alt
+	}
+	return REF, "<" + call.Type + ">"
+}
+
+func formatCI(ci [2]int) string {
+	return strconv.Itoa(ci[0]) + "," + strconv.Itoa(ci[1])
+}
+
+func addFilter(filter string, name string) string {
+	if filter == "." || filter == "PASS" || filter == "" {
+		return name
+	}
+	for _, f := range strings.Split(filter, ";") {
+		if f == name {
+			return filter
+		}
+	}
+	return filter + ";" + name
+}
+
+// infoField is an INFO column kept in its input order
+type infoField struct {
+	keys   []string
+	values map[string]string
+	flags  map[string]bool
+}
+
+func parseInfo(column string) *infoField {
+	info := &infoField{values: make(map[string]string), flags: make(map[string]bool)}
+	if column == "." || column == "" {
+		return info
+	}
+	for _, entry := range strings.Split(column, ";") {
+		key, value, hasValue := strings.Cut(entry, "=")
+		if _, ok := info.values[key]; !ok && !info.flags[key] {
+			info.keys = append(info.keys, key)
+		}
+		if hasValue {
+			info.values[key] = value
+		} else {
+			info.flags[key] = true
+		}
+	}
+	return info
+}
+
+func (info *infoField) get(key string) (string, bool) {
+	value, ok := info.values[key]
+	return value, ok
+}
+
+// set replaces the value of key, or appends key if the column has none
+func (info *infoField) set(key string, value string) {
+	if _, ok := info.values[key]; !ok && !info.flags[key] {
+		info.keys = append(info.keys, key)
+	}
+	delete(info.flags, key)
+	info.values[key] = value
+}
+
+// remove drops key, valued or flag, from the column
+func (info *infoField) remove(key string) {
+	delete(info.values, key)
+	delete(info.flags, key)
+	for i, k := range info.keys {
+		if k == key {
+			info.keys = append(info.keys[:i], info.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// setFlag adds or removes the flag key
+func (info *infoField) setFlag(key string, on bool) {
+	_, hasValue := info.values[key]
+	present := hasValue || info.flags[key]
+	if !on {
+		info.remove(key)
+		return
+	}
+	if !present {
+		info.keys = append(info.keys, key)
+	}
+	delete(info.values, key)
+	info.flags[key] = true
+}
+
+func (info *infoField) String() string {
+	if len(info.keys) == 0 {
+		return "."
+	}
+	entries := make([]string, 0, len(info.keys))
+	for _, key := range info.keys {
+		if info.flags[key] {
+			entries = append(entries, key)
+		} else {
+			entries = append(entries, key+"="+info.values[key])
+		}
+	}
+	return strings.Join(entries, ";")
+}
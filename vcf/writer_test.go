@@ -0,0 +1,36 @@
+package vcf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSampleColumns(t *testing.T) {
+	columns := newSampleColumns([]string{"tumor", "other"}, []string{"normal", "tumor"})
+	if want := []string{"tumor", "other", "normal"}; !reflect.DeepEqual(columns.names, want) {
+		t.Fatalf("columns %v, want %v", columns.names, want)
+	}
+	fields := strings.Split("1\t100\tdel1\tN\t<DEL>\t.\tPASS\tSVTYPE=DEL\tGT:CN:FT\t0/1:1:PASS\t1/1:0", "\t")
+	genotypes := []string{"0/0:20:0,20,200:10,0:0:0", "0/1:30:30,0,300:5,5:3:2"}
+	got := columns.format(fields, genotypes)
+	want := []string{
+		"GT:GQ:PL:AD:SR:PE:CN:FT",
+		"0/1:30:30,0,300:5,5:3:2:1:PASS",
+		"1/1:.:.:.:.:.:0:.",
+		"0/0:20:0,20,200:10,0:0:0:.:.",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("format\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestSampleColumnsWithoutInput(t *testing.T) {
+	columns := newSampleColumns(nil, []string{"sample"})
+	fields := strings.Split("1\t100\tdel1\tN\t<DEL>\t.\tPASS\tSVTYPE=DEL", "\t")
+	got := columns.format(fields, []string{"0/1:30:30,0,300:5,5:3:2"})
+	want := []string{formatColumn, "0/1:30:30,0,300:5,5:3:2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("format %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,137 @@
+package vote
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/balanur/brosv-go/bamio"
+	"github.com/balanur/brosv-go/interval"
+	"github.com/balanur/brosv-go/sv"
+	"github.com/biogo/hts/sam"
+)
+
+// Assembled is where the contigs assembled for an SV place its
+// breakpoints, 1-based like the voted ones and 0 on sides no contig
+// crosses, with the number of contigs aligned across it. Disagrees is set
+// by SetAssembled when a side is voted elsewhere.
+type Assembled struct {
+	Left, Right, Copy int
+	Contigs           int
+	Disagrees         bool
+}
+
+// At returns the assembled breakpoint of a side, 0 if none
+func (a Assembled) At(side interval.Side) int {
+	switch side {
+	case interval.Left:
+		return a.Left
+	case interval.Right:
+		return a.Right
+	case interval.Copy:
+		return a.Copy
+	}
+	return 0
+}
+
+// ReadAssembled reads the contigs split-aligned by aligner.AlignContigs
+// and places each side of every SV at the breakpoint most of its contigs
+// cross, the leftmost on ties.
+func ReadAssembled(bamFilePath string, cis *interval.Store, policy *sv.Policy) (map[string]Assembled, error) {
+	bamReader, err := bamio.Open(bamFilePath, "", 1)
+	if err != nil {
+		return nil, err
+	}
+	defer bamReader.Close()
+
+	sides := []interval.Side{interval.Left, interval.Right, interval.Copy}
+	votes := make(map[string]map[interval.Side]map[int]int)
+	contigs := make(map[string]int)
+	for {
+		rec, err := bamReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, &sv.FileError{Op: "read", File: bamFilePath, Err: err}
+		}
+		// the primary record of a split contig stands for both parts
+		if rec.Flags&sam.Supplementary != 0 {
+			continue
+		}
+		ciIndex, err := bamio.TagValue(rec, bamio.SVTag)
+		if err == nil && !cis.Valid(ciIndex) {
+			err = fmt.Errorf("no CI %d", ciIndex)
+		}
+		if err != nil {
+			if err := policy.Malformed(sv.ReadError(bamFilePath, rec, -1, err)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		id := cis.Get(ciIndex).SVID
+		if votes[id] == nil {
+			votes[id] = make(map[interval.Side]map[int]int)
+		}
+		contigs[id]++
+		for _, side := range sides {
+			if rec.AuxFields.Get(bamio.BreakpointTag(side)) == nil {
+				continue
+			}
+			pos, err := bamio.TagValue(rec, bamio.BreakpointTag(side))
+			if err != nil {
+				if err := policy.Malformed(sv.ReadError(bamFilePath, rec, ciIndex, err)); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if votes[id][side] == nil {
+				votes[id][side] = make(map[int]int)
+			}
+			votes[id][side][pos]++
+		}
+	}
+
+	result := make(map[string]Assembled)
+	for id, bySide := range votes {
+		a := Assembled{Contigs: contigs[id]}
+		for side, counts := range bySide {
+			best, bestCount := 0, 0
+			for pos, n := range counts {
+				if n > bestCount || (n == bestCount && pos < best) {
+					best, bestCount = pos, n
+				}
+			}
+			switch side {
+			case interval.Left:
+				a.Left = best
+			case interval.Right:
+				a.Right = best
+			case interval.Copy:
+				a.Copy = best
+			}
+		}
+		result[id] = a
+	}
+	return result, nil
+}
+
+// SetAssembled keeps the assembled breakpoints of every SV next to the
+// voted ones, marking SVs with a side voted more than tolerance bp away
+// from where the contigs place it
+func (top *Breakpoints) SetAssembled(assembled map[string]Assembled, tolerance int) {
+	top.Assembled = make(map[string]Assembled)
+	voted := map[interval.Side]map[string]Breakpoint{interval.Left: top.Left, interval.Right: top.Right, interval.Copy: top.Copy}
+	for id, a := range assembled {
+		for side, bps := range voted {
+			bp, ok := bps[id]
+			pos := a.At(side)
+			if !ok || pos == 0 {
+				continue
+			}
+			if diff := bp.Pos - pos; diff > tolerance || -diff > tolerance {
+				a.Disagrees = true
+			}
+		}
+		top.Assembled[id] = a
+	}
+}
@@ -0,0 +1,117 @@
+package vote
+
+import (
+	"sort"
+
+	"github.com/balanur/brosv-go/signal"
+)
+
+// Config controls how the vote distribution of a CI is summarized
+type Config struct {
+	// fraction of the weighted votes the refined confidence interval holds
+	CIFraction float64
+	// voted positions further apart than ModeGap belong to different modes
+	ModeGap int
+	// a mode holding at least ModeRatio of the votes of the top mode makes the CI multimodal
+	ModeRatio float64
+	// insert size distribution of each read group for the paired-end model
+	Inserts signal.InsertSizes
+	// samples whose votes refine the breakpoints, all if empty
+	Voting map[int]bool
+}
+
+// votes reports whether the votes of sample refine the breakpoints
+func (cfg Config) votes(sample int) bool {
+	return len(cfg.Voting) == 0 || cfg.Voting[sample]
+}
+
+func DefaultConfig() Config {
+	return Config{CIFraction: 0.95, ModeGap: 10, ModeRatio: 0.25}
+}
+
+// Distribution is the list of voted positions of one CI
+type Distribution []Loc
+
+// Breakpoint is a refined breakpoint: the most voted position, the
+// confidence interval around it relative to Pos, and whether the votes
+// fall into more than one mode. Pairs counts the discordant pairs of the
+// CI, see Combine.
+type Breakpoint struct {
+	Loc
+	CI         [2]int
+	Total      int
+	Multimodal bool
+	Pairs      int
+}
+
+// Summarize finds the breakpoint of a distribution
+func (dist Distribution) Summarize(cfg Config) Breakpoint {
+	var result Breakpoint
+	if len(dist) == 0 {
+		return result
+	}
+	sorted := append(Distribution(nil), dist...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Pos < sorted[j].Pos })
+
+	top := 0
+	for i, loc := range sorted {
+		result.Total += loc.VoteNum
+		if loc.VoteNum > sorted[top].VoteNum {
+			top = i
+		}
+	}
+	result.Loc = sorted[top]
+
+	lo, hi := sorted.window(result.Total, cfg.CIFraction)
+	if sorted[lo].Pos > result.Pos {
+		lo = top
+	}
+	if sorted[hi].Pos < result.Pos {
+		hi = top
+	}
+	result.CI = [2]int{sorted[lo].Pos - result.Pos, sorted[hi].Pos - result.Pos}
+	result.Multimodal = sorted.multimodal(cfg.ModeGap, cfg.ModeRatio)
+	return result
+}
+
+// window returns the narrowest run of positions holding fraction of the
+// total votes; ties go to the run with more votes
+func (sorted Distribution) window(total int, fraction float64) (int, int) {
+	need := fraction * float64(total)
+	bestLo, bestHi, bestVotes := 0, len(sorted)-1, total
+	votes := 0
+	lo := 0
+	for hi := range sorted {
+		votes += sorted[hi].VoteNum
+		for lo < hi && float64(votes-sorted[lo].VoteNum) >= need {
+			votes -= sorted[lo].VoteNum
+			lo++
+		}
+		if float64(votes) < need {
+			continue
+		}
+		width := sorted[hi].Pos - sorted[lo].Pos
+		bestWidth := sorted[bestHi].Pos - sorted[bestLo].Pos
+		if width < bestWidth || (width == bestWidth && votes > bestVotes) {
+			bestLo, bestHi, bestVotes = lo, hi, votes
+		}
+	}
+	return bestLo, bestHi
+}
+
+// multimodal splits the positions into modes at gaps wider than gap and
+// reports whether a second mode holds at least ratio of the votes of the top one
+func (sorted Distribution) multimodal(gap int, ratio float64) bool {
+	var modes []int
+	for i, loc := range sorted {
+		if i == 0 || loc.Pos-sorted[i-1].Pos > gap {
+			modes = append(modes, 0)
+		}
+		modes[len(modes)-1] += loc.VoteNum
+	}
+	if len(modes) < 2 {
+		return false
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(modes)))
+	return modes[1] >= 2 && float64(modes[1]) >= ratio*float64(modes[0])
+}
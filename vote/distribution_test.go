@@ -0,0 +1,78 @@
+package vote
+
+import "testing"
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		name string
+		dist Distribution
+		// CIFraction, 0.95 if 0
+		fraction   float64
+		pos        int
+		ci         [2]int
+		multimodal bool
+	}{
+		{
+			name: "single tight mode",
+			dist: Distribution{{1001, 4}, {998, 2}, {1000, 20}, {1002, 1}, {999, 5}},
+			pos:  1000,
+			ci:   [2]int{-2, 1},
+		},
+		{
+			// the narrowest window holding the votes is 200-203, past
+			// the top position
+			name:       "window right of the top position",
+			dist:       Distribution{{100, 5}, {200, 4}, {201, 4}, {202, 4}, {203, 4}},
+			fraction:   0.75,
+			pos:        100,
+			ci:         [2]int{0, 103},
+			multimodal: true,
+		},
+		{
+			name:       "window left of the top position",
+			dist:       Distribution{{100, 4}, {101, 4}, {102, 4}, {103, 4}, {200, 5}},
+			fraction:   0.75,
+			pos:        200,
+			ci:         [2]int{-100, 0},
+			multimodal: true,
+		},
+		{
+			name:       "two separated modes",
+			dist:       Distribution{{100, 10}, {101, 5}, {150, 6}, {151, 2}},
+			pos:        100,
+			ci:         [2]int{0, 51},
+			multimodal: true,
+		},
+		{
+			name: "second mode under ModeRatio",
+			dist: Distribution{{100, 10}, {101, 5}, {150, 3}},
+			pos:  100,
+			ci:   [2]int{0, 50},
+		},
+		{
+			name: "second mode of a single vote",
+			dist: Distribution{{100, 2}, {150, 1}},
+			pos:  100,
+			ci:   [2]int{0, 50},
+		},
+		{
+			name: "positions ModeGap apart share a mode",
+			dist: Distribution{{100, 10}, {110, 10}},
+			pos:  100,
+			ci:   [2]int{0, 10},
+		},
+	}
+	for _, tt := range tests {
+		cfg := Config{CIFraction: 0.95, ModeGap: 10, ModeRatio: 0.25}
+		if tt.fraction != 0 {
+			cfg.CIFraction = tt.fraction
+		}
+		got := tt.dist.Summarize(cfg)
+		if got.Pos != tt.pos || got.CI != tt.ci || got.Multimodal != tt.multimodal {
+			t.Errorf("%s: %d %v multimodal %v, want %d %v multimodal %v", tt.name, got.Pos, got.CI, got.Multimodal, tt.pos, tt.ci, tt.multimodal)
+		}
+		if got.CI[0] > 0 || got.CI[1] < 0 {
+			t.Errorf("%s: CI %v does not hold the top position", tt.name, got.CI)
+		}
+	}
+}
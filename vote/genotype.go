@@ -0,0 +1,144 @@
+package vote
+
+import (
+	"math"
+	"strings"
+
+	"github.com/balanur/brosv-go/signal"
+	"github.com/balanur/brosv-go/sv"
+)
+
+// share of alternate reads expected of each genotype: 0/0, 0/1 and 1/1,
+// away from 0 and 1 for mapping errors
+var altShares = [3]float64{0.05, 0.5, 0.95}
+
+// highest GQ written
+const maxGQ = 99
+
+// Support is the evidence of one sample for the alleles of an SV: split
+// reads and discordant pairs for the alternate allele, reads spanning the
+// breakpoints and concordant pairs across them for the reference
+type Support struct {
+	AltReads, AltPairs int
+	RefReads, RefPairs int
+}
+
+// Alt is the number of reads and pairs supporting the alternate allele
+func (s Support) Alt() int {
+	return s.AltReads + s.AltPairs
+}
+
+// Ref is the number of reads and pairs supporting the reference allele
+func (s Support) Ref() int {
+	return s.RefReads + s.RefPairs
+}
+
+// Genotype is the called genotype of a sample with its phred scaled
+// quality and likelihoods, PL[i] for i alternate alleles
+type Genotype struct {
+	GT string
+	GQ int
+	PL [3]int
+}
+
+// Called reports whether there was any evidence to call the genotype from
+func (g Genotype) Called() bool {
+	return g.GT != "./."
+}
+
+// Genotype calls the genotype the support fits best, with each read or
+// pair drawn from the alternate allele at the share of the genotype
+func (s Support) Genotype() Genotype {
+	ref, alt := float64(s.Ref()), float64(s.Alt())
+	if ref+alt == 0 {
+		return Genotype{GT: "./."}
+	}
+	var logL [3]float64
+	best := 0
+	for i, share := range altShares {
+		logL[i] = alt*math.Log10(share) + ref*math.Log10(1-share)
+		if logL[i] > logL[best] {
+			best = i
+		}
+	}
+	var result Genotype
+	second := math.MaxInt32
+	for i := range logL {
+		result.PL[i] = int(math.Round(-10 * (logL[i] - logL[best])))
+		if i != best && result.PL[i] < second {
+			second = result.PL[i]
+		}
+	}
+	result.GT = [3]string{"0/0", "0/1", "1/1"}[best]
+	result.GQ = second
+	if result.GQ > maxGQ {
+		result.GQ = maxGQ
+	}
+	return result
+}
+
+// Loci returns the breakpoints of every SV to count the reference allele
+// at: the refined ones, or those of the input call for sides without votes
+func (top Breakpoints) Loci(svs *sv.Store) []signal.Locus {
+	var result []signal.Locus
+	for _, id := range svs.IDs() {
+		call := svs.Get(id)
+		if strings.EqualFold(call.Type, "INS") {
+			pos := call.Start
+			if bp, _, ok := top.InsertionPoint(id); ok {
+				pos = bp.Pos
+			}
+			result = append(result, signal.Locus{SVID: id, Chr: call.Chromosome, Pos: pos})
+			continue
+		}
+		left, right := call.Start, call.End
+		if bp, ok := top.Left[id]; ok {
+			left = bp.Pos
+		}
+		if bp, ok := top.Right[id]; ok {
+			right = bp.Pos
+		}
+		chr2 := call.Chromosome
+		if call.Chromosome2 != "" {
+			chr2 = call.Chromosome2
+		}
+		result = append(result, signal.Locus{SVID: id, Chr: call.Chromosome, Pos: left}, signal.Locus{SVID: id, Chr: chr2, Pos: right})
+		if call.Type == "DUP:ISP" {
+			pos := call.CopyPos
+			if bp, ok := top.Copy[id]; ok {
+				pos = bp.Pos
+			}
+			result = append(result, signal.Locus{SVID: id, Chr: call.Chromosome, Pos: pos})
+		}
+	}
+	return result
+}
+
+// SupportOf returns the support of a sample for an SV
+func (top Breakpoints) SupportOf(id string, sample int) Support {
+	if sample < len(top.Support[id]) {
+		return top.Support[id][sample]
+	}
+	return Support{}
+}
+
+// support returns the support of a sample for an SV to fill in
+func (top Breakpoints) support(id string, sample int) *Support {
+	supports := top.Support[id]
+	for len(supports) <= sample {
+		supports = append(supports, Support{})
+	}
+	top.Support[id] = supports
+	return &supports[sample]
+}
+
+// SetReference adds the reference support each sample has at the Loci of
+// the SVs, ref[i] that of sample i
+func (top Breakpoints) SetReference(ref []map[string]signal.RefSupport) {
+	for sample, bySV := range ref {
+		for id, counts := range bySV {
+			s := top.support(id, sample)
+			s.RefReads, s.RefPairs = counts.Reads, counts.Pairs
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package vote
+
+import (
+	"strings"
+
+	"github.com/balanur/brosv-go/interval"
+	"github.com/balanur/brosv-go/sv"
+	"github.com/biogo/hts/sam"
+)
+
+// shortest overlap joining the two ends of an insertion
+const minInsertionOverlap = 10
+
+// Insertion is the sequence recovered for an insertion point. When the
+// clips of both sides overlap, Seq is the whole inserted sequence;
+// otherwise Left holds its start and Right its end as far as reads reach.
+type Insertion struct {
+	Seq         string
+	Left, Right string
+}
+
+// Complete reports whether the whole inserted sequence was recovered
+func (ins Insertion) Complete() bool {
+	return ins.Seq != ""
+}
+
+// clipSet holds the soft clips of reads voting for one position: the
+// clips following the aligned part start with the inserted sequence, the
+// clips preceding it end with it
+type clipSet struct {
+	after  []string
+	before []string
+}
+
+// Clips collects the soft clipped sequences of the reads voting for
+// insertion points, by CI and voted position
+type Clips struct {
+	cis  *interval.Store
+	svs  *sv.Store
+	byCI map[int]map[int]*clipSet
+}
+
+func NewClips(cis *interval.Store, svs *sv.Store) *Clips {
+	return &Clips{cis: cis, svs: svs, byCI: make(map[int]map[int]*clipSet)}
+}
+
+// Add keeps the clip of rec voting for pos if the SV of the CI is an insertion.
+// A read voting for the end of its alignment votes with the clip at its end,
+// any other with the clip at its start.
+func (c *Clips) Add(ciIndex int, pos int, rec *sam.Record) {
+	if c == nil || len(rec.Cigar) == 0 || !strings.EqualFold(c.svs.Get(c.cis.Get(ciIndex).SVID).Type, "INS") {
+		return
+	}
+	seq := rec.Seq.Expand()
+	first, last := rec.Cigar[0], rec.Cigar[len(rec.Cigar)-1]
+	byPos, ok := c.byCI[ciIndex]
+	if !ok {
+		byPos = make(map[int]*clipSet)
+		c.byCI[ciIndex] = byPos
+	}
+	set, ok := byPos[pos]
+	if !ok {
+		set = &clipSet{}
+		byPos[pos] = set
+	}
+	if pos == rec.End() {
+		if last.Type() == sam.CigarSoftClipped {
+			set.after = append(set.after, string(seq[len(seq)-last.Len():]))
+		}
+	} else if first.Type() == sam.CigarSoftClipped {
+		set.before = append(set.before, string(seq[:first.Len()]))
+	}
+}
+
+// Insertions recovers the inserted sequence of every refined insertion
+// from the clips voting for the breakpoint chosen by InsertionPoint
+func (c *Clips) Insertions(top Breakpoints) map[string]Insertion {
+	result := make(map[string]Insertion)
+	if c == nil {
+		return result
+	}
+	for _, id := range c.svs.IDs() {
+		if !strings.EqualFold(c.svs.Get(id).Type, "INS") {
+			continue
+		}
+		bp, side, ok := top.InsertionPoint(id)
+		if !ok {
+			continue
+		}
+		ciIndex, ok := c.cis.Side(id, side)
+		if !ok {
+			continue
+		}
+		set, ok := c.byCI[ciIndex][bp.Pos]
+		if !ok {
+			continue
+		}
+		result[id] = assemble(consensus(set.after, false), consensus(set.before, true))
+	}
+	return result
+}
+
+// InsertionPoint returns the breakpoint of an insertion: its CIs surround
+// the same point, so the side with more votes wins
+func (top Breakpoints) InsertionPoint(id string) (Breakpoint, interval.Side, bool) {
+	left, hasLeft := top.Left[id]
+	right, hasRight := top.Right[id]
+	if hasRight && (!hasLeft || right.VoteNum > left.VoteNum) {
+		return right, interval.Right, true
+	}
+	return left, interval.Left, hasLeft
+}
+
+// consensus takes the majority base of every column of clips, aligned at
+// their start or, with fromEnd, at their end. It stops at the first column
+// covered by fewer than two clips, unless there is only one.
+func consensus(clips []string, fromEnd bool) string {
+	minDepth := 2
+	if len(clips) < 2 {
+		minDepth = len(clips)
+	}
+	var result []byte
+	for col := 0; minDepth > 0; col++ {
+		var counts [256]int
+		depth := 0
+		for _, clip := range clips {
+			if col >= len(clip) {
+				continue
+			}
+			if fromEnd {
+				counts[clip[len(clip)-1-col]]++
+			} else {
+				counts[clip[col]]++
+			}
+			depth++
+		}
+		if depth < minDepth {
+			break
+		}
+		best := byte('N')
+		for base, n := range counts {
+			if n > counts[best] {
+				best = byte(base)
+			}
+		}
+		result = append(result, best)
+	}
+	if fromEnd {
+		for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+			result[i], result[j] = result[j], result[i]
+		}
+	}
+	return string(result)
+}
+
+// assemble joins the start of an insertion, read from the clips after the
+// insertion point, with its end, read from the clips before it. Clips
+// longer than a short insertion run on into the flanking reference, so
+// the start and end share the whole insertion; clips of a long one meet
+// in its middle, so the start runs into the end.
+func assemble(start string, end string) Insertion {
+	longest := len(start)
+	if len(end) < longest {
+		longest = len(end)
+	}
+	for k := longest; k >= minInsertionOverlap; k-- {
+		if start[:k] == end[len(end)-k:] {
+			return Insertion{Seq: start[:k]}
+		}
+	}
+	for k := longest; k >= minInsertionOverlap; k-- {
+		if start[len(start)-k:] == end[:k] {
+			return Insertion{Seq: start + end[k:]}
+		}
+	}
+	return Insertion{Left: start, Right: end}
+}
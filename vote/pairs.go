@@ -0,0 +1,227 @@
+package vote
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/balanur/brosv-go/bamio"
+	"github.com/biogo/hts/sam"
+)
+
+// share of split votes and pairs taken as outliers, spread evenly over the CI
+const outlierRate = 0.01
+
+var mateCigarTag = sam.NewTag("MC")
+
+// Pair is a discordant read pair voting for the breakpoint of a CI: the
+// read inside the CI and its mate near the other breakpoint of the SV.
+// Positions are 0-based with exclusive ends, as in sam.Record.
+type Pair struct {
+	Name               string
+	Start, End         int
+	Reverse            bool
+	MateStart, MateEnd int
+	MateReverse        bool
+	ReadGroup          string
+	Sample             int
+	Bam                int
+}
+
+// NewPair returns the pair of rec. Without an MC tag the mate is taken to
+// cover as much reference as rec.
+func NewPair(rec *sam.Record) Pair {
+	p := Pair{
+		Name:        rec.Name,
+		Start:       rec.Pos,
+		End:         rec.End(),
+		Reverse:     rec.Flags&sam.Reverse != 0,
+		MateStart:   rec.MatePos,
+		MateEnd:     rec.MatePos + rec.Len(),
+		MateReverse: rec.Flags&sam.MateReverse != 0,
+		ReadGroup:   bamio.ReadGroup(rec),
+	}
+	if aux := rec.AuxFields.Get(mateCigarTag); aux != nil {
+		if value, ok := aux.Value().(string); ok {
+			if cigar, err := sam.ParseCigar([]byte(value)); err == nil {
+				refLen, _ := cigar.Lengths()
+				p.MateEnd = p.MateStart + refLen
+			}
+		}
+	}
+	return p
+}
+
+func strand(reverse bool) string {
+	if reverse {
+		return "-"
+	}
+	return "+"
+}
+
+// String is the line of the pair in a votes file, with * for no read group
+func (p Pair) String() string {
+	rg := p.ReadGroup
+	if rg == "" {
+		rg = "*"
+	}
+	return fmt.Sprintf("pe %s %d %d %s %d %d %s %s %d %d", p.Name, p.Start, p.End, strand(p.Reverse), p.MateStart, p.MateEnd, strand(p.MateReverse), rg, p.Sample, p.Bam)
+}
+
+func parsePair(words []string) (Pair, error) {
+	var p Pair
+	if len(words) < 8 || len(words) > 11 || words[0] != "pe" {
+		return p, fmt.Errorf("expected 11 fields in a pair line, got %d", len(words))
+	}
+	if len(words) >= 9 && words[8] != "*" {
+		p.ReadGroup = words[8]
+	}
+	if len(words) >= 10 {
+		sample, err := strconv.Atoi(words[9])
+		if err != nil || sample < 0 {
+			return p, fmt.Errorf("bad sample %q", words[9])
+		}
+		p.Sample = sample
+	}
+	if len(words) == 11 {
+		bam, err := strconv.Atoi(words[10])
+		if err != nil || bam < 0 {
+			return p, fmt.Errorf("bad bam index %q", words[10])
+		}
+		p.Bam = bam
+	}
+	var nums [4]int
+	for i, word := range []string{words[2], words[3], words[5], words[6]} {
+		n, err := strconv.Atoi(word)
+		if err != nil {
+			return p, err
+		}
+		nums[i] = n
+	}
+	p.Name = words[1]
+	p.Start, p.End, p.MateStart, p.MateEnd = nums[0], nums[1], nums[2], nums[3]
+	p.Reverse, p.MateReverse = words[4] == "-", words[7] == "-"
+	return p, nil
+}
+
+// span returns the bases of the fragment between the outer end of a read
+// on [start, end) and breakpoint bp, and whether bp lies beyond the read
+// in the direction it faces. A breakpoint is the last base before the
+// junction, 1-based, so a forward read faces bp >= end.
+func span(start int, end int, reverse bool, bp int) (int, bool) {
+	if reverse {
+		return end - bp, bp <= start
+	}
+	return bp - start, bp >= end
+}
+
+// logLikelihood of breakpoint bp for the pair, with the other side of the
+// SV at mateBP: the density of the insert the pair then has in its read
+// group in its bam, mixed with the outlier density uniform
+func (p Pair) logLikelihood(bp int, mateBP int, cfg Config, uniform float64) float64 {
+	readSpan, ok := span(p.Start, p.End, p.Reverse, bp)
+	if !ok {
+		return math.Log(uniform)
+	}
+	mateSpan, _ := span(p.MateStart, p.MateEnd, p.MateReverse, mateBP)
+	if mateSpan < p.MateEnd-p.MateStart {
+		mateSpan = p.MateEnd - p.MateStart
+	}
+	density := cfg.Inserts.Of(p.Bam, p.ReadGroup).Density(readSpan + mateSpan)
+	return math.Log((1-outlierRate)*density + uniform)
+}
+
+// Combine refines the breakpoint of a CI spanning [head, tail] from its
+// split votes and discordant pairs, with the other side of the SV at
+// mateBP. A split vote places the breakpoint exactly and a pair through
+// its insert size, each with a small chance of being an outlier anywhere
+// in the CI. The most likely position is the breakpoint. Split votes keep
+// setting its CI and modes; without any the CI holds CIFraction of the
+// posterior.
+func (dist Distribution) Combine(pairs []Pair, head int, tail int, mateBP int, cfg Config) Breakpoint {
+	if len(pairs) == 0 {
+		return dist.Summarize(cfg)
+	}
+	for _, loc := range dist {
+		if loc.Pos < head {
+			head = loc.Pos
+		}
+		if loc.Pos > tail {
+			tail = loc.Pos
+		}
+	}
+	if tail < head {
+		return dist.Summarize(cfg)
+	}
+	uniform := outlierRate / float64(tail-head+1)
+	ll := make([]float64, tail-head+1)
+	exact := math.Log(1-outlierRate+uniform) - math.Log(uniform)
+	for _, loc := range dist {
+		ll[loc.Pos-head] += float64(loc.VoteNum) * exact
+	}
+	for _, pair := range pairs {
+		for i := range ll {
+			ll[i] += pair.logLikelihood(head+i, mateBP, cfg, uniform)
+		}
+	}
+	best := 0
+	for i := range ll {
+		if ll[i] > ll[best] {
+			best = i
+		}
+	}
+	pos := head + best
+
+	var result Breakpoint
+	if len(dist) > 0 {
+		result = dist.Summarize(cfg)
+	} else {
+		posterior := make([]float64, len(ll))
+		for i := range ll {
+			posterior[i] = math.Exp(ll[i] - ll[best])
+		}
+		lo, hi := massWindow(posterior, cfg.CIFraction)
+		result.Loc = Loc{Pos: pos}
+		result.CI = [2]int{head + lo - pos, head + hi - pos}
+	}
+	result = dist.at(result, pos)
+	result.Pairs = len(pairs)
+	return result
+}
+
+// at moves bp to pos with the split votes there, widening its CI to hold pos
+func (dist Distribution) at(bp Breakpoint, pos int) Breakpoint {
+	lo, hi := bp.Pos+bp.CI[0], bp.Pos+bp.CI[1]
+	bp.Loc = Loc{Pos: pos, VoteNum: dist.votesAt(pos)}
+	if lo > pos {
+		lo = pos
+	}
+	if hi < pos {
+		hi = pos
+	}
+	bp.CI = [2]int{lo - pos, hi - pos}
+	return bp
+}
+
+// massWindow returns the narrowest run of weights holding fraction of their sum
+func massWindow(weights []float64, fraction float64) (int, int) {
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	need := fraction * total
+	bestLo, bestHi := 0, len(weights)-1
+	mass := 0.0
+	lo := 0
+	for hi, w := range weights {
+		mass += w
+		for lo < hi && mass-weights[lo] >= need {
+			mass -= weights[lo]
+			lo++
+		}
+		if mass >= need && hi-lo < bestHi-bestLo {
+			bestLo, bestHi = lo, hi
+		}
+	}
+	return bestLo, bestHi
+}
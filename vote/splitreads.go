@@ -0,0 +1,577 @@
+// Package vote counts the breakpoint votes of clustered reads per CI.
+package vote
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/balanur/brosv-go/bamio"
+	"github.com/balanur/brosv-go/interval"
+	"github.com/balanur/brosv-go/sv"
+	"github.com/biogo/hts/sam"
+)
+
+// Loc is a breakpoint position and the number of reads voting for it
+type Loc struct {
+	Pos     int
+	VoteNum int
+}
+
+// readVote is a read of a sample voting for position pos of a CI
+type readVote struct {
+	pos    int
+	name   string
+	sample int
+}
+
+func (r readVote) less(other readVote) bool {
+	if r.pos != other.pos {
+		return r.pos < other.pos
+	}
+	if r.name != other.name {
+		return r.name < other.name
+	}
+	return r.sample < other.sample
+}
+
+// junction is a split read vote of a sample joining position pos of a CI
+// to position otherPos of CI other of the same SV
+type junction struct {
+	pos      int
+	other    int
+	otherPos int
+	sample   int
+}
+
+func (j junction) less(other junction) bool {
+	if j.pos != other.pos {
+		return j.pos < other.pos
+	}
+	if j.other != other.other {
+		return j.other < other.other
+	}
+	if j.otherPos != other.otherPos {
+		return j.otherPos < other.otherPos
+	}
+	return j.sample < other.sample
+}
+
+// SplitReads votes breakpoint locations from the tags of clustered reads
+// and writes every voted position of each CI to outfile, CIs in index
+// order and positions most voted first, with its votes from each sample,
+// followed by the discordant pairs of the CI, the junctions its split
+// reads join it by to another CI of the SV and the names of the reads
+// voting for each position.
+// The clips of reads voting for insertion points go to clips, if not nil.
+// Reads failing filter do not vote.
+// records must come grouped by SV tag (see bamio.SortBySVTag and bamio.GroupByCI)
+func SplitReads(records bamio.RecordSource, outfile string, cis *interval.Store, clips *Clips, policy *sv.Policy, filter *bamio.ReadFilter) error {
+	//Output file
+	g, err := os.Create(outfile)
+	if err != nil {
+		return &sv.FileError{Op: "create", File: outfile, Err: err}
+	}
+	defer g.Close()
+	writer := bufio.NewWriter(g)
+
+	// votes of each position of a CI, by sample
+	breakpoints := make(map[int]map[int][]int)
+	pairs := make(map[int][]Pair)
+	junctions := make(map[int]map[junction]int)
+	readVotes := make(map[int]map[readVote]bool)
+	samples := 1
+	vote := func(ciIndex int, pos int, sample int, name string) {
+		if breakpoints[ciIndex] == nil {
+			breakpoints[ciIndex] = make(map[int][]int)
+		}
+		votes := breakpoints[ciIndex][pos]
+		for len(votes) <= sample {
+			votes = append(votes, 0)
+		}
+		votes[sample]++
+		breakpoints[ciIndex][pos] = votes
+		if readVotes[ciIndex] == nil {
+			readVotes[ciIndex] = make(map[readVote]bool)
+		}
+		readVotes[ciIndex][readVote{pos: pos, name: name, sample: sample}] = true
+	}
+
+	for {
+		rec, err := records.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return &sv.FileError{Op: "read", File: "clustered reads", Err: err}
+		}
+		if !filter.Accept(rec) {
+			continue
+		}
+		// get ci index of read
+		ciIndex, err := bamio.TagValue(rec, bamio.SVTag)
+		if err == nil && !cis.Valid(ciIndex) {
+			err = fmt.Errorf("no CI %d", ciIndex)
+		}
+		if err != nil {
+			if err := policy.Malformed(sv.ReadError("clustered reads", rec, -1, err)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// reads of single sample runs before multi-sample ones carry no sample
+		sample, err := bamio.TagValue(rec, bamio.SampleTag)
+		if err != nil || sample < 0 {
+			sample = 0
+		}
+		if sample >= samples {
+			samples = sample + 1
+		}
+		if breakpoints[ciIndex] == nil {
+			breakpoints[ciIndex] = make(map[int][]int)
+		}
+
+		if _, err := bamio.TagValue(rec, bamio.PairTag); err == nil {
+			pair := NewPair(rec)
+			pair.Sample = sample
+			// reads of runs before bams were tagged count as the first
+			if bam, err := bamio.TagValue(rec, bamio.BamTag); err == nil && bam >= 0 {
+				pair.Bam = bam
+			}
+			pairs[ciIndex] = append(pairs[ciIndex], pair)
+			continue
+		}
+
+		// get bp loc left or right
+		loc, err := bamio.TagValue(rec, bamio.BreakpointTag(cis.Get(ciIndex).Side))
+		if err != nil {
+			if err := policy.Malformed(sv.ReadError("clustered reads", rec, ciIndex, err)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		clips.Add(ciIndex, loc, rec)
+
+		// update num of votes
+		name := readName(rec)
+		vote(ciIndex, loc, sample, name)
+
+		// a split read tagged for another side of its SV votes there too
+		ci := cis.Get(ciIndex)
+		for _, side := range []interval.Side{interval.Left, interval.Right, interval.Copy} {
+			if side == ci.Side {
+				continue
+			}
+			otherLoc, err := bamio.TagValue(rec, bamio.BreakpointTag(side))
+			if err != nil {
+				continue
+			}
+			otherIndex, ok := cis.Side(ci.SVID, side)
+			if !ok {
+				continue
+			}
+			vote(otherIndex, otherLoc, sample, name)
+			if junctions[ciIndex] == nil {
+				junctions[ciIndex] = make(map[junction]int)
+			}
+			junctions[ciIndex][junction{pos: loc, other: otherIndex, otherPos: otherLoc, sample: sample}]++
+		}
+	}
+
+	// write result to file, in CI order
+	ciIndices := make([]int, 0, len(breakpoints))
+	for k := range breakpoints {
+		ciIndices = append(ciIndices, k)
+	}
+	sort.Ints(ciIndices)
+	for _, k := range ciIndices {
+		v := breakpoints[k]
+		var side int
+		if cis.Get(k).Side == interval.Left {
+			side = 1
+		} else if cis.Get(k).Side == interval.Right {
+			side = 2
+		} else {
+			side = 3
+		}
+
+		var list []Loc
+		for pos, votes := range v {
+			total := 0
+			for _, n := range votes {
+				total += n
+			}
+			list = append(list, Loc{Pos: pos, VoteNum: total})
+		}
+
+		// if there is no support dont write it
+		if len(list) > 0 || len(pairs[k]) > 0 {
+			writer.WriteString("ci " + strconv.Itoa(k) + " " + strconv.Itoa(side) + "\n")
+		}
+
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].VoteNum != list[j].VoteNum {
+				return list[i].VoteNum > list[j].VoteNum
+			}
+			return list[i].Pos < list[j].Pos
+		})
+
+		for _, val := range list {
+			writer.WriteString(strconv.Itoa(val.Pos) + " " + strconv.Itoa(val.VoteNum))
+			for sample := 0; sample < samples; sample++ {
+				n := 0
+				if sample < len(v[val.Pos]) {
+					n = v[val.Pos][sample]
+				}
+				writer.WriteString(" " + strconv.Itoa(n))
+			}
+			writer.WriteString("\n")
+		}
+		for _, pair := range pairs[k] {
+			writer.WriteString(pair.String() + "\n")
+		}
+		joins := make([]junction, 0, len(junctions[k]))
+		for j := range junctions[k] {
+			joins = append(joins, j)
+		}
+		sort.Slice(joins, func(i, j int) bool { return joins[i].less(joins[j]) })
+		for _, j := range joins {
+			writer.WriteString(fmt.Sprintf("sr %d %d %d %d %d\n", j.pos, j.other, j.otherPos, junctions[k][j], j.sample))
+		}
+		reads := make([]readVote, 0, len(readVotes[k]))
+		for r := range readVotes[k] {
+			reads = append(reads, r)
+		}
+		sort.Slice(reads, func(i, j int) bool { return reads[i].less(reads[j]) })
+		for _, r := range reads {
+			writer.WriteString(fmt.Sprintf("rd %d %s %d\n", r.pos, r.name, r.sample))
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return &sv.FileError{Op: "write", File: outfile, Err: err}
+	}
+	return nil
+}
+
+// Breakpoints are the refined breakpoints of each side of the SVs, with
+// the sequences recovered for insertions, the number of split reads and
+// discordant pairs and the allele support of each sample to genotype
+// from, by SV ID
+type Breakpoints struct {
+	Left       map[string]Breakpoint
+	Right      map[string]Breakpoint
+	Copy       map[string]Breakpoint
+	Insertions map[string]Insertion
+	// distinct reads voting for any refined breakpoint of the SV
+	Reads   map[string]int
+	Pairs   map[string]int
+	Support map[string][]Support
+	// breakpoints of the assembled contigs, nil unless assembled
+	Assembled map[string]Assembled
+}
+
+// Read reads the votes and discordant pairs of every CI from a votes file
+// written by SplitReads and refines them into a breakpoint, see Combine.
+// The pairs of a CI reach the other side of the SV at its split read
+// breakpoint, or at the input call if it has none. Where split reads join
+// two CIs of an SV, the junction most of them join places both breakpoints.
+// A split read voting for several breakpoints of an SV counts once.
+// Votes of the samples of cfg.Voting, all if it is empty, are pooled; the
+// reads of each sample voting for the pooled breakpoints and its pairs
+// are its alternate allele support, each read counted once.
+func Read(voteFile string, cis *interval.Store, svs *sv.Store, cfg Config) (Breakpoints, error) {
+	f, err := os.Open(voteFile)
+	if err != nil {
+		return Breakpoints{}, &sv.FileError{Op: "open", File: voteFile, Err: err}
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+
+	result := Breakpoints{
+		Left:       make(map[string]Breakpoint),
+		Right:      make(map[string]Breakpoint),
+		Copy:       make(map[string]Breakpoint),
+		Insertions: make(map[string]Insertion),
+		Reads:      make(map[string]int),
+		Pairs:      make(map[string]int),
+		Support:    make(map[string][]Support),
+	}
+
+	dists := make(map[int]Distribution)
+	pairs := make(map[int][]Pair)
+	junctions := make(map[[2]int]map[[2]int]int)
+	readVotes := make(map[int]map[int][]readVote)
+	var ciIds []int
+	ciId := -1
+
+	// split read support
+	line := 0
+	for scanner.Scan() {
+		line++
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 {
+			continue
+		}
+		if words[0] == "ci" {
+			if len(words) < 3 {
+				return result, &sv.RecordError{File: voteFile, Record: "line " + strconv.Itoa(line), CI: -1, Err: fmt.Errorf("bad ci line %q", scanner.Text())}
+			}
+			var err1, err2 error
+			ciId, err1 = strconv.Atoi(words[1])
+			_, err2 = strconv.Atoi(words[2])
+			if err1 != nil || err2 != nil || !cis.Valid(ciId) {
+				return result, &sv.RecordError{File: voteFile, Record: "line " + strconv.Itoa(line), CI: -1, Err: fmt.Errorf("bad ci line %q", scanner.Text())}
+			}
+			ciIds = append(ciIds, ciId)
+			continue
+		}
+		if ciId < 0 {
+			return result, &sv.RecordError{File: voteFile, Record: "line " + strconv.Itoa(line), CI: -1, Err: fmt.Errorf("vote before the first ci line")}
+		}
+		if words[0] == "pe" {
+			pair, err := parsePair(words)
+			if err != nil {
+				return result, &sv.RecordError{File: voteFile, Record: "line " + strconv.Itoa(line), CI: ciId, Err: fmt.Errorf("bad pair %q: %v", scanner.Text(), err)}
+			}
+			pairs[ciId] = append(pairs[ciId], pair)
+			continue
+		}
+		if words[0] == "rd" {
+			r, err := parseReadVote(words)
+			if err != nil {
+				return result, &sv.RecordError{File: voteFile, Record: "line " + strconv.Itoa(line), CI: ciId, Err: fmt.Errorf("bad read %q: %v", scanner.Text(), err)}
+			}
+			if readVotes[ciId] == nil {
+				readVotes[ciId] = make(map[int][]readVote)
+			}
+			readVotes[ciId][r.pos] = append(readVotes[ciId][r.pos], r)
+			continue
+		}
+		if words[0] == "sr" {
+			j, n, err := parseJunction(words, ciId, cis)
+			if err != nil {
+				return result, &sv.RecordError{File: voteFile, Record: "line " + strconv.Itoa(line), CI: ciId, Err: fmt.Errorf("bad junction %q: %v", scanner.Text(), err)}
+			}
+			if !cfg.votes(j.sample) {
+				continue
+			}
+			// the CIs of a junction are kept in order, whichever holds the primary
+			key, at := [2]int{ciId, j.other}, [2]int{j.pos, j.otherPos}
+			if j.other < ciId {
+				key, at = [2]int{j.other, ciId}, [2]int{j.otherPos, j.pos}
+			}
+			if junctions[key] == nil {
+				junctions[key] = make(map[[2]int]int)
+			}
+			junctions[key][at] += n
+			continue
+		}
+		if len(words) < 2 {
+			return result, &sv.RecordError{File: voteFile, Record: "line " + strconv.Itoa(line), CI: ciId, Err: fmt.Errorf("bad vote %q", scanner.Text())}
+		}
+		pos, err1 := strconv.Atoi(words[0])
+		support, err2 := strconv.Atoi(words[1])
+		if err1 != nil || err2 != nil {
+			return result, &sv.RecordError{File: voteFile, Record: "line " + strconv.Itoa(line), CI: ciId, Err: fmt.Errorf("bad vote %q", scanner.Text())}
+		}
+		var bySample []int
+		for _, word := range words[2:] {
+			n, err := strconv.Atoi(word)
+			if err != nil {
+				return result, &sv.RecordError{File: voteFile, Record: "line " + strconv.Itoa(line), CI: ciId, Err: fmt.Errorf("bad vote %q", scanner.Text())}
+			}
+			bySample = append(bySample, n)
+		}
+		if len(bySample) == 0 {
+			// votes files of single sample runs
+			bySample = []int{support}
+		}
+		if len(cfg.Voting) > 0 {
+			support = 0
+			for sample, n := range bySample {
+				if cfg.votes(sample) {
+					support += n
+				}
+			}
+		}
+		if support > 0 {
+			dists[ciId] = append(dists[ciId], Loc{Pos: pos, VoteNum: support})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return result, &sv.FileError{Op: "read", File: voteFile, Err: err}
+	}
+
+	// only the pairs of voting samples refine the breakpoints
+	allPairs := pairs
+	pairs = make(map[int][]Pair)
+	for id, ciPairs := range allPairs {
+		for _, pair := range ciPairs {
+			if cfg.votes(pair.Sample) {
+				pairs[id] = append(pairs[id], pair)
+			}
+		}
+	}
+
+	splitOnly := make(map[int]Breakpoint)
+	for id, dist := range dists {
+		splitOnly[id] = dist.Summarize(cfg)
+	}
+	// the sample of each pair and of each split read, by SV
+	names := make(map[string]map[string]int)
+	readNames := make(map[string]map[string]int)
+	bps := make(map[int]Breakpoint)
+	for _, id := range ciIds {
+		if len(dists[id]) == 0 && len(pairs[id]) == 0 {
+			continue
+		}
+		ci := cis.Get(id)
+		bps[id] = dists[id].Combine(pairs[id], ci.Head, ci.Tail, mateBreakpoint(ci, cis, svs, splitOnly), cfg)
+	}
+	for key, votes := range junctions {
+		at := bestJunction(votes, dists[key[0]], dists[key[1]])
+		for i, id := range key {
+			if bp, ok := bps[id]; ok {
+				bps[id] = dists[id].at(bp, at[i])
+			}
+		}
+	}
+	for _, id := range ciIds {
+		bp, ok := bps[id]
+		if !ok {
+			continue
+		}
+		ci := cis.Get(id)
+		// fill sv maps
+		switch ci.Side {
+		case interval.Left:
+			result.Left[ci.SVID] = bp
+		case interval.Right:
+			result.Right[ci.SVID] = bp
+		default:
+			result.Copy[ci.SVID] = bp
+		}
+		for _, r := range readVotes[id][bp.Pos] {
+			if readNames[ci.SVID] == nil {
+				readNames[ci.SVID] = make(map[string]int)
+			}
+			readNames[ci.SVID][r.name] = r.sample
+		}
+		for _, pair := range allPairs[id] {
+			if names[ci.SVID] == nil {
+				names[ci.SVID] = make(map[string]int)
+			}
+			names[ci.SVID][pair.Name] = pair.Sample
+		}
+	}
+	for id, pairNames := range names {
+		for _, sample := range pairNames {
+			result.support(id, sample).AltPairs++
+			if cfg.votes(sample) {
+				result.Pairs[id]++
+			}
+		}
+	}
+	for id, splitNames := range readNames {
+		for _, sample := range splitNames {
+			result.support(id, sample).AltReads++
+			if cfg.votes(sample) {
+				result.Reads[id]++
+			}
+		}
+	}
+	return result, nil
+}
+
+// readName tells the two reads of a pair apart
+func readName(rec *sam.Record) string {
+	if rec.Flags&sam.Read2 != 0 {
+		return rec.Name + "/2"
+	}
+	return rec.Name + "/1"
+}
+
+func parseReadVote(words []string) (readVote, error) {
+	if len(words) != 4 {
+		return readVote{}, fmt.Errorf("expected 4 fields in a read line, got %d", len(words))
+	}
+	pos, err1 := strconv.Atoi(words[1])
+	sample, err2 := strconv.Atoi(words[3])
+	if err1 != nil || err2 != nil {
+		return readVote{}, fmt.Errorf("bad position or sample")
+	}
+	return readVote{pos: pos, name: words[2], sample: sample}, nil
+}
+
+func parseJunction(words []string, ciId int, cis *interval.Store) (junction, int, error) {
+	var j junction
+	if len(words) != 5 && len(words) != 6 {
+		return j, 0, fmt.Errorf("expected 6 fields in a junction line, got %d", len(words))
+	}
+	var nums [5]int
+	for i, word := range words[1:] {
+		n, err := strconv.Atoi(word)
+		if err != nil {
+			return j, 0, err
+		}
+		nums[i] = n
+	}
+	j = junction{pos: nums[0], other: nums[1], otherPos: nums[2], sample: nums[4]}
+	if !cis.Valid(j.other) || cis.Get(j.other).SVID != cis.Get(ciId).SVID {
+		return j, 0, fmt.Errorf("CI %d is not of the SV of CI %d", j.other, ciId)
+	}
+	return j, nums[3], nil
+}
+
+// bestJunction returns the positions most split reads join two CIs at,
+// ties going to the positions with more one-sided votes
+func bestJunction(votes map[[2]int]int, first Distribution, second Distribution) [2]int {
+	var best [2]int
+	bestVotes, bestSupport := -1, -1
+	for at, n := range votes {
+		support := first.votesAt(at[0]) + second.votesAt(at[1])
+		if n > bestVotes || n == bestVotes && (support > bestSupport || support == bestSupport && less(at, best)) {
+			best, bestVotes, bestSupport = at, n, support
+		}
+	}
+	return best
+}
+
+// less orders junctions so that ties are broken the same on every run
+func less(a [2]int, b [2]int) bool {
+	return a[0] < b[0] || a[0] == b[0] && a[1] < b[1]
+}
+
+// votesAt returns the split votes for pos
+func (dist Distribution) votesAt(pos int) int {
+	for _, loc := range dist {
+		if loc.Pos == pos {
+			return loc.VoteNum
+		}
+	}
+	return 0
+}
+
+// mateBreakpoint is the breakpoint of the side of the SV across from ci
+func mateBreakpoint(ci interval.Interval, cis *interval.Store, svs *sv.Store, splitOnly map[int]Breakpoint) int {
+	side := interval.Right
+	if ci.Side == interval.Right {
+		side = interval.Left
+	}
+	if id, ok := cis.Side(ci.SVID, side); ok {
+		if bp, ok := splitOnly[id]; ok {
+			return bp.Pos
+		}
+	}
+	call := svs.Get(ci.SVID)
+	if side == interval.Left {
+		return call.Start
+	}
+	return call.End
+}
@@ -0,0 +1,141 @@
+package vote
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/balanur/brosv-go/bamio"
+	"github.com/balanur/brosv-go/interval"
+	"github.com/balanur/brosv-go/sv"
+	"github.com/biogo/hts/sam"
+)
+
+// two reads of sample 0 and one of sample 1 are split across both sides of
+// a deletion, voting at each
+const splitVotes = `ci 0 1
+100 3 2 1
+sr 100 1 500 2 0
+sr 100 1 500 1 1
+rd 100 readA/1 0
+rd 100 readB/2 0
+rd 100 readC/1 1
+ci 1 2
+500 3 2 1
+rd 500 readA/1 0
+rd 500 readB/2 0
+rd 500 readC/1 1
+`
+
+func TestReadCountsReadsOnce(t *testing.T) {
+	voteFile := filepath.Join(t.TempDir(), "votes.txt")
+	if err := os.WriteFile(voteFile, []byte(splitVotes), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cis := interval.NewStore()
+	cis.Add("chr1", interval.Interval{Head: 50, Tail: 150, SVID: "del", Side: interval.Left})
+	cis.Add("chr1", interval.Interval{Head: 450, Tail: 550, SVID: "del", Side: interval.Right})
+	svs := sv.NewStore()
+	svs.Add(sv.SV{ID: "del", Chromosome: "chr1", Start: 100, End: 500, Type: "DEL"})
+
+	top, err := Read(voteFile, cis, svs, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if top.Left["del"].Pos != 100 || top.Right["del"].Pos != 500 {
+		t.Fatalf("breakpoints %d and %d, want 100 and 500", top.Left["del"].Pos, top.Right["del"].Pos)
+	}
+	if top.Reads["del"] != 3 {
+		t.Errorf("%d split reads, want 3", top.Reads["del"])
+	}
+	for sample, want := range []int{2, 1} {
+		if got := top.SupportOf("del", sample).AltReads; got != want {
+			t.Errorf("sample %d has %d alternate reads, want %d", sample, got, want)
+		}
+	}
+
+	cfg := DefaultConfig()
+	cfg.Voting = map[int]bool{1: true}
+	top, err = Read(voteFile, cis, svs, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if top.Reads["del"] != 1 {
+		t.Errorf("%d split reads of the voting sample, want 1", top.Reads["del"])
+	}
+}
+
+// recordSlice replays records as a bamio.RecordSource
+type recordSlice []*sam.Record
+
+func (records *recordSlice) Read() (*sam.Record, error) {
+	if len(*records) == 0 {
+		return nil, io.EOF
+	}
+	rec := (*records)[0]
+	*records = (*records)[1:]
+	return rec, nil
+}
+
+// splitRead is a read of CI ciIndex split across the deletion from left
+// to right
+func splitRead(t *testing.T, name string, ciIndex int, left int, right int) *sam.Record {
+	rec, err := sam.NewRecord(name, nil, nil, -1, -1, 0, 60, nil, []byte("ACGT"), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range []struct {
+		tag   sam.Tag
+		value int
+	}{{bamio.SVTag, ciIndex}, {bamio.LBPTag, left}, {bamio.RBPTag, right}} {
+		aux, err := sam.NewAux(tag.tag, tag.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec.AuxFields = append(rec.AuxFields, aux)
+	}
+	return rec
+}
+
+func TestSplitReadsWritesInOrder(t *testing.T) {
+	cis := interval.NewStore()
+	cis.Add("chr1", interval.Interval{Head: 50, Tail: 150, SVID: "del", Side: interval.Left})
+	cis.Add("chr1", interval.Interval{Head: 450, Tail: 550, SVID: "del", Side: interval.Right})
+	records := recordSlice{
+		splitRead(t, "readB", 1, 100, 500),
+		splitRead(t, "readA", 1, 100, 500),
+		splitRead(t, "readC", 1, 101, 502),
+		splitRead(t, "readD", 0, 101, 502),
+	}
+	voteFile := filepath.Join(t.TempDir(), "votes.txt")
+	if err := SplitReads(&records, voteFile, cis, nil, &sv.Policy{Strict: true}, bamio.DefaultReadFilter()); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(voteFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// positions with as many votes go in position order
+	want := `ci 0 1
+100 2 2
+101 2 2
+sr 101 1 502 1 0
+rd 100 readA/1 0
+rd 100 readB/1 0
+rd 101 readC/1 0
+rd 101 readD/1 0
+ci 1 2
+500 2 2
+502 2 2
+sr 500 0 100 2 0
+sr 502 0 101 1 0
+rd 500 readA/1 0
+rd 500 readB/1 0
+rd 502 readC/1 0
+rd 502 readD/1 0
+`
+	if string(got) != want {
+		t.Errorf("votes\n%s\nwant\n%s", got, want)
+	}
+}